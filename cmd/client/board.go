@@ -26,56 +26,126 @@ var (
 	p2TextColor = color.Black
 )
 
-func drawPlayerBoard(screen *ebiten.Image, g *game.GameStateManager, bidx int, x, y float64, fontSource *text.GoTextFaceSource,
-	queueColor color.RGBA) {
+const (
+	// The board layout at 1x, in a screenWidth x screenHeight screen.
+	boardWidth   = 300
+	boardHeight  = 550
+	boardLeft    = 100
+	boardSpacing = 500
+	boardTop     = 80
+)
+
+// A boardLayout is where the boards go on the screen, and how much to scale
+// them by.
+type boardLayout struct {
+	xs    []float64
+	y     float64
+	scale float64
+}
+
+// computeLayout fits nboards boards into a w x h screen. It scales the 1x
+// layout to fit, keeping its proportions, and centers it.
+func computeLayout(w, h, nboards int) boardLayout {
+	refWidth := float64(screenWidth + boardSpacing*max(nboards-2, 0))
+	scale := min(float64(w)/refWidth, float64(h)/screenHeight)
+	offsetX := (float64(w) - refWidth*scale) / 2
+	offsetY := (float64(h) - screenHeight*scale) / 2
+	l := boardLayout{y: offsetY + boardTop*scale, scale: scale}
+	for i := 0; i < nboards; i++ {
+		l.xs = append(l.xs, offsetX+float64(boardLeft+boardSpacing*i)*scale)
+	}
+	return l
+}
+
+func drawPlayerBoard(screen *ebiten.Image, g *game.GameStateManager, bidx int, x, y, scale float64,
+	fontSource *text.GoTextFaceSource, queueColor color.RGBA) {
 	// vector.DrawFilledRect(screen, float32(x-5), float32(y-5), 300, 550, color.Black, false)
-	boardWidth := 300
-	boardHeight := 550
 	strokeWidth := 2
-	vector.StrokeRect(screen, float32(x-5), float32(y-5), float32(boardWidth), float32(boardHeight),
-		float32(strokeWidth), ColorConstants["White"], false)
+	strokeColor := ColorConstants["White"]
+	if bidx == g.YourBoard {
+		// Our own board.
+		strokeWidth = 4
+		strokeColor = ColorConstants["Green"]
+	}
+	vector.StrokeRect(screen, float32(x-5*scale), float32(y-5*scale), float32(boardWidth*scale),
+		float32(boardHeight*scale), float32(strokeWidth), strokeColor, false)
 	board := g.Boards[bidx]
+	if board == nil {
+		return
+	}
 
 	optxt := &text.DrawOptions{}
-	optxt.GeoM.Translate(x, y-30)
+	optxt.GeoM.Translate(x, y-30*scale)
 	optxt.ColorScale.ScaleWithColor(ColorConstants["White"])
 	text.Draw(screen, g.Players[bidx], &text.GoTextFace{
 		Source: fontSource,
-		Size:   24,
+		Size:   24 * scale,
 	}, optxt)
 
 	optxt2 := &text.DrawOptions{}
-	optxt2.GeoM.Translate(x+190, y-45)
+	optxt2.GeoM.Translate(x+190*scale, y-45*scale)
 	optxt2.ColorScale.ScaleWithColor(ColorConstants["Blue"])
 
 	text.Draw(screen, "Pts:"+strconv.Itoa(board.Solved), &text.GoTextFace{
 		Source: fontSource,
-		Size:   36,
+		Size:   36 * scale,
 	}, optxt2)
 
+	tile := tileSize * scale
 	for idx, slot := range board.Slots {
 		if slot == nil {
 			continue
 		}
-		drawAlpha(screen, slot.OrigQuestion.Alphagram, slot.Whose, x, y+float64(idx*(tileSize+2)),
-			len(slot.OrigQuestion.Words), fontSource)
+		if isFaller(board, idx) {
+			// Outline the falling piece so it stands out from the stack.
+			rowY := y + float64(idx)*(tile+2*scale)
+			vector.StrokeRect(screen, float32(x-2*scale), float32(rowY-1*scale),
+				float32(tile*float64(len(slot.OrigQuestion.Alphagram)+1)+9*scale), float32(tile+2*scale),
+				2, ColorConstants["Green"], false)
+		}
+		drawAlpha(screen, slot.Display(), slot.Whose, x, y+float64(idx)*(tile+2*scale),
+			slot.AnswersLeft, chipColorIndex(slot), tile, fontSource)
 	}
 
 	// Draw the opp queue.
 	if len(board.OppQueue) == 0 {
 		return
 	}
-	height := len(board.OppQueue) * (tileSize + 2)
-	vector.DrawFilledRect(screen, float32(x-25), float32(y)+float32(boardHeight-height-4),
-		15, float32(height-4), queueColor, false)
+	height := float64(len(board.OppQueue)) * (tile + 2*scale)
+	vector.DrawFilledRect(screen, float32(x-25*scale), float32(y+boardHeight*scale-height-4*scale),
+		float32(15*scale), float32(height-4*scale), queueColor, false)
+}
+
+// isFaller is whether the given slot has the board's falling piece in it.
+func isFaller(board *game.GameBoard, slot int) bool {
+	return board.FallerPos >= 0 && board.FallerPos == slot
 }
 
 func drawBoard(screen *ebiten.Image, g *game.GameStateManager, fontSource *text.GoTextFaceSource, queueColor color.RGBA) {
-	drawPlayerBoard(screen, g, 0, 100, 80, fontSource, queueColor)
-	drawPlayerBoard(screen, g, 1, 600, 80, fontSource, queueColor)
+	bounds := screen.Bounds()
+	l := computeLayout(bounds.Dx(), bounds.Dy(), len(g.Boards))
+	for i, x := range l.xs {
+		drawPlayerBoard(screen, g, i, x, l.y, l.scale, fontSource, queueColor)
+	}
+}
+
+// colorByRarity colors the chips by how rare the question is, instead of by
+// how many answers it has. Rarity is worked out by the server; see
+// game.Question.Rarity.
+var colorByRarity bool
+
+// chipColorIndex returns what to color the question's chip by, on the same
+// 1-9 scale as the answer count.
+func chipColorIndex(q *game.Question) int {
+	if !colorByRarity || q.Rarity == nil {
+		return q.AnswersLeft
+	}
+	// 0-100 onto 1-9, rarest the darkest.
+	return 1 + *q.Rarity*8/100
 }
 
-func drawAlpha(screen *ebiten.Image, alpha string, pidx int, x, y float64, nsol int, fontSource *text.GoTextFaceSource) {
+func drawAlpha(screen *ebiten.Image, alpha string, pidx int, x, y float64, nsol, colorIdx int, tile float64,
+	fontSource *text.GoTextFaceSource) {
 	var bgcolor, textcolor, strokecolor color.Color
 	if pidx == 0 {
 		bgcolor, textcolor, strokecolor = p1TileColor, p1TextColor, p1TileStroke
@@ -84,9 +154,9 @@ func drawAlpha(screen *ebiten.Image, alpha string, pidx int, x, y float64, nsol
 	}
 
 	for idx, t := range []rune(alpha) {
-		drawNSolChip(screen, x+(tileSize/2), y+(tileSize/2), tileSize/2, nsol, fontSource)
-		tx := x + 5 + float64(tileSize)*float64(idx+1)
-		drawTile(screen, string(t), bgcolor, textcolor, strokecolor, tx, y, tileSize, tileArcRadius, fontSource)
+		drawNSolChip(screen, x+(tile/2), y+(tile/2), tile/2, nsol, colorIdx, fontSource)
+		tx := x + 5*tile/tileSize + tile*float64(idx+1)
+		drawTile(screen, string(t), bgcolor, textcolor, strokecolor, tx, y, tile, tileArcRadius*tile/tileSize, fontSource)
 	}
 }
 
@@ -186,12 +256,12 @@ func getChipAttributes(effectiveNumAnagrams int) ChipAttributes {
 	}
 }
 
-func drawNSolChip(screen *ebiten.Image, cx, cy, radius float64, nsol int, fontSource *text.GoTextFaceSource) {
+func drawNSolChip(screen *ebiten.Image, cx, cy, radius float64, nsol, colorIdx int, fontSource *text.GoTextFaceSource) {
 
 	if nsol > 9 {
 		nsol = 9
 	}
-	ca := getChipAttributes(nsol)
+	ca := getChipAttributes(colorIdx)
 
 	vector.DrawFilledCircle(screen, float32(cx), float32(cy), float32(radius), ca.color, false)
 	vector.StrokeCircle(screen, float32(cx), float32(cy), float32(radius), 2,
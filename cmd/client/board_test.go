@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/domino14/tetrolith/pkg/game"
+)
+
+func TestLayoutAt1x(t *testing.T) {
+	l := computeLayout(screenWidth, screenHeight, 2)
+	if l.scale != 1 || l.y != boardTop || len(l.xs) != 2 || l.xs[0] != 100 || l.xs[1] != 600 {
+		t.Errorf("1x layout %+v, want the boards at x=100 and x=600", l)
+	}
+}
+
+func TestLayoutFitsScreen(t *testing.T) {
+	for _, sz := range []struct{ w, h, n int }{
+		{2 * screenWidth, 2 * screenHeight, 2}, // HiDPI
+		{800, 900, 2},                          // narrow
+		{3000, 600, 2},                         // wide
+		{screenWidth, screenHeight, 3},
+	} {
+		l := computeLayout(sz.w, sz.h, sz.n)
+		if len(l.xs) != sz.n {
+			t.Fatalf("%+v: %d boards laid out", sz, len(l.xs))
+		}
+		left, right := l.xs[0], l.xs[sz.n-1]+boardWidth*l.scale
+		if left < 0 || right > float64(sz.w) || l.y < 0 || l.y+boardHeight*l.scale > float64(sz.h) {
+			t.Errorf("%+v: boards overflow the screen: %+v", sz, l)
+		}
+		for i := 1; i < sz.n; i++ {
+			if l.xs[i]-l.xs[i-1] < boardWidth*l.scale {
+				t.Errorf("%+v: boards %d and %d overlap", sz, i-1, i)
+			}
+		}
+	}
+}
+
+func TestChipColorIndex(t *testing.T) {
+	defer func(c bool) { colorByRarity = c }(colorByRarity)
+	colorByRarity = true
+	common, rare := 0, 100
+	for _, tc := range []struct {
+		rarity *int
+		want   int
+	}{
+		{nil, 3},     // no rarity: by answers left
+		{&common, 1}, // the most likely rack still goes by rarity
+		{&rare, 9},
+	} {
+		q := &game.Question{AnswersLeft: 3, Rarity: tc.rarity}
+		if got := chipColorIndex(q); got != tc.want {
+			t.Errorf("rarity %v: color %d, want %d", tc.rarity, got, tc.want)
+		}
+	}
+}
+
+func TestIsFaller(t *testing.T) {
+	board := &game.GameBoard{Slots: make([]*game.Question, game.NumSlots), FallerPos: -1}
+	for slot := range board.Slots {
+		if isFaller(board, slot) {
+			t.Errorf("slot %d is the faller with nothing falling", slot)
+		}
+	}
+	board.FallerPos = 3
+	for slot := range board.Slots {
+		if isFaller(board, slot) != (slot == 3) {
+			t.Errorf("slot %d: isFaller = %v", slot, !(slot == 3))
+		}
+	}
+}
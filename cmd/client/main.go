@@ -34,6 +34,10 @@ type Game struct {
 	state      *game.GameStateManager
 	fontSource *text.GoTextFaceSource
 	counter    int
+
+	// useDeviceScale renders at the monitor's device scale factor. It can be
+	// turned off from the page, for setups where that breaks the layout.
+	useDeviceScale bool
 }
 
 func interpolateColor(t float64, start, end color.RGBA) color.RGBA {
@@ -84,6 +88,9 @@ func (g *Game) Draw(screen *ebiten.Image) {
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (screenWidth, screenHeight int) {
+	if !g.useDeviceScale {
+		return outsideWidth, outsideHeight
+	}
 	s := ebiten.Monitor().DeviceScaleFactor()
 	return int(float64(outsideWidth) * s), int(float64(outsideHeight) * s)
 	// return 640, 480
@@ -106,7 +113,12 @@ func main() {
 	ebiten.SetWindowSize(screenWidth, screenHeight)
 	ebiten.SetWindowTitle("Hello, World!")
 
-	g := &Game{}
+	g := &Game{
+		// Set window.disableDeviceScale = true on the page to turn it off.
+		useDeviceScale: !js.Global().Get("disableDeviceScale").Truthy(),
+	}
+	// Set window.colorByRarity = true on the page to turn it on.
+	colorByRarity = js.Global().Get("colorByRarity").Truthy()
 
 	// load images for button states: idle, hover, and pressed
 	// buttonImage, _ := loadButtonImage()
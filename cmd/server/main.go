@@ -13,6 +13,7 @@ import (
 
 	"github.com/domino14/tetrolith/pkg/config"
 	sockets "github.com/domino14/tetrolith/pkg/hub"
+	"github.com/domino14/tetrolith/pkg/logging"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -40,7 +41,10 @@ func main() {
 	if cfg.WordDBServerAddress == "" {
 		panic("need word db server")
 	}
-	log.Info().Interface("config", cfg).
+	logging.ShowSecrets(cfg.LogSecrets)
+	shown := *cfg
+	shown.SecretKey = logging.Secret(cfg.SecretKey)
+	log.Info().Interface("config", shown).
 		Str("build-date", BuildDate).Str("build-hash", BuildHash).Msg("started")
 
 	if cfg.Debug {
@@ -84,6 +88,7 @@ func main() {
 		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
 		<-sig
 		log.Info().Msg("got quit signal...")
+		h.Shutdown(cfg.MaintenanceGrace)
 		ctx, cancel := context.WithTimeout(context.Background(), GracefulShutdownTimeout)
 		if err := srv.Shutdown(ctx); err != nil {
 			// Error from closing listeners, or context timeout:
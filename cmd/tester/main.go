@@ -9,11 +9,9 @@ import (
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/domino14/word_db_server/rpc/wordsearcher"
 	"github.com/lithammer/shortuuid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/domino14/tetrolith/pkg/config"
 	"github.com/domino14/tetrolith/pkg/game"
@@ -78,8 +76,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			panic(err)
 		}
 
-		if len(gsm.Boards) >= 2 && gsm.Boards[1] != nil {
-			guess := gsm.Boards[1].RandomWord(true)
+		// The state has no answers in it, so guess off the server's board.
+		if len(m.mgr.Boards) >= 2 && m.mgr.Boards[1] != nil {
+			guess := m.mgr.Boards[1].RandomWord(true)
 			m.mgr.Boards[1].Guess(guess)
 		}
 	}
@@ -125,24 +124,7 @@ func main() {
 	}
 	log.Debug().Msg("debug logging is on")
 
-	searchparam1 := &wordsearcher.SearchRequest_SearchParam{
-		Condition: wordsearcher.SearchRequest_LEXICON,
-		Conditionparam: &wordsearcher.SearchRequest_SearchParam_Stringvalue{
-			Stringvalue: &wordsearcher.SearchRequest_StringValue{Value: "NWL23"},
-		},
-	}
-	searchparam2 := &wordsearcher.SearchRequest_SearchParam{
-		Condition: wordsearcher.SearchRequest_LENGTH,
-		Conditionparam: &wordsearcher.SearchRequest_SearchParam_Minmax{
-			Minmax: &wordsearcher.SearchRequest_MinMax{Min: 7, Max: 8},
-		},
-	}
-
-	sr := &wordsearcher.SearchRequest{
-		Searchparams: []*wordsearcher.SearchRequest_SearchParam{
-			searchparam1, searchparam2}}
-
-	bts, err := protojson.Marshal(sr)
+	bts, err := game.NewSearch().Lexicon("NWL23").Length(7, 8).JSON()
 	if err != nil {
 		panic(err)
 	}
@@ -151,7 +133,7 @@ func main() {
 	stateOut := make(chan []byte)
 	mgr := game.NewGameStateManager(bts, []string{"us", "bot"}, cfg.WordDBServerAddress,
 		shortuuid.New(),
-		stateOut, game.CryptoSeed())
+		stateOut, game.CryptoSeed(), game.DefaultGameConfig())
 	p := tea.NewProgram(initialModel(mgr))
 
 	mgr.StartGameCountdown()
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/namsral/flag"
 )
 
@@ -9,6 +11,111 @@ type Config struct {
 	WebsocketAddress    string
 	SecretKey           string
 	WordDBServerAddress string
+
+	// BroadcastFanoutCap is the maximum number of sockets the hub sends a
+	// broadcast to per loop iteration, before getting back to other work.
+	BroadcastFanoutCap int
+
+	// A connection that sends InvalidCommandLimit malformed commands in a row
+	// within InvalidCommandWindow gets disconnected.
+	InvalidCommandLimit  int
+	InvalidCommandWindow time.Duration
+
+	// MinGuessInterval is the minimum time between accepted guesses on a board.
+	MinGuessInterval time.Duration
+
+	// SpectatorCatchUp is how many recent state changes a spectator gets
+	// when they start watching a game in progress.
+	SpectatorCatchUp int
+
+	// MaxSpectators is how many clients can spectate a single game at once.
+	// Anyone past that gets turned away.
+	MaxSpectators int
+
+	// IdleForfeit is how long a player can go without guessing before they
+	// forfeit the game.
+	IdleForfeit time.Duration
+
+	// ValidateSeeks checks that a seek's list has enough questions for a
+	// game before posting it. It costs a word DB search per seek.
+	ValidateSeeks bool
+
+	// MaxGameDuration is a hard cap on how long a game can go on.
+	MaxGameDuration time.Duration
+
+	// RevealPacing paces how fast a question's shown answer count goes
+	// down. Zero means no pacing.
+	RevealPacing time.Duration
+
+	// RecentGames is how many finished games are kept in memory, with their
+	// replays, for players to look back on.
+	RecentGames int
+
+	// ReviewPhase is how long players get to look over their missed answers
+	// between the rounds of a series.
+	ReviewPhase time.Duration
+
+	// MaxRounds is how many rounds a continuous series lasts at most.
+	MaxRounds int
+
+	// A client's latency gets sent to it every LagReportEvery pongs, and no
+	// more often than LagReportInterval.
+	LagReportEvery    int
+	LagReportInterval time.Duration
+
+	// MaintenanceGrace is how long games in progress get to finish when the
+	// server is shutting down.
+	MaintenanceGrace time.Duration
+
+	// ResendStateOnReconnect sends a player who connects while they're in a
+	// game the current state of that game.
+	ResendStateOnReconnect bool
+
+	// NoDeath keeps boards in every game from dying. It's only for
+	// developing the board mechanics.
+	NoDeath bool
+
+	// SyncStart starts every board's ticks at the same moment.
+	SyncStart bool
+
+	// TimestampChanges stamps every game state change with when it
+	// happened, for clients that time cues to the animation.
+	TimestampChanges bool
+
+	// ShowBoardStatus puts each board's status in the game state, for
+	// clients that show it to spectators.
+	ShowBoardStatus bool
+
+	// MaxHistory caps how many state changes each game keeps for catching
+	// up spectators; zero means no cap. ArchiveHistory sends each round's
+	// state changes out with its replays.
+	MaxHistory     int
+	ArchiveHistory bool
+
+	// AllowFollow lets a spectator follow one of the players, and see the
+	// game the way they do, e.g. for coaching.
+	AllowFollow bool
+
+	// MaxConns is how many sockets the server takes at once; zero means no
+	// cap. Clients past it, or that connect while the server is going down,
+	// get told to back off for ReconnectBackoff (plus what's left of the
+	// maintenance grace) before trying again.
+	MaxConns         int
+	ReconnectBackoff time.Duration
+
+	// LogSecrets logs tokens, keys and guesses as they are, instead of
+	// redacting them. It's only for debugging locally.
+	LogSecrets bool
+
+	// RedactQueuedAttacks keeps the answers of attacks out of the state
+	// until they rise, and CommitSeed publishes a hash of each game's seed
+	// up front. See the game.GameConfig fields of the same names.
+	RedactQueuedAttacks bool
+	CommitSeed          bool
+
+	// ResultsFile is where players' game results are kept, so that their
+	// stats outlive the server. If it's empty, they're only kept in memory.
+	ResultsFile string
 }
 
 // Load loads the configs from the given arguments
@@ -19,6 +126,36 @@ func (c *Config) Load(args []string) error {
 	fs.BoolVar(&c.Debug, "debug", false, "debug logging on")
 	fs.StringVar(&c.SecretKey, "secret-key", "", "secret key must be a random unguessable string")
 	fs.StringVar(&c.WordDBServerAddress, "word-db-server-address", "", "address for word db server")
+	fs.IntVar(&c.BroadcastFanoutCap, "broadcast-fanout-cap", 256, "max sockets to broadcast to per hub loop iteration (0 for no cap)")
+	fs.IntVar(&c.InvalidCommandLimit, "invalid-command-limit", 20, "disconnect a socket after this many consecutive malformed commands (0 to disable)")
+	fs.DurationVar(&c.InvalidCommandWindow, "invalid-command-window", time.Minute, "window in which the invalid-command-limit applies")
+	fs.DurationVar(&c.MinGuessInterval, "min-guess-interval", 0, "minimum time between accepted guesses per board (0 for no limit)")
+	fs.IntVar(&c.SpectatorCatchUp, "spectator-catch-up", 20, "number of recent state changes sent to a late-joining spectator")
+	fs.IntVar(&c.MaxSpectators, "max-spectators", 100, "max simultaneous spectators per game (0 for no cap)")
+	fs.DurationVar(&c.IdleForfeit, "idle-forfeit", 0, "forfeit players who don't guess for this long (0 to disable)")
+	fs.BoolVar(&c.ValidateSeeks, "validate-seeks", true, "check that a seek's word list is big enough before posting it")
+	fs.DurationVar(&c.MaxGameDuration, "max-game-duration", 2*time.Hour, "hard cap on how long a game can last (0 for no cap)")
+	fs.DurationVar(&c.RevealPacing, "reveal-pacing", 0, "show at most one answer solved per question per this long (0 for no pacing)")
+	fs.IntVar(&c.RecentGames, "recent-games", 100, "number of finished games kept in memory for review")
+	fs.DurationVar(&c.ReviewPhase, "review-phase", 0, "break between rounds to review missed answers (0 for none)")
+	fs.IntVar(&c.MaxRounds, "max-rounds", 0, "end continuous series after this many rounds (0 for no cap)")
+	fs.IntVar(&c.LagReportEvery, "lag-report-every", 1, "send clients their latency every this many pongs")
+	fs.DurationVar(&c.LagReportInterval, "lag-report-interval", 0, "minimum time between latency reports to a client (0 for no minimum)")
+	fs.DurationVar(&c.MaintenanceGrace, "maintenance-grace", time.Minute, "how long games get to finish on shutdown before they're ended")
+	fs.BoolVar(&c.ResendStateOnReconnect, "resend-state-on-reconnect", true, "send a reconnecting player the state of the game they're in")
+	fs.BoolVar(&c.NoDeath, "no-death", false, "boards never die (for development only)")
+	fs.BoolVar(&c.SyncStart, "sync-start", false, "start every board's ticks in step")
+	fs.BoolVar(&c.TimestampChanges, "timestamp-changes", false, "stamp game state changes with when they happened")
+	fs.BoolVar(&c.ShowBoardStatus, "show-board-status", false, "put each board's status in the game state")
+	fs.IntVar(&c.MaxHistory, "max-history", 5000, "max state changes kept per game (0 for no cap)")
+	fs.BoolVar(&c.ArchiveHistory, "archive-history", false, "save each round's state changes with its replays")
+	fs.BoolVar(&c.AllowFollow, "allow-follow", true, "let spectators follow a player and see the game as they do")
+	fs.IntVar(&c.MaxConns, "max-conns", 0, "max simultaneous sockets (0 for no cap)")
+	fs.DurationVar(&c.ReconnectBackoff, "reconnect-backoff", 5*time.Second, "how long turned-away clients are told to wait before reconnecting")
+	fs.BoolVar(&c.LogSecrets, "log-secrets", false, "log tokens, keys and guesses unredacted (for development only)")
+	fs.BoolVar(&c.RedactQueuedAttacks, "redact-queued-attacks", false, "hide the answers of attacks until they rise")
+	fs.BoolVar(&c.CommitSeed, "commit-seed", false, "publish a hash of each game's seed, and reveal the seed when it's over")
+	fs.StringVar(&c.ResultsFile, "results-file", "", "file to keep players' game results in, for their stats (empty to keep them in memory only)")
 	err := fs.Parse(args)
 	return err
 }
@@ -0,0 +1,263 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+)
+
+// An AlphagramSet is a set of questions from the word DB, in a stable order,
+// with helpers for picking and analyzing them.
+type AlphagramSet struct {
+	alphagrams []*wordsearcher.Alphagram
+	index      map[string]int
+}
+
+// NewAlphagramSet makes a set out of the given alphagrams. Duplicates are
+// dropped; the first one wins.
+func NewAlphagramSet(alphagrams []*wordsearcher.Alphagram) *AlphagramSet {
+	s := &AlphagramSet{
+		alphagrams: make([]*wordsearcher.Alphagram, 0, len(alphagrams)),
+		index:      make(map[string]int, len(alphagrams)),
+	}
+	for _, a := range alphagrams {
+		s.add(a)
+	}
+	return s
+}
+
+func (s *AlphagramSet) add(a *wordsearcher.Alphagram) {
+	if _, ok := s.index[a.Alphagram]; ok {
+		return
+	}
+	s.index[a.Alphagram] = len(s.alphagrams)
+	s.alphagrams = append(s.alphagrams, a)
+}
+
+func (s *AlphagramSet) Len() int {
+	return len(s.alphagrams)
+}
+
+// Alphagrams returns the alphagrams in the set, in order.
+func (s *AlphagramSet) Alphagrams() []*wordsearcher.Alphagram {
+	return s.alphagrams
+}
+
+func (s *AlphagramSet) Contains(alphagram string) bool {
+	_, ok := s.index[alphagram]
+	return ok
+}
+
+// FilterByAnswerCount returns the alphagrams that have at least minAnswers
+// and at most maxAnswers answers. A maxAnswers of 0 means no upper limit.
+func (s *AlphagramSet) FilterByAnswerCount(minAnswers, maxAnswers int) *AlphagramSet {
+	filtered := &AlphagramSet{index: make(map[string]int)}
+	for _, a := range s.alphagrams {
+		n := len(a.Words)
+		if n < minAnswers || (maxAnswers > 0 && n > maxAnswers) {
+			continue
+		}
+		filtered.add(a)
+	}
+	return filtered
+}
+
+// TotalDifficulty adds up the difficulty of every alphagram. The word DB only
+// fills in difficulty for expanded searches.
+func (s *AlphagramSet) TotalDifficulty() int {
+	total := 0
+	for _, a := range s.alphagrams {
+		total += int(a.Difficulty)
+	}
+	return total
+}
+
+// Sample shuffles the set deterministically with the given seed, and returns
+// the n alphagrams starting at offset. The same seed always gives the same
+// order, so successive rounds can step through it by advancing the offset.
+// Only as much of the shuffle as is needed gets done.
+func (s *AlphagramSet) Sample(seed [32]byte, offset, n int) ([]*wordsearcher.Alphagram, error) {
+	if left := s.Len() - offset; left < n {
+		return nil, fmt.Errorf("%w: need %d questions, there are %d left",
+			ErrTooFewQuestions, n, max(left, 0))
+	}
+	picked := make([]*wordsearcher.Alphagram, 0, n)
+	for _, i := range seededPrefix(seed, s.Len(), offset+n)[offset:] {
+		picked = append(picked, s.alphagrams[i])
+	}
+	return picked, nil
+}
+
+// SampleAlphagrams picks n of the alphagrams at random with the given seed,
+// in the same way as Sample. It's for cutting a big search result down
+// before making a set out of it.
+func SampleAlphagrams(seed [32]byte, alphagrams []*wordsearcher.Alphagram, n int) []*wordsearcher.Alphagram {
+	n = min(n, len(alphagrams))
+	picked := make([]*wordsearcher.Alphagram, 0, n)
+	for _, i := range seededPrefix(seed, len(alphagrams), n) {
+		picked = append(picked, alphagrams[i])
+	}
+	return picked
+}
+
+// seededPrefix returns the first k indices of a random permutation of
+// [0, n), drawn with the seed. It only runs the first k steps of a
+// Fisher-Yates shuffle, keeping the positions it swapped out in a map, so
+// it's O(k) no matter how big n is. The first k indices come out the same
+// for any larger k, so later rounds can take more without repeats.
+func seededPrefix(seed [32]byte, n, k int) []int {
+	k = min(k, n)
+	randomizer := rand.New(rand.NewChaCha8(seed))
+	swapped := make(map[int]int, k)
+	at := func(i int) int {
+		if v, ok := swapped[i]; ok {
+			return v
+		}
+		return i
+	}
+	prefix := make([]int, k)
+	for i := 0; i < k; i++ {
+		j := i + randomizer.IntN(n-i)
+		prefix[i] = at(j)
+		swapped[j] = at(i)
+	}
+	return prefix
+}
+
+// A LengthMix is how many parts of a game should be words of each length,
+// e.g. {7: 1, 8: 1} for half sevens and half eights.
+type LengthMix map[int]int
+
+// check makes sure the mix has at least one length, and a positive number
+// of parts for each.
+func (m LengthMix) check() error {
+	if len(m) == 0 {
+		return errors.New("a length mix needs at least one length")
+	}
+	for l, parts := range m {
+		if l <= 0 || parts <= 0 {
+			return fmt.Errorf("a length mix can't have %d parts of %d-letter words", parts, l)
+		}
+	}
+	return nil
+}
+
+// quotas splits n questions between the lengths in the mix, in proportion
+// to their parts. Leftovers from rounding go to the lengths that lost the
+// most to it, shortest first on ties, so it's deterministic.
+func (m LengthMix) quotas(n int) map[int]int {
+	lengths := make([]int, 0, len(m))
+	total := 0
+	for l, parts := range m {
+		if parts > 0 {
+			lengths = append(lengths, l)
+			total += parts
+		}
+	}
+	sort.Ints(lengths)
+	quotas := make(map[int]int, len(lengths))
+	if total == 0 {
+		return quotas
+	}
+	given := 0
+	for _, l := range lengths {
+		quotas[l] = n * m[l] / total
+		given += quotas[l]
+	}
+	byRemainder := append([]int(nil), lengths...)
+	sort.SliceStable(byRemainder, func(i, j int) bool {
+		return n*m[byRemainder[i]]%total > n*m[byRemainder[j]]%total
+	})
+	for i := 0; given < n; i++ {
+		quotas[byRemainder[i%len(byRemainder)]]++
+		given++
+	}
+	return quotas
+}
+
+// SampleMix is like Sample, but picks the n alphagrams so that their word
+// lengths follow the mix. offset is how many questions earlier rounds used
+// up, as with Sample; each length moves on through its own questions.
+func (s *AlphagramSet) SampleMix(seed [32]byte, offset, n int, mix LengthMix) ([]*wordsearcher.Alphagram, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	if err := mix.check(); err != nil {
+		return nil, err
+	}
+	quotas := mix.quotas(n)
+	given := 0
+	for _, q := range quotas {
+		given += q
+	}
+	if given != n {
+		return nil, fmt.Errorf("length mix %v deals %d questions, not %d", mix, given, n)
+	}
+	shuffled := make([]*wordsearcher.Alphagram, len(s.alphagrams))
+	copy(shuffled, s.alphagrams)
+	randomizer := rand.New(rand.NewChaCha8(seed))
+	randomizer.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	buckets := map[int][]*wordsearcher.Alphagram{}
+	for _, a := range shuffled {
+		l := len([]rune(a.Alphagram))
+		buckets[l] = append(buckets[l], a)
+	}
+
+	round := offset / n
+	lengths := make([]int, 0, len(quotas))
+	for l := range quotas {
+		lengths = append(lengths, l)
+	}
+	sort.Ints(lengths)
+	picked := make([]*wordsearcher.Alphagram, 0, n)
+	for _, l := range lengths {
+		q := quotas[l]
+		start := round * q
+		if len(buckets[l]) < start+q {
+			return nil, fmt.Errorf("%w: need %d %d-letter words, there are %d",
+				ErrTooFewQuestions, start+q, l, len(buckets[l]))
+		}
+		picked = append(picked, buckets[l][start:start+q]...)
+	}
+	randomizer.Shuffle(len(picked), func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+	return picked, nil
+}
+
+// rarities rates how rare each of the alphagrams is, from 0 to 100, by its
+// probability order among the others of the same length. It's keyed by the
+// alphagrammized alphagram. The word DB only fills in probability for
+// expanded searches; alphagrams without one get left out.
+func rarities(alphagrams []*wordsearcher.Alphagram) map[string]int {
+	byLength := map[int][]int32{}
+	for _, a := range alphagrams {
+		if a.Probability > 0 {
+			l := len([]rune(a.Alphagram))
+			byLength[l] = append(byLength[l], a.Probability)
+		}
+	}
+	for _, probs := range byLength {
+		slices.Sort(probs)
+	}
+	rarity := make(map[string]int, len(alphagrams))
+	for _, a := range alphagrams {
+		if a.Probability <= 0 {
+			continue
+		}
+		probs := byLength[len([]rune(a.Alphagram))]
+		if len(probs) < 2 {
+			continue
+		}
+		// A higher probability order means a less likely rack.
+		rank, _ := slices.BinarySearch(probs, a.Probability)
+		rarity[alphagrammize(a.Alphagram)] = rank * 100 / (len(probs) - 1)
+	}
+	return rarity
+}
@@ -0,0 +1,229 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+)
+
+func alphagramsOf(alphs []*wordsearcher.Alphagram) []string {
+	var names []string
+	for _, a := range alphs {
+		names = append(names, a.Alphagram)
+	}
+	return names
+}
+
+func TestAlphagramSetDedup(t *testing.T) {
+	alphs, _ := testAlphagrams(3)
+	dup := &wordsearcher.Alphagram{Alphagram: alphs[1].Alphagram}
+	s := NewAlphagramSet(append(alphs, dup))
+	if s.Len() != 3 {
+		t.Errorf("Len = %d, want 3", s.Len())
+	}
+	if s.Alphagrams()[1] != alphs[1] {
+		t.Error("the first copy of a duplicate should win")
+	}
+	if !s.Contains(alphs[2].Alphagram) || s.Contains("ZZZZ") {
+		t.Error("Contains is wrong")
+	}
+}
+
+func TestAlphagramSetFilterByAnswerCount(t *testing.T) {
+	var alphs []*wordsearcher.Alphagram
+	for i, name := range []string{"A", "B", "C", "D"} {
+		a := &wordsearcher.Alphagram{Alphagram: name}
+		for range i + 1 {
+			a.Words = append(a.Words, &wordsearcher.Word{})
+		}
+		alphs = append(alphs, a)
+	}
+	s := NewAlphagramSet(alphs)
+	for _, tc := range []struct {
+		min, max int
+		want     []string
+	}{
+		{0, 0, []string{"A", "B", "C", "D"}},
+		{2, 0, []string{"B", "C", "D"}},
+		{2, 3, []string{"B", "C"}},
+		{5, 0, nil},
+	} {
+		f := s.FilterByAnswerCount(tc.min, tc.max)
+		if got := alphagramsOf(f.Alphagrams()); !slices.Equal(got, tc.want) {
+			t.Errorf("%d to %d answers: got %v, want %v", tc.min, tc.max, got, tc.want)
+		}
+		for _, a := range tc.want {
+			if !f.Contains(a) {
+				t.Errorf("filtered set doesn't contain %s", a)
+			}
+		}
+	}
+}
+
+func TestAlphagramSetTotalDifficulty(t *testing.T) {
+	alphs, _ := testAlphagrams(4)
+	for i, a := range alphs {
+		a.Difficulty = int32(i * 10)
+	}
+	if got := NewAlphagramSet(alphs).TotalDifficulty(); got != 60 {
+		t.Errorf("TotalDifficulty = %d, want 60", got)
+	}
+}
+
+func TestAlphagramSetSample(t *testing.T) {
+	alphs, _ := testAlphagrams(30)
+	s := NewAlphagramSet(alphs)
+	first, err := s.Sample(testSeed(), 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := s.Sample(testSeed(), 0, 10)
+	if !slices.Equal(first, again) {
+		t.Error("the same seed gave different samples")
+	}
+	if slices.Equal(first, alphs[:10]) {
+		t.Error("the sample wasn't shuffled")
+	}
+	if !slices.Equal(alphagramsOf(s.Alphagrams()), alphagramsOf(alphs)) {
+		t.Error("sampling reordered the set")
+	}
+
+	// Successive offsets step through the same shuffle without repeats.
+	seen := map[string]bool{}
+	for offset := 0; offset < 30; offset += 10 {
+		sample, err := s.Sample(testSeed(), offset, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, a := range sample {
+			if seen[a.Alphagram] {
+				t.Errorf("%s dealt twice", a.Alphagram)
+			}
+			seen[a.Alphagram] = true
+		}
+	}
+	if _, err := s.Sample(testSeed(), 25, 10); !errors.Is(err, ErrTooFewQuestions) {
+		t.Errorf("sampling past the end: %v", err)
+	}
+}
+
+func TestSeededPrefix(t *testing.T) {
+	whole := seededPrefix(testSeed(), 50, 50)
+	sorted := slices.Clone(whole)
+	slices.Sort(sorted)
+	for i, v := range sorted {
+		if v != i {
+			t.Fatalf("the whole prefix isn't a permutation: %v", whole)
+		}
+	}
+	for _, k := range []int{0, 1, 10, 49} {
+		if got := seededPrefix(testSeed(), 50, k); !slices.Equal(got, whole[:k]) {
+			t.Errorf("first %d: %v, want %v", k, got, whole[:k])
+		}
+	}
+	if got := seededPrefix(testSeed(), 5, 10); len(got) != 5 {
+		t.Errorf("asking for more than there are gave %v", got)
+	}
+
+	alphs, _ := testAlphagrams(30)
+	picked := SampleAlphagrams(testSeed(), alphs, 10)
+	if len(picked) != 10 {
+		t.Fatalf("picked %d", len(picked))
+	}
+	order := seededPrefix(testSeed(), len(alphs), 10)
+	for i, a := range picked {
+		if a != alphs[order[i]] {
+			t.Errorf("pick %d isn't from the seeded shuffle", i)
+		}
+	}
+}
+
+// mixedLengths makes n alphagrams of each of the given lengths.
+func mixedLengths(n int, lengths ...int) []*wordsearcher.Alphagram {
+	var alphs []*wordsearcher.Alphagram
+	for _, l := range lengths {
+		for i := range n {
+			name := fmt.Sprintf("%0*d", l, i)
+			alphs = append(alphs, &wordsearcher.Alphagram{Alphagram: name})
+		}
+	}
+	return alphs
+}
+
+func countLengths(alphs []*wordsearcher.Alphagram) map[int]int {
+	counts := map[int]int{}
+	for _, a := range alphs {
+		counts[len(a.Alphagram)]++
+	}
+	return counts
+}
+
+func TestAlphagramSetSampleMix(t *testing.T) {
+	s := NewAlphagramSet(mixedLengths(100, 6, 7, 8))
+	for _, tc := range []struct {
+		mix  LengthMix
+		want map[int]int
+	}{
+		{LengthMix{7: 1, 8: 1}, map[int]int{7: 25, 8: 25}},
+		{LengthMix{7: 3, 8: 1}, map[int]int{7: 38, 8: 12}},
+		{LengthMix{6: 1, 7: 1, 8: 1}, map[int]int{6: 17, 7: 17, 8: 16}},
+	} {
+		dealt, err := s.SampleMix(testSeed(), 0, 50, tc.mix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := countLengths(dealt); !maps.Equal(got, tc.want) {
+			t.Errorf("mix %v dealt %v, want %v", tc.mix, got, tc.want)
+		}
+		again, _ := s.SampleMix(testSeed(), 0, 50, tc.mix)
+		if !slices.Equal(alphagramsOf(dealt), alphagramsOf(again)) {
+			t.Errorf("mix %v isn't the same for the same seed", tc.mix)
+		}
+	}
+
+	// The next round moves on to fresh questions of each length.
+	first, _ := s.SampleMix(testSeed(), 0, 50, LengthMix{7: 1, 8: 1})
+	second, err := s.SampleMix(testSeed(), 50, 50, LengthMix{7: 1, 8: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range second {
+		if slices.Contains(alphagramsOf(first), a.Alphagram) {
+			t.Fatalf("%s got dealt twice", a.Alphagram)
+		}
+	}
+}
+
+func TestAlphagramSetSampleMixTooFew(t *testing.T) {
+	s := NewAlphagramSet(append(mixedLengths(100, 7), mixedLengths(10, 8)...))
+	if _, err := s.SampleMix(testSeed(), 0, 50, LengthMix{7: 1, 8: 1}); !errors.Is(err, ErrTooFewQuestions) {
+		t.Errorf("too few eights: %v", err)
+	}
+}
+
+func TestAlphagramSetSampleMixBadMix(t *testing.T) {
+	s := NewAlphagramSet(mixedLengths(100, 7, 8))
+	for _, mix := range []LengthMix{nil, {}, {7: 0}, {7: 1, 8: -1}} {
+		if dealt, err := s.SampleMix(testSeed(), 0, 50, mix); err == nil {
+			t.Errorf("mix %v dealt %d questions", mix, len(dealt))
+		}
+	}
+}
+
+func TestRarities(t *testing.T) {
+	alphs := []*wordsearcher.Alphagram{
+		{Alphagram: "EIRS", Probability: 10},
+		{Alphagram: "QZAI", Probability: 1000},
+		{Alphagram: "AEST", Probability: 500},
+		{Alphagram: "AEINRST", Probability: 3},
+		{Alphagram: "ABCD"},
+	}
+	want := map[string]int{"EIRS": 0, "AEST": 50, "AIQZ": 100}
+	if got := rarities(alphs); !maps.Equal(got, want) {
+		t.Errorf("rarities = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,35 @@
+package game
+
+// isRarestFirst is whether the guess, which was just solved, was the first
+// answer solved of a question that's rarer than everything else on the
+// board. Rarity goes by the question's probability order in the game; see
+// rarities. The word DB only has probabilities per alphagram, which every
+// answer to a question shares, so it's the question that has to be rare.
+// Questions without a rarity never count.
+func (gb *GameBoard) isRarestFirst(q *Question) bool {
+	if q.Rarity == nil || q.AnswersTotal < 2 || len(q.AnswerMap) != q.AnswersTotal-1 {
+		return false
+	}
+	for _, other := range gb.Slots {
+		if other != nil && other != q && other.Rarity != nil && *other.Rarity >= *q.Rarity {
+			return false
+		}
+	}
+	return true
+}
+
+// rarestFirstPoints is what the rarest-first bonus is worth for a question
+// of the given rarity: from one point for the likeliest question in the game
+// up to the whole bonus for the rarest.
+func rarestFirstPoints(bonus, rarity int) int {
+	return 1 + (bonus-1)*rarity/100
+}
+
+// awardRarestFirst gives the board the rarest-first bonus if the guess
+// earned it. The guess must have just partly solved the question, and the
+// board must be locked.
+func (gb *GameBoard) awardRarestFirst(q *Question) {
+	if bonus := gb.manager.Config.RarestFirstBonus; bonus > 0 && gb.isRarestFirst(q) {
+		gb.Bonus += rarestFirstPoints(bonus, *q.Rarity)
+	}
+}
@@ -0,0 +1,100 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+)
+
+// rarityBoard has a board with one question on it, AEST with three answers,
+// of the given rarity, and sets the rarest-first bonus.
+func rarityBoard(bonus, rarity int) *GameBoard {
+	gb, _ := testBoard(0)
+	gb.manager.Config.RarestFirstBonus = bonus
+	q := &Question{
+		OrigQuestion: &wordsearcher.Alphagram{
+			Alphagram: "AEST",
+			Words: []*wordsearcher.Word{
+				{Word: "EATS"},
+				{Word: "SEAT"},
+				{Word: "TEAS"},
+			},
+		},
+		Rarity: &rarity,
+	}
+	q.populateMap()
+	gb.Slots[NumSlots-1] = q
+	gb.FallerPos = -1
+	return gb
+}
+
+// landAbove puts a question of the given rarity on top of the board's stack.
+func landAbove(gb *GameBoard, rarity int) {
+	q := &Question{
+		OrigQuestion: &wordsearcher.Alphagram{
+			Alphagram: "ABRT",
+			Words:     []*wordsearcher.Word{{Word: "BRAT"}},
+		},
+		Rarity: &rarity,
+	}
+	q.populateMap()
+	gb.Slots[NumSlots-2] = q
+}
+
+func TestRarestFirstBonus(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		bonus   int
+		rarity  int
+		guesses []string
+		want    int
+	}{
+		{"rarest", 5, 100, []string{"seat", "eats"}, 5},
+		{"middling", 5, 50, []string{"seat", "eats"}, 3},
+		{"likeliest", 5, 0, []string{"seat"}, 1},
+		{"turned off", 0, 100, []string{"seat"}, 0},
+	} {
+		gb := rarityBoard(tc.bonus, tc.rarity)
+		for _, g := range tc.guesses {
+			if o := gb.handleGuessEvent(g); o != GuessSolved {
+				t.Fatalf("%s: %s was %q", tc.name, g, o)
+			}
+		}
+		if gb.Bonus != tc.want {
+			t.Errorf("%s: bonus %d, want %d", tc.name, gb.Bonus, tc.want)
+		}
+	}
+
+	// Only the first answer counts, and only if nothing else on the board
+	// is as rare.
+	for _, above := range []int{80, 90} {
+		gb := rarityBoard(5, 80)
+		landAbove(gb, above)
+		gb.handleGuessEvent("seat")
+		if gb.Bonus != 0 {
+			t.Errorf("with a question of rarity %d above, got a bonus of %d", above, gb.Bonus)
+		}
+	}
+	gb := rarityBoard(5, 80)
+	landAbove(gb, 20)
+	gb.handleGuessEvent("seat")
+	if gb.Bonus != 4 {
+		t.Errorf("the rarest question on the board got a bonus of %d, want 4", gb.Bonus)
+	}
+
+	// A question without a rarity never gets it.
+	gb = rarityBoard(5, 100)
+	gb.Slots[NumSlots-1].Rarity = nil
+	gb.handleGuessEvent("seat")
+	if gb.Bonus != 0 {
+		t.Errorf("a question without a rarity got a bonus of %d", gb.Bonus)
+	}
+
+	// The bonus counts towards the score.
+	gb = rarityBoard(1, 100)
+	gb.handleGuessEvent("seat")
+	gb.manager.Boards = []*GameBoard{gb}
+	if res := gb.manager.computeResult(""); res.Scores[0] != 1 || res.Breakdown[0].Bonus != 1 {
+		t.Errorf("result %+v", res.Breakdown)
+	}
+}
@@ -0,0 +1,133 @@
+package game
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and makes timers. The game logic goes through a Clock
+// instead of using the time package directly, so that time can be controlled
+// in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	After(d time.Duration) <-chan time.Time
+}
+
+// A Timer is the part of time.Timer that the game uses.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// RealClock is a Clock backed by the time package.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (r realTimer) C() <-chan time.Time {
+	return r.t.C
+}
+
+func (r realTimer) Stop() bool {
+	return r.t.Stop()
+}
+
+// ManualClock is a fake Clock whose time only moves when Advance is called.
+// Timers fire, in deadline order, as virtual time passes their deadline.
+type ManualClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (m *ManualClock) Now() time.Time {
+	m.Lock()
+	defer m.Unlock()
+	return m.now
+}
+
+func (m *ManualClock) NewTimer(d time.Duration) Timer {
+	m.Lock()
+	defer m.Unlock()
+	t := &manualTimer{
+		clock:    m,
+		c:        make(chan time.Time, 1),
+		deadline: m.now.Add(d),
+	}
+	if d <= 0 {
+		// Like time.NewTimer, a non-positive duration fires right away.
+		t.c <- m.now
+		return t
+	}
+	t.active = true
+	m.timers = append(m.timers, t)
+	return t
+}
+
+func (m *ManualClock) After(d time.Duration) <-chan time.Time {
+	return m.NewTimer(d).C()
+}
+
+// Advance moves virtual time forward by d, firing every timer whose deadline
+// is reached along the way.
+func (m *ManualClock) Advance(d time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+	m.now = m.now.Add(d)
+
+	sort.SliceStable(m.timers, func(i, j int) bool {
+		return m.timers[i].deadline.Before(m.timers[j].deadline)
+	})
+	remaining := m.timers[:0]
+	for _, t := range m.timers {
+		if !t.active {
+			continue
+		}
+		if t.deadline.After(m.now) {
+			remaining = append(remaining, t)
+			continue
+		}
+		t.active = false
+		t.c <- t.deadline
+	}
+	m.timers = remaining
+}
+
+type manualTimer struct {
+	clock    *ManualClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
@@ -0,0 +1,435 @@
+package game
+
+import "time"
+
+// SeriesMode is whether a game session keeps going after a game ends.
+type SeriesMode string
+
+const (
+	// ContinuousSeries starts another game after each one, until someone leaves.
+	ContinuousSeries SeriesMode = "continuous"
+	// SingleGame ends the session after one game.
+	SingleGame SeriesMode = "single"
+)
+
+// SolveTieBreak decides which slot gets solved when a guess answers more
+// than one question on the board.
+type SolveTieBreak string
+
+const (
+	// TieBreakTop solves the highest of the slots, i.e. the one closest to
+	// the top of the board.
+	TieBreakTop SolveTieBreak = "top"
+	// TieBreakBottom solves the lowest of the slots.
+	TieBreakBottom SolveTieBreak = "bottom"
+	// TieBreakSeeded picks one of the slots using the game's random seed,
+	// so it's the same every time for the same game, board and guess.
+	TieBreakSeeded SolveTieBreak = "seeded"
+)
+
+// RisePolicy decides when attacks that arrive one after another rise onto
+// the board.
+type RisePolicy string
+
+const (
+	// RiseBatch starts the rise timer on the first attack in an empty opp
+	// queue. Attacks that come in before it fires all rise with it.
+	RiseBatch RisePolicy = "batch"
+	// RisePerAttack restarts the rise timer on every attack, so the whole
+	// queue rises a full rise time after the last one came in. Each attack
+	// gets the same warning.
+	RisePerAttack RisePolicy = "perattack"
+)
+
+// SeekOptions are the per-game settings picked by the seeker.
+type SeekOptions struct {
+	SeriesMode SeriesMode `json:",omitempty"`
+	// QuestionTimeoutSecs clears questions that sit unsolved for this many
+	// seconds. See GameConfig.QuestionTimeout. Zero means never.
+	QuestionTimeoutSecs int `json:",omitempty"`
+	// RevealOnTimeout shows the answers of questions that time out.
+	RevealOnTimeout bool `json:",omitempty"`
+	// MercyMargin turns on the comeback mechanic. See GameConfig.MercyMargin.
+	MercyMargin int `json:",omitempty"`
+	// GhostReplayID starts a practice game right away against a replay of
+	// one of the seeker's own earlier games.
+	GhostReplayID string `json:",omitempty"`
+	// SolveQueued is the "advanced" mode where questions can be solved
+	// while they're still in the queue. See GameConfig.SolveQueued.
+	SolveQueued bool `json:",omitempty"`
+	// SolveTieBreak is which slot an ambiguous guess solves. Empty means
+	// TieBreakTop.
+	SolveTieBreak SolveTieBreak `json:",omitempty"`
+	// AutoReseek posts the same seek again for the seeker once the game is
+	// over, so they can go right back to looking for a match.
+	AutoReseek bool `json:",omitempty"`
+	// NoAttacks turns attacks off: it's short for ModeRace.
+	NoAttacks bool `json:",omitempty"`
+	// PrivateBoard only lets the opponent see a summary of the seeker's
+	// board, not the board itself. So do spectators.
+	PrivateBoard bool `json:",omitempty"`
+	// FallerRidesStack keeps the faller on the stack when a question under
+	// it is solved. See GameConfig.FallerRidesStack.
+	FallerRidesStack bool `json:",omitempty"`
+	// LengthMix deals the game's questions in these proportions of word
+	// lengths. See GameConfig.LengthMix.
+	LengthMix LengthMix `json:",omitempty"`
+	// LockDelayMs lets a landed piece be solved for this many milliseconds
+	// before it joins the stack. See GameConfig.LockDelay.
+	LockDelayMs int `json:",omitempty"`
+	// HideOpponentProgress shows players the original answer counts of
+	// their opponents' questions. See GameConfig.HideOpponentProgress.
+	HideOpponentProgress bool `json:",omitempty"`
+	// ScoreWeights scores rounds decided on score by what was solved. See
+	// GameConfig.ScoreWeights.
+	ScoreWeights *ScoreWeights `json:",omitempty"`
+	// RarestFirstBonus gives a bonus for going after the rarest question on
+	// the board first. See GameConfig.RarestFirstBonus.
+	RarestFirstBonus bool `json:",omitempty"`
+	// FaceDown deals each player's questions face down. See
+	// GameConfig.FaceDown.
+	FaceDown bool `json:",omitempty"`
+	// RisePolicy is when piled-up attacks rise. Empty means RiseBatch.
+	RisePolicy RisePolicy `json:",omitempty"`
+	// Counterattack sends cleared attacks back to their sender: it's short
+	// for ModeCounterattack.
+	Counterattack bool `json:",omitempty"`
+	// Mode is the name of the game mode. See GameConfig.Mode.
+	Mode string `json:",omitempty"`
+	// HoldRisesWhenQueueEmpty keeps attacks from rising once a player has
+	// no more pieces coming. See GameConfig.HoldRisesWhenQueueEmpty.
+	HoldRisesWhenQueueEmpty bool `json:",omitempty"`
+	// NumSlots is the size of the boards, from MinNumSlots to MaxNumSlots.
+	// Zero means the usual NumSlots. See GameConfig.NumSlots.
+	NumSlots int `json:",omitempty"`
+	// ScrambleEverySecs reshuffles the tiles on the boards this often, for
+	// a party game. See GameConfig.ScrambleEvery. Zero means never.
+	ScrambleEverySecs int `json:",omitempty"`
+	// NumQuestions is how many questions get dealt each round, from
+	// MinNumQuestions to MaxNumQuestions. Zero means the usual
+	// TotalNumQuestions. See GameConfig.NumQuestions.
+	NumQuestions int `json:",omitempty"`
+	// ReportAlreadySolved tells players when they guess an answer they've
+	// already solved. See GameConfig.ReportAlreadySolved.
+	ReportAlreadySolved bool `json:",omitempty"`
+	// FreshEachRound deals every round from the whole list, so a series
+	// never runs out of questions. See GameConfig.FreshEachRound.
+	FreshEachRound bool `json:",omitempty"`
+	// SpreadAttacks sends each attack to every other player. See
+	// GameConfig.SpreadAttacks.
+	SpreadAttacks bool `json:",omitempty"`
+	// NumPlayers is how many players the game waits for before it starts,
+	// up to MaxNumPlayers. Zero means two.
+	NumPlayers int `json:",omitempty"`
+	// DropDuplicateAttacks drops attacks of racks the target already has.
+	// See GameConfig.DropDuplicateAttacks.
+	DropDuplicateAttacks bool `json:",omitempty"`
+	// ReplayDraws replays a single game that ends in a draw. See
+	// GameConfig.ReplayDraws.
+	ReplayDraws bool `json:",omitempty"`
+}
+
+// mode is the name of the mode the seek asks for, one way or another.
+func (opts SeekOptions) mode() string {
+	switch {
+	case opts.NoAttacks:
+		return ModeRace
+	case opts.Counterattack:
+		return ModeCounterattack
+	}
+	return opts.Mode
+}
+
+// RarestFirstBonusPoints is what the rarest-first bonus is worth, at most,
+// when a seek turns it on.
+const RarestFirstBonusPoints = 5
+
+// MaxQuestionTimeoutSecs is the longest question timeout a seek can ask for.
+const MaxQuestionTimeoutSecs = 600
+
+// MaxLockDelayMs is the longest lock delay a seek can ask for.
+const MaxLockDelayMs = 5000
+
+// MinScrambleEverySecs is the shortest interval between scrambles a seek
+// can ask for.
+const MinScrambleEverySecs = 5
+
+// MinNumSlots and MaxNumSlots bound the board size a seek can ask for.
+const (
+	MinNumSlots = 8
+	MaxNumSlots = 32
+)
+
+// MaxNumPlayers is the most players a seek can wait for.
+const MaxNumPlayers = 4
+
+// MinNumQuestions and MaxNumQuestions bound how many questions a round can
+// deal, for a seek.
+const (
+	MinNumQuestions = 10
+	MaxNumQuestions = 200
+)
+
+// GameConfig holds the rules for a single game. Start from DefaultGameConfig
+// and change what you need.
+type GameConfig struct {
+	// MinGuessInterval is the minimum time between accepted guesses on a
+	// single board. Guesses that come in faster are rejected. Zero means
+	// no limit.
+	MinGuessInterval time.Duration
+
+	// RedactQueuedAttacks hides the answers of racks sent over by the
+	// opponent while they sit in the OppQueue. They only get filled in once
+	// the rack rises onto the board.
+	RedactQueuedAttacks bool
+
+	SeriesMode SeriesMode
+
+	// DropDuplicateAttacks drops an attack if the target board already has
+	// that alphagram somewhere, which can happen in modes where players share
+	// questions.
+	DropDuplicateAttacks bool
+
+	// MinWordLength is the length of the shortest word in the lexicon.
+	// Shorter guesses can't be answers and are rejected outright.
+	MinWordLength int
+
+	// QuestionTimeout clears a question that has been sitting on the board
+	// unsolved for this long, without credit, so that a stuck player can
+	// keep going. Zero means questions never time out.
+	QuestionTimeout time.Duration
+	// RevealOnTimeout includes the remaining answers of a timed-out question
+	// in its state change, for learning.
+	RevealOnTimeout bool
+
+	// IdleForfeit makes a player forfeit if they haven't guessed in this
+	// long while their board is alive. They get a warning halfway through.
+	// Zero means no idle forfeit.
+	IdleForfeit time.Duration
+
+	// MercyMargin turns on a comeback mechanic: when a player is at least
+	// this many questions ahead of everyone else, attacks on them rise in
+	// MercyRiseFactor of the usual time. Zero means no mercy.
+	MercyMargin     int
+	MercyRiseFactor float64
+
+	// Ghost, if set, is a replay to race against. Both boards get its
+	// questions, and the ghost's board, which is the last one, replays its
+	// guesses.
+	Ghost *Replay `json:"-"`
+
+	// MaxGameDuration caps how long a whole game (every round of a series)
+	// can last. When it's hit, the game ends and is decided on score. Zero
+	// means no cap.
+	MaxGameDuration time.Duration
+
+	// SolveQueued lets a player solve questions that are still in their
+	// Queue, before they drop onto the board. Guesses are matched against the
+	// board first. A queued question that gets fully solved is taken out of
+	// the queue and counts just like one solved on the board: it's scored and,
+	// if it's the player's own rack, sent to the opponent. A wrong anagram of
+	// a queued question is never penalized.
+	SolveQueued bool
+
+	// SolveTieBreak is which slot a guess solves when it answers more than
+	// one of them. Only that slot can go on to become an attack.
+	SolveTieBreak SolveTieBreak
+
+	// NumColors is how many color themes the clients have. Each player
+	// gets one of them, picked from the game's seed.
+	NumColors int
+
+	// PrivatePlayers are the players whose opponents, and spectators, only
+	// get a summary of their board.
+	PrivatePlayers []string
+
+	// RevealPacing slows down how fast a question's shown answer count
+	// goes down, so that a player who knows all the answers can't be seen
+	// dumping them in one go. Every answer still counts right away; only the
+	// count the front-end shows is paced, to one per RevealPacing. Zero
+	// means no pacing.
+	RevealPacing time.Duration
+	// FallerRidesStack moves the faller down along with the stack when a
+	// question under it is solved, if it was sitting right on top of the
+	// stack. Otherwise the faller stays put and falls into the gap.
+	FallerRidesStack bool
+	// ReplayDraws replays a single game that ended in a draw, instead of
+	// ending the series with no winner.
+	ReplayDraws bool
+	// LengthMix, if set, deals questions in these proportions of word
+	// lengths, out of whatever the list search finds.
+	LengthMix LengthMix
+
+	// LockDelay keeps a piece that just landed from joining the stack for
+	// this long, whether it fell there or was dropped for a wrong guess.
+	// Until then it can still be solved off the board, which rewards
+	// last-second solves. Zero means pieces lock as soon as they land.
+	LockDelay time.Duration
+
+	// CommitSeed publishes a hash of the game's seed in the state, and
+	// reveals the seed once the game is over, so players and spectators can
+	// check the game was fair.
+	CommitSeed bool
+
+	// MaxSearchResults caps how many of the word list's questions a game
+	// works with. Bigger lists get sampled down to this, with the game's
+	// seed. Zero means no cap.
+	MaxSearchResults int
+
+	// ReviewPhase is a break after each round of a series for the players
+	// to look over what they missed. The next countdown starts once it's
+	// up, or once every player says they're ready. Zero means no break.
+	ReviewPhase time.Duration
+
+	// HideOpponentProgress shows each player how many answers the questions
+	// on their opponents' boards started with, instead of how many are
+	// left, so they can't watch them get solved.
+	HideOpponentProgress bool
+
+	// ScoreWeights, if set, scores rounds that are decided on score by
+	// what kind of questions each player solved, instead of just how many.
+	ScoreWeights *ScoreWeights `json:",omitempty"`
+
+	// FinalStateTimeout is how long the game waits to hand off its final
+	// state before giving up on it and exiting anyway. Zero means it waits
+	// for as long as it takes.
+	FinalStateTimeout time.Duration
+
+	// RarestFirstBonus is the most points a player gets for solving the
+	// first answer of a multi-answer question that's rarer than anything
+	// else on their board. The rarer the question, the more of them they
+	// get; see isRarestFirst and rarestFirstPoints. Zero turns it off.
+	RarestFirstBonus int
+
+	// NoDeath keeps boards from ever dying, so that the board mechanics can
+	// be watched at their extremes. It's only for development.
+	NoDeath bool `json:",omitempty"`
+
+	// SyncStart has every board's first tick happen at the same moment, so
+	// that boards that race each other fall in step.
+	SyncStart bool
+
+	// MaxGuessLength is the longest guess the game takes, in letters. Once
+	// the questions are dealt, the longest of them is the limit, if that's
+	// shorter. Zero means no limit besides that.
+	MaxGuessLength int
+
+	// FaceDown deals each player's questions face down: they don't see what
+	// a question is until it starts falling. Spectators see everything.
+	FaceDown bool
+
+	// RisePolicy is how the rise timer treats attacks that pile up in the
+	// opp queue.
+	RisePolicy RisePolicy
+
+	// TimestampChanges stamps every state change with when it happened, so
+	// that clients can line sound and vibration cues up with the animation.
+	TimestampChanges bool
+
+	// MaxRounds ends a continuous series after this many rounds, won by
+	// whoever won the most of them. Zero means the series goes on until
+	// someone leaves.
+	MaxRounds int
+
+	// Mode is the name of the rules the game is played by; see Mode. Empty
+	// is ModeClassic.
+	Mode string
+
+	// HoldRisesWhenQueueEmpty keeps attacks in the opp queue, instead of
+	// rising, once a player has no more pieces of their own coming. All
+	// that's left for them is to clear the board; the opp queue doesn't
+	// count towards that.
+	HoldRisesWhenQueueEmpty bool
+
+	// FreshEachRound samples every round of a series from the whole word
+	// list, instead of moving on through it, so that a long series never
+	// runs out of questions. Questions can come up again in a later round.
+	FreshEachRound bool
+
+	// ShowBoardStatus puts each board's status (see BoardStatus) in the
+	// state, so spectators can call out a piece about to drop or a player
+	// who's run out of pieces.
+	ShowBoardStatus bool
+
+	// SpreadAttacks sends each attack to every other player, instead of
+	// just the next one along. It only matters with more than two players.
+	SpreadAttacks bool
+
+	// BoardExitTimeout is how long a board waits for the manager to hear
+	// that it's exited, before giving up and exiting anyway. Zero means it
+	// waits for as long as the manager loop is running.
+	BoardExitTimeout time.Duration
+
+	// NumSlots is how many slots each board has: fewer for a quick sprint,
+	// more for a marathon. Zero means NumSlots.
+	NumSlots int
+
+	// NumQuestions is how many questions get dealt each round: a handful
+	// for a quick duel, lots for a long session. Zero means
+	// TotalNumQuestions.
+	NumQuestions int
+
+	// ScrambleEvery reshuffles the tiles of every rack on the boards at
+	// this interval, all at once, so players have to read them again. Only
+	// how they're shown changes; see Question.DisplayOrder. Zero means
+	// never.
+	ScrambleEvery time.Duration
+
+	// ReportAlreadySolved tells a player who guesses an answer they've
+	// already solved on a rack that's still on the board, with
+	// GuessAlreadySolved. Otherwise the guess is ignored, like an
+	// unrelated one. It's never penalized either way.
+	ReportAlreadySolved bool
+
+	// MaxHistory caps how many state changes the game keeps in its history
+	// (see RecentHistory), so a long round can't use up memory. Once it's
+	// full, the oldest ones go. Zero means no cap.
+	MaxHistory int
+
+	// ArchiveHistory sends each board's history for the round out with its
+	// replay (see SetReplaySink), before it's cleared for the next round.
+	// It's all of it: what MaxHistory pushes out gets kept aside until then.
+	ArchiveHistory bool
+}
+
+// questions returns how many questions get dealt each round.
+func (c *GameConfig) questions() int {
+	if c.NumQuestions > 0 {
+		return c.NumQuestions
+	}
+	return TotalNumQuestions
+}
+
+// slots returns how many slots the game's boards have.
+func (c *GameConfig) slots() int {
+	if c.NumSlots > 0 {
+		return c.NumSlots
+	}
+	return NumSlots
+}
+
+// ScoreWeights are how many points each thing is worth.
+type ScoreWeights struct {
+	AttacksCleared int // per attack from the opponent solved
+	AttacksSent    int // per attack that made it to an opponent's board
+	Survival       int // for still being alive when the round ends
+	// Answer is partial credit: it's per answer found, even on questions
+	// that never get fully solved.
+	Answer int
+}
+
+func DefaultGameConfig() *GameConfig {
+	return &GameConfig{
+		SeriesMode:        ContinuousSeries,
+		MinWordLength:     2,
+		MercyRiseFactor:   0.67,
+		MaxGameDuration:   2 * time.Hour,
+		SolveTieBreak:     TieBreakTop,
+		NumColors:         8,
+		MaxSearchResults:  10000,
+		FinalStateTimeout: 5 * time.Second,
+		MaxGuessLength:    32,
+		RisePolicy:        RiseBatch,
+		MaxHistory:        5000,
+	}
+}
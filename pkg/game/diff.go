@@ -0,0 +1,56 @@
+package game
+
+import "fmt"
+
+// DiffBoards returns a human-readable list of the differences between two
+// board states: slot by slot, then the queues, score and status. It's empty
+// if the boards look the same. It doesn't lock either board, so the caller
+// must make sure they're not changing underneath it.
+func DiffBoards(a, b *GameBoard) []string {
+	diffs := []string{}
+	for i := range max(len(a.Slots), len(b.Slots)) {
+		as, bs := describeSlot(slotAt(a, i)), describeSlot(slotAt(b, i))
+		if as != bs {
+			diffs = append(diffs, fmt.Sprintf("slot %d: %s -> %s", i, as, bs))
+		}
+	}
+	if a.FallerPos != b.FallerPos {
+		diffs = append(diffs, fmt.Sprintf("faller: %d -> %d", a.FallerPos, b.FallerPos))
+	}
+	if len(a.Queue) != len(b.Queue) {
+		diffs = append(diffs, fmt.Sprintf("queue: %d -> %d", len(a.Queue), len(b.Queue)))
+	}
+	if len(a.OppQueue) != len(b.OppQueue) {
+		diffs = append(diffs, fmt.Sprintf("opp queue: %d -> %d", len(a.OppQueue), len(b.OppQueue)))
+	}
+	if a.Solved != b.Solved {
+		diffs = append(diffs, fmt.Sprintf("solved: %d -> %d", a.Solved, b.Solved))
+	}
+	if a.Dead != b.Dead {
+		diffs = append(diffs, fmt.Sprintf("dead: %v -> %v", a.Dead, b.Dead))
+	}
+	if a.Won != b.Won {
+		diffs = append(diffs, fmt.Sprintf("won: %v -> %v", a.Won, b.Won))
+	}
+	if a.status != b.status {
+		diffs = append(diffs, fmt.Sprintf("status: %d -> %d", a.status, b.status))
+	}
+	return diffs
+}
+
+// slotAt returns what's in the given slot, or nil if the board is too small
+// to have it.
+func slotAt(gb *GameBoard, i int) *Question {
+	if i >= len(gb.Slots) {
+		return nil
+	}
+	return gb.Slots[i]
+}
+
+// describeSlot is a short description of what's in a slot, for DiffBoards.
+func describeSlot(q *Question) string {
+	if q == nil {
+		return "empty"
+	}
+	return fmt.Sprintf("%s (p%d, %d left)", q.OrigQuestion.Alphagram, q.Whose, q.answersLeft())
+}
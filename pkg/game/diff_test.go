@@ -0,0 +1,20 @@
+package game
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffBoards(t *testing.T) {
+	a, _ := testBoard(3)
+	b, _ := testBoard(3)
+	if d := DiffBoards(a, b); len(d) != 0 {
+		t.Errorf("identical boards differ: %v", d)
+	}
+
+	b.Slots[4] = b.Queue[0]
+	want := []string{"slot 4: empty -> ABCE (p0, 1 left)"}
+	if d := DiffBoards(a, b); !slices.Equal(d, want) {
+		t.Errorf("got %q, want %q", d, want)
+	}
+}
@@ -2,19 +2,27 @@ package game
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"maps"
 	"math/rand/v2"
-	"net/http"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/domino14/word_db_server/rpc/wordsearcher"
 	"github.com/rs/zerolog/log"
-	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/domino14/tetrolith/pkg/logging"
 )
 
 type Status int
@@ -23,31 +31,145 @@ const (
 	Countdown Status = iota
 	Playing
 	PermanentlyOver
+	// Finished is when a single-game series has been played out.
+	Finished
+	// Reviewing is the break after a round for looking over the missed
+	// answers, before the countdown to the next round. See
+	// GameConfig.ReviewPhase.
+	Reviewing
 )
 
+// TotalNumQuestions is how many questions get dealt each round, unless
+// GameConfig.NumQuestions says otherwise.
 const TotalNumQuestions = 50
+
+// NumSlots is how many slots a board has, unless GameConfig.NumSlots says
+// otherwise.
 const NumSlots = 16
 const TickDuration = 1 * time.Second
 const OppTickDuration = 3 * time.Second
 const InitGameCountdownTime = 2 * time.Second
 const NextGameCountdownTime = 10 * time.Second
 
+// BoardCheckPeriod is how often a board checks on slow-moving things like
+// question timeouts and idle players.
+const BoardCheckPeriod = TickDuration / 2
+
 type GameStateManager struct {
 	ID             string
 	Status         Status
-	timer          *time.Timer
+	timer          Timer
+	clock          Clock
 	Boards         []*GameBoard
-	Players        []string
+	Players        []string // Players[i] plays Boards[i]; Players[0] is the seeker
 	QuestionOffset int
 	stop           chan struct{}
 	stateChange    chan struct{}
 	addToOppQueue  chan *Question
-	randSeed       [32]byte
+	// randSeed decides which questions come up and in what order. It must
+	// stay on the server: with it and the search criteria, a player could
+	// work out every question ahead of time. It only goes out once the game
+	// is over, in RevealedSeed.
+	randSeed       [32]byte `json:"-"`
 	stateOut       chan []byte
 	wdbServer      string
 	SearchCriteria []byte
 	boardexited    chan int
 	exitedboards   []bool
+	Config         *GameConfig
+	// numSlots is how many slots each board has, and numQuestions how many
+	// questions get dealt each round.
+	numSlots     int
+	numQuestions int
+	// ColorIndices is the color theme of each player, by player index.
+	ColorIndices []int
+	// YourBoard is the index of the board that the player receiving this
+	// state controls, or -1 for spectators. See StateFor.
+	YourBoard int
+	// Commitment is a hash of the game's seed, published from the start.
+	// Once the game is over, the seed itself is revealed in RevealedSeed,
+	// so anyone can check that the questions weren't tampered with.
+	Commitment   string `json:",omitempty"`
+	RevealedSeed string `json:",omitempty"`
+	// Error is a user-facing reason for the game ending abnormally.
+	Error string `json:",omitempty"`
+	// GhostBoard is the board that Config.Ghost plays, or -1.
+	GhostBoard int
+	// Result is how the last round ended.
+	Result *GameResult `json:",omitempty"`
+	// Seq numbers the states sent to each connection, so clients can tell
+	// if they missed one. The hub fills it in; see RESYNC.
+	Seq uint64 `json:",omitempty"`
+	// GameSeq numbers the states the game has sent out, the same for every
+	// connection. A snapshot carries the GameSeq of the last update it
+	// includes. The hub fills it in too.
+	GameSeq uint64 `json:",omitempty"`
+	// RoundsPlayed and RoundsWon (by board) count the rounds of the series
+	// so far. Once MaxRounds of them are played, SeriesResult has who won
+	// the series. A round a co-op team clears counts for every board.
+	RoundsPlayed int         `json:",omitempty"`
+	RoundsWon    []int       `json:",omitempty"`
+	SeriesResult *GameResult `json:",omitempty"`
+
+	// The cap on how long the whole game can go on.
+	durationCap Timer
+	// scrambleTimer fires for each scramble this round, and scrambleRand
+	// picks the new orders. See GameConfig.ScrambleEvery.
+	scrambleTimer Timer
+	scrambleRand  *rand.Rand
+	// When timer and durationCap are due to fire, for saving the game.
+	timerEndsAt       time.Time
+	durationCapEndsAt time.Time
+	// saveRequests asks the loop for a resumable snapshot (see SaveState).
+	saveRequests chan chan savedGameOrErr
+	// readies has the index of each player who's done reviewing; ready is
+	// who's said so this review phase.
+	readies chan int
+	ready   []bool
+	// endNow asks the loop to end the game early, with the given reason.
+	endNow chan string
+	// endReason is why the game is being ended early, if it is.
+	endReason string
+
+	historyMu sync.Mutex
+	// history is a ring once it's MaxHistory long; historyHead is where
+	// the oldest entry is then. archived has what's been pushed out of it
+	// this round, with ArchiveHistory.
+	history     []HistoryEntry
+	historyHead int
+	archived    []HistoryEntry
+	// lastOccurredAt is the latest OccurredAt stamped on a state change.
+	lastOccurredAt int64
+	// done is closed when the manager loop exits.
+	done chan struct{}
+	// The questions dealt to each board this round, guesses made so far,
+	// and where to send replays when the round is over.
+	dealt          [][]*wordsearcher.Alphagram
+	guesses        []GuessRecord
+	roundStartedAt time.Time
+	replaySink     func(*Replay)
+	resultSink     func(PlayerResult)
+	// prefetched is the list, if it was already searched for; see
+	// SetQuestions.
+	prefetched []*wordsearcher.Alphagram
+	// seriesSolved and seriesFastest are each board's solves over the
+	// series so far, for its result; see tallyRound.
+	seriesSolved  []int
+	seriesFastest []time.Duration
+	// solvedCounts mirrors each board's Solved count, so that the boards can
+	// compare scores without locking each other.
+	solvedCounts []atomic.Int64
+
+	// boardsMu guards Boards being replaced, which the loop does every
+	// round, against readers outside the loop; see boards.
+	boardsMu sync.RWMutex
+	// snapshot is the game as the loop last sent it out, for CurrentState,
+	// and sentStatus is the Status it was sent out with.
+	snapshot   atomic.Pointer[[]byte]
+	sentStatus atomic.Int64
+	// longestWord is the length of the longest question dealt this round,
+	// in runes. Nothing longer can be an answer. Zero before the first deal.
+	longestWord atomic.Int64
 }
 
 type BoardStatus int
@@ -55,7 +177,13 @@ type BoardStatus int
 const (
 	PieceDropping BoardStatus = iota
 	PieceAboutToDrop
+	// PlayerQueueEmpty is when the player has no more pieces coming. That
+	// isn't a win: whatever is left on the board still has to be cleared,
+	// and attacks can still rise (unless HoldRisesWhenQueueEmpty) and kill.
 	PlayerQueueEmpty
+	// PieceLocking is when the faller has landed but isn't part of the stack
+	// yet, with a lock delay on. It can still be solved off the board.
+	PieceLocking
 )
 
 // State changes are important to keep track of for animation purposes.
@@ -66,12 +194,35 @@ const (
 	PieceFall StateChangeType = "piecefall"
 	// PieceLand is when a piece lands at the lowest possible point
 	PieceLand StateChangeType = "pieceland"
+	// PieceLocked is when a landed piece's lock delay runs out and it becomes
+	// part of the stack. PayloadNum is its slot.
+	PieceLocked StateChangeType = "piecelocked"
+	// PieceForcedDrop is when a piece is slammed down to the stack as a penalty
+	// for a wrong guess. Like PieceLand, PayloadNum is where it landed and
+	// PayloadNum2 is where it was.
+	PieceForcedDrop StateChangeType = "pieceforceddrop"
 	// StackRise is when our stack goes up, usually because of opponent pieces
 	StackRise StateChangeType = "stackrise"
 	// StackQueue is when our stack is queued to go up, usually because of opponent pieces
 	StackQueue StateChangeType = "stackqueue"
 	// FullySolveQuestion is when we solve a question
 	FullySolveQuestion StateChangeType = "fullysolvequestion"
+	// QuestionTimedOut is when a question sat unsolved for too long and got
+	// cleared without credit. PayloadNum is the slot; PayloadString has the
+	// answers that were left, if they're revealed.
+	QuestionTimedOut StateChangeType = "questiontimedout"
+
+	// IdleWarning is when the player hasn't guessed in a while and will
+	// forfeit if they don't. PayloadNum is the number of seconds left.
+	IdleWarning StateChangeType = "idlewarning"
+
+	// FullySolveQueuedQuestion is when we solve a question that was still in
+	// our queue. PayloadNum is its index in the Queue before it was removed.
+	FullySolveQueuedQuestion StateChangeType = "fullysolvequeuedquestion"
+
+	// AnswersRevealed is when a question's shown answer count catches up
+	// with the real one, with reveal pacing on. PayloadNum is the slot.
+	AnswersRevealed StateChangeType = "answersrevealed"
 
 	Lost StateChangeType = "lost"
 )
@@ -83,38 +234,165 @@ type StateChange struct {
 	PayloadNum    int
 	PayloadNum2   int
 	PayloadString string
+	// Positions lists slots involved in the change, in order. For a StackRise,
+	// it's where each risen rack ended up.
+	Positions []int `json:",omitempty"`
+	// OccurredAt is when the change happened on the server's clock, in Unix
+	// milliseconds, with GameConfig.TimestampChanges. It never goes backwards
+	// within a game.
+	OccurredAt int64 `json:",omitempty"`
 }
 
 type GameBoard struct {
 	sync.Mutex
 
-	// Slots go from top to bottom.
-	Slots [NumSlots]*Question // alphagrams
+	// Slots go from top to bottom. There are as many as the game's boards
+	// have; see GameConfig.NumSlots.
+	Slots []*Question // alphagrams
 	// Each board should have its own independent timer
-	Timer         *time.Timer `json:"-"`
+	Timer         Timer       `json:"-"`
 	Queue         []*Question // One queue of alphagrams per player from the top
 	OppQueue      []*Question // Queue of alphagrams that were sent over by the opp
-	fallerPos     int
-	OppQueueTimer *time.Timer `json:"-"` // Separate timer for the queued up opponent's racks
+	FallerPos     int         // slot of the falling piece, or -1 if nothing is falling
+	OppQueueTimer Timer       `json:"-"` // Separate timer for the queued up opponent's racks
 	guessEvents   chan string
 	Dead          bool
+	DeathReason   DeathReason `json:",omitempty"` // why Dead is set
 	Won           bool
 	Idx           int
 	oppqueueReady bool
 	Solved        int
-	quitting      bool
-
-	oppQueueChan    chan *Question
-	manager         *GameStateManager
-	stop            chan struct{}
+	// Of the questions solved, AttacksCleared were attacks from the opponent.
+	// AttacksSent counts the attacks that made it to another board; see
+	// routeAttack. AnswersFound counts every answer, whether or not its
+	// question ended up fully solved.
+	AttacksCleared int
+	AttacksSent    int
+	AnswersFound   int
+	// Bonus is extra points on top of the questions solved; see
+	// GameConfig.RarestFirstBonus.
+	Bonus        int
+	quitting     bool
+	lastGuessAt  time.Time
+	idleWarned   bool
+	fastestSolve time.Duration
+	// lastAcceptedAt is when the last guess was let through, for
+	// MinGuessInterval. lastGuessAt is for idling, and starts at the deal.
+	lastAcceptedAt time.Time
+	// When Timer and OppQueueTimer are due to fire.
+	nextTickAt     time.Time
+	oppQueueRiseAt time.Time
+
+	manager *GameStateManager
+	stop    chan struct{}
+	// done is closed once the board loop has stopped taking events, or
+	// right away for a board whose loop won't run again.
+	done            chan struct{}
 	status          BoardStatus
 	LastStateChange StateChange
+	// LastGuessOutcome is what the most recent guess on this board did.
+	LastGuessOutcome GuessOutcome
+
+	// Attacks on their way in get left in the inbox by the manager, which
+	// then pokes attacksIn; the board loop picks them up from there. That
+	// way the manager never waits on a board.
+	inboxMu   sync.Mutex
+	inbox     []*Question
+	attacksIn chan struct{}
+	// unsentAttacks are attacks that the manager was too busy to take when
+	// they were solved. The board loop sends them on once it's unlocked.
+	unsentAttacks []*Question
+
+	// snapshot is the board as JSON, as of its last published state change.
+	snapshot atomic.Pointer[[]byte]
+}
+
+// A GuessOutcome classifies what a guess did.
+type GuessOutcome string
+
+const (
+	// GuessSolved is when the guess was an answer to one of the questions.
+	GuessSolved GuessOutcome = "solved"
+	// GuessPenalized is when the guess had the faller's letters but was not
+	// one of its answers. The faller gets dropped as a penalty.
+	GuessPenalized GuessOutcome = "penalized"
+	// GuessWrongAnagram is when the guess had the letters of a question
+	// that isn't the faller, but was not one of its answers. No penalty.
+	GuessWrongAnagram GuessOutcome = "wronganagram"
+	// GuessUnrelated is when the guess had nothing to do with any question
+	// on the board. It is ignored.
+	GuessUnrelated GuessOutcome = "unrelated"
+	// GuessTooShort is when the guess was shorter than the minimum word length.
+	GuessTooShort GuessOutcome = "tooshort"
+	// GuessAlreadySolved is when the guess was an answer to a question on
+	// the board that the player had already solved. No penalty. Only with
+	// GameConfig.ReportAlreadySolved; otherwise it's GuessUnrelated.
+	GuessAlreadySolved GuessOutcome = "alreadysolved"
+)
+
+// A DeathReason is why a board died.
+type DeathReason string
+
+const (
+	// DeathStackFull is when the board's own stack reached the top.
+	DeathStackFull DeathReason = "stackfull"
+	// DeathBuried is when racks sent over by the opponent pushed the stack
+	// past the top.
+	DeathBuried DeathReason = "buried"
+	// DeathNoRoomForFaller is when a new piece had nowhere to fall.
+	DeathNoRoomForFaller DeathReason = "noroom"
+	// DeathIdle is when the player forfeited by not guessing for too long.
+	DeathIdle DeathReason = "idle"
+)
+
+// die marks the board dead for the given reason. It returns whether it did:
+// with NoDeath on, boards never die.
+func (gb *GameBoard) die(reason DeathReason) bool {
+	if gb.manager.Config.NoDeath {
+		log.Debug().Int("idx", gb.Idx).Str("reason", string(reason)).Msg("death-ignored")
+		return false
+	}
+	if !gb.manager.mode().OnDeath(gb, reason) {
+		return false
+	}
+	gb.Dead = true
+	gb.DeathReason = reason
+	return true
+}
+
+// changesState is whether the board needs to go out again after the guess.
+// An already-solved guess doesn't change anything, but the player has to
+// hear about it.
+func (o GuessOutcome) changesState() bool {
+	return o == GuessSolved || o == GuessPenalized || o == GuessAlreadySolved
 }
 
 type Question struct {
 	OrigQuestion *wordsearcher.Alphagram
 	Whose        int // index in players
 	AnswerMap    map[string]bool
+	// AnswersLeft is how many answers the front-end should show as left.
+	// It's the same as the size of the AnswerMap, unless reveals are paced.
+	AnswersLeft int
+	// AnswersTotal is how many answers the question started with.
+	AnswersTotal int
+	// Rarity is how unlikely the question is compared to the others of its
+	// length in the game, from 0 (the most likely) to 100 (the least). It's
+	// only there if the search was expanded; see rarities. Nil means it
+	// isn't known, which isn't the same as 0.
+	Rarity *int `json:",omitempty"`
+	// DisplayOrder is the order to show the alphagram's letters in, as
+	// indices into it, once the rack has been scrambled. Empty means in
+	// alphagram order. Guesses are checked against the answers either way.
+	// See GameConfig.ScrambleEvery.
+	DisplayOrder []int `json:",omitempty"`
+	// solved has the answers solved so far, so that guessing one of them
+	// again can be told apart from a wrong guess.
+	solved map[string]bool
+	// when the question was put on the board, for question timeouts.
+	landedAt time.Time
+	// when AnswersLeft last went down, for reveal pacing.
+	revealedAt time.Time
 }
 
 func (a *Question) populateMap() {
@@ -122,17 +400,88 @@ func (a *Question) populateMap() {
 	for _, answer := range a.OrigQuestion.Words {
 		a.AnswerMap[strings.ToLower(answer.Word)] = true
 	}
+	a.AnswersLeft = len(a.AnswerMap)
+	a.AnswersTotal = len(a.AnswerMap)
+}
+
+// clone returns a copy of the question with its own answer map.
+func (a *Question) clone() *Question {
+	c := *a
+	c.AnswerMap = maps.Clone(a.AnswerMap)
+	c.solved = maps.Clone(a.solved)
+	return &c
+}
+
+// questionJSON is a question as the players see it: the letters and how
+// many answers are left, but never the answers themselves. What's needed to
+// pick the game up again server-side goes in savedQuestion instead.
+type questionJSON struct {
+	OrigQuestion *alphagramJSON
+	Whose        int
+	AnswersLeft  int
+	AnswersTotal int
+	Rarity       *int  `json:",omitempty"`
+	DisplayOrder []int `json:",omitempty"`
+}
+
+// alphagramJSON has the same JSON name for the alphagram as
+// wordsearcher.Alphagram, so clients can decode it into one.
+type alphagramJSON struct {
+	Alphagram string `json:"alphagram"`
+}
+
+// MarshalJSON leaves out the answer map and the answers in OrigQuestion, so
+// that nobody can read the answers off the state sent to them.
+func (a *Question) MarshalJSON() ([]byte, error) {
+	qj := questionJSON{
+		Whose:        a.Whose,
+		AnswersLeft:  a.AnswersLeft,
+		AnswersTotal: a.AnswersTotal,
+		Rarity:       a.Rarity,
+		DisplayOrder: a.DisplayOrder,
+	}
+	if a.OrigQuestion != nil {
+		qj.OrigQuestion = &alphagramJSON{Alphagram: a.OrigQuestion.Alphagram}
+	}
+	return json.Marshal(qj)
+}
+
+// Display returns the rack's letters in the order they're shown in.
+func (a *Question) Display() string {
+	letters := []rune(a.OrigQuestion.Alphagram)
+	if len(a.DisplayOrder) != len(letters) {
+		return a.OrigQuestion.Alphagram
+	}
+	shown := make([]rune, len(letters))
+	for i, j := range a.DisplayOrder {
+		shown[i] = letters[j]
+	}
+	return string(shown)
 }
 
 func (a *Question) answersLeft() int {
 	return len(a.AnswerMap)
 }
 
+var (
+	ErrGuessTooFast    = errors.New("slow down")
+	ErrTooFewQuestions = errors.New("not enough words in this list to start a game")
+	ErrBadPlayerOrder  = errors.New("boards don't match players")
+	ErrNotAPlayer      = errors.New("player is not in this game")
+	ErrGuessTooLong    = errors.New("guess is too long")
+	ErrBoardOut        = errors.New("this board is out of the round")
+)
+
 func NewGameStateManager(searchCriteria []byte, players []string, wdbServer, ID string, stateout chan []byte,
-	randseed [32]byte) *GameStateManager {
+	randseed [32]byte, cfg *GameConfig) *GameStateManager {
+
+	if cfg == nil {
+		cfg = DefaultGameConfig()
+	}
 
 	gs := &GameStateManager{
 		Status:         Countdown,
+		stop:           make(chan struct{}),
 		stateChange:    make(chan struct{}, 1),
 		Players:        players,
 		ID:             ID,
@@ -142,47 +491,108 @@ func NewGameStateManager(searchCriteria []byte, players []string, wdbServer, ID
 		SearchCriteria: searchCriteria,
 		randSeed:       randseed,
 		boardexited:    make(chan int),
+		clock:          RealClock{},
+		Config:         cfg,
+		numSlots:       cfg.slots(),
+		numQuestions:   cfg.questions(),
+		done:           make(chan struct{}),
+		GhostBoard:     -1,
+		endNow:         make(chan string, 1),
+		saveRequests:   make(chan chan savedGameOrErr),
+		readies:        make(chan int, len(players)),
+		YourBoard:      -1,
+	}
+	if cfg.Ghost != nil {
+		gs.GhostBoard = len(players) - 1
+	}
+	defer gs.publishState()
+	gs.ColorIndices = assignColors(randseed, len(players), cfg.NumColors)
+	if cfg.CommitSeed {
+		gs.Commitment = gs.SeedCommitment()
 	}
 
 	return gs
 }
 
+// SetClock replaces the manager's clock. It must be called before the game
+// countdown starts.
+func (gs *GameStateManager) SetClock(c Clock) {
+	gs.clock = c
+}
+
+// SetQuestions hands the game the list its search criteria turn up, if
+// it's already been fetched, so the first round doesn't search for it
+// again. Like SetClock, it must be called before the countdown starts.
+func (gs *GameStateManager) SetQuestions(alphs []*wordsearcher.Alphagram) {
+	gs.prefetched = alphs
+}
+
 func (gs *GameStateManager) start() error {
-	// reseed randomizer with the same seed so shuffle is deterministic.
-	randomizer := rand.New(rand.NewChaCha8(gs.randSeed))
 	gs.exitedboards = make([]bool, len(gs.Players))
-	s := wordsearcher.NewQuestionSearcherProtobufClient(gs.wdbServer, &http.Client{})
-	sr := &wordsearcher.SearchRequest{}
-	err := protojson.Unmarshal(gs.SearchCriteria, sr)
-	if err != nil {
-		return err
+	if gs.durationCap == nil && gs.Config.MaxGameDuration > 0 {
+		gs.durationCap = gs.clock.NewTimer(gs.Config.MaxGameDuration)
+		gs.durationCapEndsAt = gs.clock.Now().Add(gs.Config.MaxGameDuration)
 	}
+	var dealt []*wordsearcher.Alphagram
+	if gs.Config.Ghost == nil {
+		alphagrams := gs.prefetched
+		gs.prefetched = nil
+		if alphagrams == nil {
+			resp, err := searchQuestions(context.Background(), gs.wdbServer, gs.SearchCriteria)
+			if err != nil {
+				return err
+			}
+			alphagrams = resp.Alphagrams
+		}
 
-	resp, err := s.Search(context.Background(), sr)
-	if err != nil {
-		return err
-	}
-
-	// start a game
-
-	randomizer.Shuffle(len(resp.Alphagrams),
-		func(i, j int) {
-			resp.Alphagrams[i], resp.Alphagrams[j] = resp.Alphagrams[j], resp.Alphagrams[i]
-		})
+		// start a game
 
-	if len(resp.Alphagrams)-gs.QuestionOffset < TotalNumQuestions {
-		return errors.New("too few questions left")
+		// Sample with the same seed every round so the shuffle is deterministic;
+		// the offset moves us on to fresh questions.
+		seed, offset := gs.randSeed, gs.QuestionOffset
+		if gs.Config.FreshEachRound {
+			// Every round draws from the whole list again, with a seed of
+			// its own that's still derived from the game's.
+			seed, offset = roundSeed(gs.randSeed, gs.QuestionOffset/gs.numQuestions), 0
+		}
+		if limit := gs.Config.MaxSearchResults; limit > 0 && len(alphagrams) > limit {
+			alphagrams = SampleAlphagrams(seed, alphagrams, limit)
+		}
+		set := NewAlphagramSet(alphagrams)
+		var err error
+		if len(gs.Config.LengthMix) > 0 {
+			dealt, err = set.SampleMix(seed, offset, gs.numQuestions, gs.Config.LengthMix)
+		} else {
+			dealt, err = set.Sample(seed, offset, gs.numQuestions)
+		}
+		if err != nil {
+			return err
+		}
 	}
-
-	resp.Alphagrams = resp.Alphagrams[gs.QuestionOffset : gs.QuestionOffset+TotalNumQuestions]
 	// Re-initialize boards.
-	gs.Boards = make([]*GameBoard, len(gs.Players))
+	gs.Result = nil
+	gs.resetHistory()
+	boards := make([]*GameBoard, len(gs.Players))
+	gs.solvedCounts = make([]atomic.Int64, len(gs.Players))
 	for i := range gs.Players {
-		gs.Boards[i] = newGameBoard(i, gs)
+		boards[i] = newGameBoard(i, gs)
+	}
+	gs.boardsMu.Lock()
+	gs.Boards = boards
+	gs.boardsMu.Unlock()
+	if err := gs.checkPlayerOrder(); err != nil {
+		return err
 	}
 
-	for idx, alph := range resp.Alphagrams {
-		whose := idx % 2
+	gs.dealt = make([][]*wordsearcher.Alphagram, len(gs.Players))
+	var rarity map[string]int
+	if gs.Config.Ghost != nil {
+		rarity = rarities(gs.Config.Ghost.Questions)
+	} else {
+		rarity = rarities(dealt)
+	}
+	longest := 0
+	deal := func(alph *wordsearcher.Alphagram, whose int) {
 		q := &Question{
 			OrigQuestion: alph,
 			Whose:        whose,
@@ -190,55 +600,295 @@ func (gs *GameStateManager) start() error {
 		// It's already an alphagram, but we want to make sure we sort by rune consistently
 		// for both guesses and alphagrams.
 		q.OrigQuestion.Alphagram = alphagrammize(q.OrigQuestion.Alphagram)
+		if r, ok := rarity[q.OrigQuestion.Alphagram]; ok {
+			q.Rarity = &r
+		}
+		longest = max(longest, len([]rune(q.OrigQuestion.Alphagram)))
 		q.populateMap()
 		gs.Boards[whose].Queue = append(gs.Boards[whose].Queue, q)
+		gs.dealt[whose] = append(gs.dealt[whose], alph)
 	}
-	gs.QuestionOffset += TotalNumQuestions
+	if gs.Config.Ghost != nil {
+		// Race the ghost: both boards get the questions from the replay.
+		for _, alph := range gs.Config.Ghost.Questions {
+			for whose := range gs.Boards {
+				deal(alph, whose)
+			}
+		}
+	} else {
+		for idx, alph := range dealt {
+			deal(alph, gs.mode().OnDeal(idx, len(gs.Boards)))
+		}
+		gs.QuestionOffset += gs.numQuestions
+	}
+	gs.longestWord.Store(int64(longest))
 
 	// Actually start game
+	firstTickAt := gs.clock.Now().Add(TickDuration)
 	for i := range gs.Boards {
 		gs.Boards[i].Tick()
+		if gs.Config.SyncStart {
+			// Every board's first fall happens at the same instant, rather
+			// than a tick after each board happened to get set up.
+			gb := gs.Boards[i]
+			gb.Lock()
+			gb.Timer.Stop()
+			gb.startTimerAt(firstTickAt)
+			gb.Unlock()
+		}
+		gs.Boards[i].publish()
 	}
 	for i := range gs.Boards {
+		gs.Boards[i].status = PieceDropping
 		go gs.Boards[i].loop()
 	}
+	if gs.Config.Ghost != nil {
+		for i := range gs.Boards {
+			if gs.isGhost(i) {
+				go gs.driveGhost(gs.Boards[i], gs.Config.Ghost)
+			}
+		}
+	}
 
 	gs.Status = Playing
+	gs.startScrambles()
 	gs.stateChange <- struct{}{}
 
 	return nil
 }
 
+// startScrambles sets up this round's scrambles, if there are any. The
+// orders come from the game's seed, so the same game scrambles the same
+// way at the same times.
+func (gs *GameStateManager) startScrambles() {
+	gs.stopScrambles()
+	if gs.Config.ScrambleEvery <= 0 {
+		return
+	}
+	seed := sha256.Sum256(fmt.Appendf(gs.randSeed[:], "scramble:%d", gs.QuestionOffset))
+	gs.scrambleRand = rand.New(rand.NewChaCha8(seed))
+	gs.scrambleTimer = gs.clock.NewTimer(gs.Config.ScrambleEvery)
+}
+
+func (gs *GameStateManager) stopScrambles() {
+	if gs.scrambleTimer != nil {
+		gs.scrambleTimer.Stop()
+		gs.scrambleTimer = nil
+	}
+}
+
+// scrambleC returns the channel for the next scramble, or nil if there
+// isn't one coming.
+func (gs *GameStateManager) scrambleC() <-chan time.Time {
+	if gs.scrambleTimer == nil {
+		return nil
+	}
+	return gs.scrambleTimer.C()
+}
+
+// scramble gives every rack on every board that's still playing a new
+// display order, and sends out the boards.
+func (gs *GameStateManager) scramble() {
+	for i, gb := range gs.Boards {
+		if gs.boardOut(i) {
+			continue
+		}
+		gb.Lock()
+		for _, q := range gb.Slots {
+			if q != nil {
+				q.DisplayOrder = gs.scrambleRand.Perm(len([]rune(q.OrigQuestion.Alphagram)))
+			}
+		}
+		gb.Unlock()
+		gb.publish()
+	}
+	gs.scrambleTimer = gs.clock.NewTimer(gs.Config.ScrambleEvery)
+}
+
+// roundSeed derives the seed for a round from the game's seed, for
+// FreshEachRound.
+func roundSeed(seed [32]byte, round int) [32]byte {
+	return sha256.Sum256(binary.BigEndian.AppendUint64(seed[:], uint64(round)))
+}
+
+// checkPlayerOrder makes sure that the boards line up with the players, one
+// for one and in order. Attack routing and per-player state both go by
+// index, so they'd go to the wrong player otherwise.
+func (gs *GameStateManager) checkPlayerOrder() error {
+	if len(gs.Boards) != len(gs.Players) {
+		return fmt.Errorf("%w: %d boards for %d players", ErrBadPlayerOrder,
+			len(gs.Boards), len(gs.Players))
+	}
+	for i, b := range gs.Boards {
+		if b.Idx != i {
+			return fmt.Errorf("%w: board %d has index %d", ErrBadPlayerOrder, i, b.Idx)
+		}
+		if slices.Index(gs.Players, gs.Players[i]) != i {
+			return fmt.Errorf("%w: %s is in the game twice", ErrBadPlayerOrder, gs.Players[i])
+		}
+	}
+	return nil
+}
+
+// attackTargets returns the indices of the boards that an attack from the
+// given board goes to. It's the next board along in player order, wrapping
+// around, that's still in the round: from board i of n, board (i+1)%n,
+// unless that one's out, then (i+2)%n, and so on. With SpreadAttacks, it's
+// every other board that's still in. With two players, either way it's the
+// other one. If everyone else is out, there's nobody to attack.
+func (gs *GameStateManager) attackTargets(from int) ([]int, error) {
+	n := len(gs.Boards)
+	if n < 2 || from < 0 || from >= n {
+		return nil, fmt.Errorf("%w: no board to attack from board %d of %d", ErrBadPlayerOrder,
+			from, n)
+	}
+	targets := make([]int, 0, n-1)
+	for step := 1; step < n; step++ {
+		to := (from + step) % n
+		if gs.boardOut(to) {
+			continue
+		}
+		targets = append(targets, to)
+		if !gs.Config.SpreadAttacks {
+			break
+		}
+	}
+	return targets, nil
+}
+
+// boardOut says whether the board has left this round. Only the manager
+// loop keeps track of that.
+func (gs *GameStateManager) boardOut(idx int) bool {
+	return idx < len(gs.exitedboards) && gs.exitedboards[idx]
+}
+
+// roundOver says whether the board that just left the round ends it for
+// everyone. That's up to the mode; see Mode.OnExit.
+func (gs *GameStateManager) roundOver(exited int) bool {
+	return gs.mode().OnExit(gs, exited)
+}
+
+// routeAttack delivers an attack to every board the mode sends it to. Each
+// board after the first gets a copy of its own, so that solving it on one
+// board doesn't touch it on another. Delivering never blocks, so one slow
+// board doesn't hold up the attack on the rest, or the loop. An attack that
+// goes anywhere counts once for the board that sent it.
+func (gs *GameStateManager) routeAttack(q *Question) {
+	opps := gs.mode().OnAttack(gs, q)
+	for i, opp := range opps {
+		if i > 0 {
+			q = q.clone()
+		}
+		gs.Boards[opp].deliverAttack(q)
+	}
+	if len(opps) > 0 && q.Whose >= 0 && q.Whose < len(gs.Boards) {
+		sender := gs.Boards[q.Whose]
+		sender.Lock()
+		sender.AttacksSent++
+		sender.Unlock()
+	}
+}
+
 func (gs *GameStateManager) TryDestroy() error {
-	if gs.Status != Countdown {
+	// The loop owns Status; go by the one it last sent out.
+	status := Status(gs.sentStatus.Load())
+	if status == PermanentlyOver || status == Finished {
+		// The manager loop has already exited; nothing left to stop.
+		return nil
+	}
+	if status != Countdown && status != Reviewing {
 		return errors.New("cannot destroy an ongoing game")
 	}
 	gs.Stop()
-	for _, b := range gs.Boards {
+	for _, b := range gs.boards() {
 		b.Quit()
 	}
 	return nil
 }
 
 func (gs *GameStateManager) StartGameCountdown() {
-	// start timer
-	gs.timer = time.NewTimer(InitGameCountdownTime)
+	gs.startCountdown(InitGameCountdownTime)
 	go gs.Loop()
 }
 
-func (gs *GameStateManager) Guess(username, guess string) error {
-	found := false
+// startCountdown starts the timer for the next round to start.
+func (gs *GameStateManager) startCountdown(d time.Duration) {
+	gs.timer = gs.clock.NewTimer(d)
+	gs.timerEndsAt = gs.clock.Now().Add(d)
+}
+
+// checkGuessLength turns away guesses that are too long to be an answer
+// before they get anywhere near a board: longer than MaxGuessLength, or than
+// the longest question dealt.
+func (gs *GameStateManager) checkGuessLength(guess string) error {
+	limit := gs.Config.MaxGuessLength
+	if longest := int(gs.longestWord.Load()); longest > 0 && (limit <= 0 || longest < limit) {
+		limit = longest
+	}
+	if limit > 0 && utf8.RuneCountInString(guess) > limit {
+		return ErrGuessTooLong
+	}
+	return nil
+}
+
+// Ready says the player is done reviewing the last round. Once every player
+// is, the countdown to the next one starts without waiting out the review
+// phase.
+func (gs *GameStateManager) Ready(username string) error {
 	for i := range gs.Players {
 		if gs.Players[i] == username {
-			found = true
-			gs.Boards[i].Guess(guess)
-			break
+			select {
+			case gs.readies <- i:
+			default:
+				// The loop has plenty to catch up on already.
+			}
+			return nil
 		}
 	}
-	if !found {
-		return errors.New("player is not in this game")
+	return errors.New("player is not in this game")
+}
+
+// endReview moves on from the review phase to the countdown for the next
+// round.
+func (gs *GameStateManager) endReview() {
+	gs.ready = nil
+	gs.startCountdown(NextGameCountdownTime)
+	gs.Status = Countdown
+	gs.stateOut <- gs.publishState()
+}
+
+// Guess sends the player's guess to their own board. A guess only ever
+// touches the board it's sent to: solving a rack there never changes a rack
+// on any other board, even one dealt the same question, since every board
+// has questions of its own (see routeAttack). So all that matters is that
+// it's the right board, and boardFor makes sure of that.
+func (gs *GameStateManager) Guess(username, guess string) error {
+	if err := gs.checkGuessLength(guess); err != nil {
+		return err
 	}
-	return nil
+	gb, err := gs.boardFor(username)
+	if err != nil {
+		return err
+	}
+	return gb.Guess(guess)
+}
+
+// boardFor returns the board that the player plays. It checks the board is
+// theirs, rather than trusting that the boards are in player order.
+func (gs *GameStateManager) boardFor(username string) (*GameBoard, error) {
+	i := slices.Index(gs.Players, username)
+	if i == -1 {
+		return nil, ErrNotAPlayer
+	}
+	boards := gs.boards()
+	if i >= len(boards) {
+		return nil, errors.New("game has not started")
+	}
+	if gb := boards[i]; gb.Idx != i {
+		return nil, fmt.Errorf("%w: %s's board has index %d, not %d", ErrBadPlayerOrder,
+			username, gb.Idx, i)
+	}
+	return boards[i], nil
 }
 
 func (gs *GameStateManager) Loop() {
@@ -246,32 +896,69 @@ func (gs *GameStateManager) Loop() {
 gloop:
 	for {
 		select {
-		case <-gs.timer.C:
-			if gs.Status == Countdown {
+		case <-gs.timer.C():
+			if gs.Status == Reviewing {
+				gs.endReview()
+			} else if gs.Status == Countdown {
 				err := gs.start()
 				if err != nil {
-					log.Err(err).Msg("start-error")
+					log.Err(err).Str("gid", gs.ID).Msg("start-error")
+					if errors.Is(err, ErrTooFewQuestions) {
+						gs.Error = err.Error()
+					} else {
+						gs.Error = "could not start game"
+					}
 					break gloop
 				}
 			}
 
 		case alph := <-gs.addToOppQueue:
-			opp := 1 - alph.Whose // if 0, then 1, else if 1 then 0
-			gs.Boards[opp].oppQueueChan <- alph
+			gs.routeAttack(alph)
 
 		case <-gs.stop:
 			break gloop
 
-		case <-gs.stateChange:
-			// Send out game state to sockets! Print out, etc. stop the game if needed.
-			for i := range gs.Boards {
-				gs.Boards[i].Lock()
+		case idx := <-gs.readies:
+			if gs.Status != Reviewing {
+				break
+			}
+			gs.ready[idx] = true
+			allReady := true
+			for i := range gs.Players {
+				if !gs.isGhost(i) && !gs.ready[i] {
+					allReady = false
+				}
 			}
-			gs.stateOut <- gs.Marshal()
-			for i := range gs.Boards {
-				gs.Boards[len(gs.Boards)-1-i].Unlock()
+			if allReady {
+				gs.timer.Stop()
+				gs.endReview()
+			}
+
+		case reply := <-gs.saveRequests:
+			reply <- gs.save()
+
+		case <-gs.scrambleC():
+			gs.scramble()
+			gs.stateOut <- gs.publishState()
+
+		case <-gs.durationCapC():
+			// The game has gone on too long. End the round; it'll be decided
+			// on score once all the boards are out.
+			log.Info().Str("gid", gs.ID).Msg("game-duration-cap-reached")
+			if gs.forceEnd(ResultTimeLimit) {
+				break gloop
 			}
 
+		case reason := <-gs.endNow:
+			log.Info().Str("gid", gs.ID).Str("reason", reason).Msg("game-ended-early")
+			if gs.forceEnd(reason) {
+				break gloop
+			}
+
+		case <-gs.stateChange:
+			// Send out game state to sockets! Print out, etc. stop the game if needed.
+			gs.stateOut <- gs.publishState()
+
 		case idx := <-gs.boardexited:
 			gs.exitedboards[idx] = true
 			allquit := true
@@ -282,40 +969,187 @@ gloop:
 				}
 			}
 			if allquit {
-				gs.timer = time.NewTimer(NextGameCountdownTime)
-				gs.Status = Countdown
-			} else {
+				gs.stopScrambles()
+				gs.saveReplays()
+				gs.Result = gs.computeResult(gs.endReason)
+				if gs.countRound() {
+					gs.SeriesResult = gs.seriesResult()
+					gs.Status = Finished
+					break gloop
+				}
+				// A drawn single game gets replayed, if the config says so.
+				replayDraw := gs.Result.IsDraw() && gs.Config.ReplayDraws
+				if (gs.Config.SeriesMode == SingleGame && !replayDraw) || gs.endReason != "" {
+					gs.Status = Finished
+					break gloop
+				}
+				if gs.Config.ReviewPhase > 0 {
+					// The result has everyone's missed answers to look over.
+					gs.ready = make([]bool, len(gs.Players))
+					gs.startCountdown(gs.Config.ReviewPhase)
+					gs.Status = Reviewing
+				} else {
+					gs.startCountdown(NextGameCountdownTime)
+					gs.Status = Countdown
+				}
+				gs.stateOut <- gs.publishState()
+			} else if gs.roundOver(idx) {
 				for i := range gs.Boards {
-					if i != idx {
+					if !gs.boardOut(i) {
 						gs.Boards[i].shouldQuitSoon()
 					}
 				}
 			}
 		}
 	}
-	gs.Status = PermanentlyOver
-	gs.stateOut <- gs.Marshal()
+	if gs.Status != Finished {
+		gs.Status = PermanentlyOver
+	}
+	if gs.durationCap != nil {
+		gs.durationCap.Stop()
+	}
+	gs.stopScrambles()
+	gs.saveResults()
+	if gs.Config.CommitSeed {
+		gs.RevealedSeed = hex.EncodeToString(gs.randSeed[:])
+	}
+	// Nobody might be listening anymore, e.g. if we're shutting down. Don't
+	// hang around forever waiting for them.
+	var giveUp <-chan time.Time
+	if gs.Config.FinalStateTimeout > 0 {
+		giveUp = gs.clock.After(gs.Config.FinalStateTimeout)
+	}
+	select {
+	case gs.stateOut <- gs.publishState():
+	case <-giveUp:
+		log.Warn().Str("gid", gs.ID).Msg("final-state-not-delivered")
+	}
+	close(gs.done)
 	log.Info().Str("gid", gs.ID).Msg("leaving manager loop")
 
 }
 
+// countRound adds the round that just ended to the series tally. It returns
+// true if that was the series' last round.
+func (gs *GameStateManager) countRound() bool {
+	if gs.Result.Reason == ResultMaintenance {
+		return false
+	}
+	if gs.RoundsWon == nil {
+		gs.RoundsWon = make([]int, len(gs.Boards))
+	}
+	gs.RoundsPlayed++
+	gs.tallyRound()
+	if gs.Result.Winner != NoWinner {
+		gs.RoundsWon[gs.Result.Winner]++
+	} else if gs.Result.Reason == ResultTeamCleared {
+		for i := range gs.RoundsWon {
+			gs.RoundsWon[i]++
+		}
+	}
+	return gs.Config.SeriesMode == ContinuousSeries && gs.Config.MaxRounds > 0 &&
+		gs.RoundsPlayed >= gs.Config.MaxRounds
+}
+
+// SeedCommitment returns the hex SHA-256 of the game's seed.
+func (gs *GameStateManager) SeedCommitment() string {
+	sum := sha256.Sum256(gs.randSeed[:])
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifySeed checks that a revealed seed, in hex, matches a commitment.
+func VerifySeed(commitment, revealed string) bool {
+	seed, err := hex.DecodeString(revealed)
+	if err != nil {
+		return false
+	}
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:]) == commitment
+}
+
+// EndNow ends the game early. Boards stop at their next tick, and the round
+// gets a result with the given reason (see computeResult). It's safe to call
+// from any goroutine, and does nothing if the game is already over.
+func (gs *GameStateManager) EndNow(reason string) {
+	select {
+	case gs.endNow <- reason:
+	default:
+		// Someone else already asked.
+	}
+}
+
+// forceEnd starts ending the game early. It returns true if the game is
+// already over, i.e. we were between rounds and the loop should exit now.
+func (gs *GameStateManager) forceEnd(reason string) bool {
+	if gs.endReason != "" {
+		return false
+	}
+	gs.endReason = reason
+	if gs.Status == Countdown || gs.Status == Reviewing {
+		// Whatever round was last played already has its result.
+		gs.Status = Finished
+		return true
+	}
+	for i := range gs.Boards {
+		gs.Boards[i].shouldQuitSoon()
+	}
+	return false
+}
+
+// durationCapC returns the channel for the game's duration cap, or nil if
+// there isn't one (yet).
+func (gs *GameStateManager) durationCapC() <-chan time.Time {
+	if gs.durationCap == nil {
+		return nil
+	}
+	return gs.durationCap.C()
+}
+
+// Done returns a channel that is closed once the manager loop has exited.
+func (gs *GameStateManager) Done() <-chan struct{} {
+	return gs.done
+}
+
+// Stop tells the manager loop to exit. It returns right away if the loop
+// has already exited.
 func (gs *GameStateManager) Stop() {
-	gs.stop <- struct{}{}
+	select {
+	case gs.stop <- struct{}{}:
+	case <-gs.done:
+	}
+}
+
+// assignColors picks a color theme for each of n players, out of numColors.
+// It's the same for the same seed, and players get distinct colors as long
+// as there are enough to go around.
+func assignColors(seed [32]byte, n, numColors int) []int {
+	colors := make([]int, n)
+	if numColors <= 0 {
+		return colors
+	}
+	perm := rand.New(rand.NewChaCha8(seed)).Perm(numColors)
+	for i := range colors {
+		colors[i] = perm[i%numColors]
+	}
+	return colors
 }
 
 func newGameBoard(idx int, gs *GameStateManager) *GameBoard {
 	gb := &GameBoard{
-		Idx:          idx,
-		fallerPos:    -1,
-		guessEvents:  make(chan string, 5),
-		oppQueueChan: make(chan *Question, 5),
-		manager:      gs,
-		stop:         make(chan struct{}),
-	}
-	gb.OppQueueTimer = time.NewTimer(0)
+		lastGuessAt: gs.clock.Now(),
+		Idx:         idx,
+		Slots:       make([]*Question, gs.numSlots),
+		FallerPos:   -1,
+		guessEvents: make(chan string, 5),
+		attacksIn:   make(chan struct{}, 1),
+		manager:     gs,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	gb.OppQueueTimer = gs.clock.NewTimer(0)
 	// We can't construct a timer in Go without starting it, so start and stop the opp queue timer.
 	if !gb.OppQueueTimer.Stop() {
-		<-gb.OppQueueTimer.C
+		<-gb.OppQueueTimer.C()
 	}
 
 	return gb
@@ -323,13 +1157,43 @@ func newGameBoard(idx int, gs *GameStateManager) *GameBoard {
 
 func (gb *GameBoard) loop() {
 	log.Debug().Int("idx", gb.Idx).Msg("start game board loop")
-	gb.status = PieceDropping
+	var boardCheck Timer
+	var boardCheckC <-chan time.Time
+	if gb.manager.Config.QuestionTimeout > 0 || gb.manager.Config.IdleForfeit > 0 ||
+		gb.manager.Config.RevealPacing > 0 {
+		boardCheck = gb.manager.clock.NewTimer(BoardCheckPeriod)
+		boardCheckC = boardCheck.C()
+	}
 gbloop:
 	for {
+		gb.flushAttacks()
 		select {
-		case <-gb.Timer.C:
-			gb.Tick()
-			gb.manager.stateChange <- struct{}{}
+		case <-boardCheckC:
+			changed := false
+			if gb.manager.Config.QuestionTimeout > 0 {
+				changed = gb.expireQuestions()
+			}
+			if gb.manager.Config.IdleForfeit > 0 {
+				changed = gb.checkIdle() || changed
+			}
+			if gb.manager.Config.RevealPacing > 0 {
+				changed = gb.paceReveals() || changed
+			}
+			if changed {
+				gb.notifyStateChange()
+			}
+			gb.Lock()
+			if gb.Won || gb.Dead {
+				gb.Unlock()
+				break gbloop
+			}
+			gb.Unlock()
+			boardCheck = gb.manager.clock.NewTimer(BoardCheckPeriod)
+			boardCheckC = boardCheck.C()
+
+		case <-gb.Timer.C():
+			gb.StepTick()
+			gb.signalStateChange()
 
 			gb.Lock()
 			if gb.Won || gb.Dead || gb.quitting {
@@ -338,15 +1202,15 @@ gbloop:
 			}
 			gb.Unlock()
 
-		case <-gb.OppQueueTimer.C:
+		case <-gb.OppQueueTimer.C():
 			// Opp queue is now ready to be added to game board. It will
 			// be added as soon as the next piece drops.
 			gb.SetOppQueueReady()
 
 		case evt := <-gb.guessEvents:
-			log.Debug().Int("idx", gb.Idx).Str("event", evt).Msg("event")
-			if gb.handleGuessEvent(evt) {
-				gb.manager.stateChange <- struct{}{}
+			log.Debug().Int("idx", gb.Idx).Str("guess", logging.Guess(evt)).Msg("event")
+			if gb.StepGuess(evt).changesState() {
+				gb.signalStateChange()
 			}
 			gb.Lock()
 			if gb.Won || gb.Dead {
@@ -355,51 +1219,254 @@ gbloop:
 			}
 			gb.Unlock()
 
-		case alph := <-gb.oppQueueChan:
-
-			gb.Lock()
-			startTimer := false
-			if len(gb.OppQueue) == 0 {
-				startTimer = true
-			}
-			gb.OppQueue = append(gb.OppQueue, alph)
-			gb.Unlock()
-
-			gb.manager.stateChange <- struct{}{}
-			if startTimer {
-				gb.OppQueueTimer = time.NewTimer(OppTickDuration)
+		case <-gb.attacksIn:
+			if gb.receiveAttacks() {
+				gb.notifyStateChange()
 			}
 
 		case <-gb.stop:
 			break gbloop
 		}
 	}
+	close(gb.done)
+	// The manager is still around until every board has exited, unless
+	// it was stopped; see reportExit.
+	gb.flushAttacks()
 	gb.OppQueueTimer.Stop()
 	gb.Timer.Stop()
-	gb.manager.boardexited <- gb.Idx
+	if boardCheck != nil {
+		boardCheck.Stop()
+	}
+	gb.reportExit()
 	log.Debug().Int("idx", gb.Idx).Msg("leave game board loop")
 
 }
 
+// deliverAttack leaves an attack for the board to pick up. It never blocks.
+func (gb *GameBoard) deliverAttack(q *Question) {
+	gb.inboxMu.Lock()
+	gb.inbox = append(gb.inbox, q)
+	gb.inboxMu.Unlock()
+	select {
+	case gb.attacksIn <- struct{}{}:
+	default:
+		// The board has been poked already; it'll get them all at once.
+	}
+}
+
+// receiveAttacks puts the attacks in the inbox on the opp queue. It returns
+// true if any of them made it.
+func (gb *GameBoard) receiveAttacks() bool {
+	gb.inboxMu.Lock()
+	inbox := gb.inbox
+	gb.inbox = nil
+	gb.inboxMu.Unlock()
+
+	gb.Lock()
+	defer gb.Unlock()
+	added := false
+	for _, alph := range inbox {
+		if gb.manager.Config.DropDuplicateAttacks && gb.hasAlphagram(alph.OrigQuestion.Alphagram) {
+			// We already have this rack; getting it again would just be a
+			// free solve (or a free death).
+			log.Debug().Int("idx", gb.Idx).Str("alphagram", alph.OrigQuestion.Alphagram).
+				Msg("dropping-duplicate-attack")
+			continue
+		}
+		queueWasEmpty := false
+		if len(gb.OppQueue) == 0 {
+			queueWasEmpty = true
+		}
+		gb.OppQueue = append(gb.OppQueue, alph)
+		if queueWasEmpty {
+			gb.startOppQueueTimer(gb.manager.oppTickDuration(gb.Idx))
+		} else if gb.manager.Config.RisePolicy == RisePerAttack {
+			// Hold off the rise, even if it was ready, so that this
+			// attack gets its warning too.
+			gb.OppQueueTimer.Stop()
+			gb.oppqueueReady = false
+			gb.startOppQueueTimer(gb.manager.oppTickDuration(gb.Idx))
+		}
+		added = true
+	}
+	return added
+}
+
+// flushAttacks sends the attacks that the manager couldn't take right away.
+// The board must not be locked: this waits for the manager, which might be
+// waiting on the board. If the manager loop has exited, they're dropped.
+func (gb *GameBoard) flushAttacks() {
+	gb.Lock()
+	unsent := gb.unsentAttacks
+	gb.unsentAttacks = nil
+	gb.Unlock()
+	for _, q := range unsent {
+		select {
+		case gb.manager.addToOppQueue <- q:
+		case <-gb.manager.done:
+			return
+		}
+	}
+}
+
+// reportExit tells the manager that the board's loop is done. It gives up
+// if the manager loop has exited, e.g. after the game was stopped, or after
+// BoardExitTimeout, so that the board's goroutine never hangs around
+// waiting on a manager that's gone.
+func (gb *GameBoard) reportExit() {
+	var giveUp <-chan time.Time
+	if timeout := gb.manager.Config.BoardExitTimeout; timeout > 0 {
+		giveUp = gb.manager.clock.After(timeout)
+	}
+	select {
+	case gb.manager.boardexited <- gb.Idx:
+	case <-gb.manager.done:
+		log.Debug().Str("gid", gb.manager.ID).Int("idx", gb.Idx).Msg("board-exit-after-manager")
+	case <-giveUp:
+		log.Warn().Str("gid", gb.manager.ID).Int("idx", gb.Idx).Msg("board-exit-not-delivered")
+	}
+}
+
+// StepTick ticks the board once and publishes its new state. It's what the
+// board loop does when its timer fires, minus telling the manager, so tests
+// and tools can drive a board step by step without the loop running.
+func (gb *GameBoard) StepTick() {
+	gb.Tick()
+	gb.publish()
+}
+
+// StepGuess handles a guess on the board right away and publishes the new
+// state if the guess changed it. Like StepTick, it's the loop's code path
+// without the loop. Attacks still go on the manager's queue, unless it's
+// full; then they wait for the loop, which isn't running.
+func (gb *GameBoard) StepGuess(g string) GuessOutcome {
+	outcome := gb.handleGuessEvent(g)
+	if outcome.changesState() {
+		gb.publish()
+	}
+	return outcome
+}
+
 func (gb *GameBoard) shouldQuitSoon() {
 	gb.Lock()
 	gb.quitting = true
 	gb.Unlock()
 }
 
-// topOfStack is the topmost slot idx that is occupied (or, if the board is empty, NumSlots)
-// Do NOT count the current faller.
+// topOfStack is the topmost slot idx that is occupied (or, if the board is empty, the
+// number of slots). Do NOT count the current faller.
 func (gb *GameBoard) topOfStack() int {
-	for i := 0; i < NumSlots; i++ {
-		if gb.Slots[i] != nil && i != gb.fallerPos {
+	for i := range gb.Slots {
+		if gb.Slots[i] != nil && i != gb.FallerPos {
 			return i
 		}
 	}
-	return NumSlots
+	return len(gb.Slots)
+}
+
+// oppTickDuration is how long an attack waits before it rises on the given
+// board. If mercy is on and the board is far enough ahead of everyone else,
+// its attacks rise faster.
+func (gs *GameStateManager) oppTickDuration(idx int) time.Duration {
+	margin := gs.Config.MercyMargin
+	if margin <= 0 {
+		return OppTickDuration
+	}
+	ours := gs.solvedCounts[idx].Load()
+	var best int64
+	for i := range gs.solvedCounts {
+		if i != idx {
+			best = max(best, gs.solvedCounts[i].Load())
+		}
+	}
+	if ours-best >= int64(margin) {
+		return time.Duration(float64(OppTickDuration) * gs.Config.MercyRiseFactor)
+	}
+	return OppTickDuration
+}
+
+// startTimer starts the board's tick timer. The board must be locked.
+func (gb *GameBoard) startTimer(d time.Duration) {
+	gb.Timer = gb.manager.clock.NewTimer(d)
+	gb.nextTickAt = gb.manager.clock.Now().Add(d)
 }
 
+// startTimerAt starts the board's tick timer to fire at the given time.
+// The board must be locked.
+func (gb *GameBoard) startTimerAt(at time.Time) {
+	gb.Timer = gb.manager.clock.NewTimer(at.Sub(gb.manager.clock.Now()))
+	gb.nextTickAt = at
+}
+
+// startOppQueueTimer starts the timer for the opp queue to rise. The board
+// must be locked.
+func (gb *GameBoard) startOppQueueTimer(d time.Duration) {
+	gb.OppQueueTimer = gb.manager.clock.NewTimer(d)
+	gb.oppQueueRiseAt = gb.manager.clock.Now().Add(d)
+}
+
+// NextTickIn returns how long until the board's next tick.
+func (gb *GameBoard) NextTickIn() time.Duration {
+	gb.Lock()
+	defer gb.Unlock()
+	return max(gb.nextTickAt.Sub(gb.manager.clock.Now()), 0)
+}
+
+// OppQueueRisesIn returns how long until the opp queue is ready to rise, or
+// zero if it's already ready or there's nothing in it.
+func (gb *GameBoard) OppQueueRisesIn() time.Duration {
+	gb.Lock()
+	defer gb.Unlock()
+	if len(gb.OppQueue) == 0 {
+		return 0
+	}
+	return max(gb.oppQueueRiseAt.Sub(gb.manager.clock.Now()), 0)
+}
+
+// TickInfo is the timing info for a board, for UI countdowns.
+type TickInfo struct {
+	NextTickMs      int64
+	OppQueueRisesMs int64
+}
+
+// TickInfo returns timing info for each board.
+func (gs *GameStateManager) TickInfo() []TickInfo {
+	boards := gs.boards()
+	info := make([]TickInfo, len(boards))
+	for i, b := range boards {
+		info[i] = TickInfo{
+			NextTickMs:      b.NextTickIn().Milliseconds(),
+			OppQueueRisesMs: b.OppQueueRisesIn().Milliseconds(),
+		}
+	}
+	return info
+}
+
+// hasAlphagram returns whether the alphagram is anywhere on this board: in a
+// slot, our queue, or the opp queue. The board must be locked.
+func (gb *GameBoard) hasAlphagram(alphagram string) bool {
+	for _, q := range gb.Slots {
+		if q != nil && q.OrigQuestion.Alphagram == alphagram {
+			return true
+		}
+	}
+	for _, queue := range [][]*Question{gb.Queue, gb.OppQueue} {
+		for _, q := range queue {
+			if q.OrigQuestion.Alphagram == alphagram {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Quit stops the board loop. It returns right away if the loop has already
+// exited, e.g. between rounds.
 func (gb *GameBoard) Quit() {
-	gb.stop <- struct{}{}
+	select {
+	case gb.stop <- struct{}{}:
+	case <-gb.done:
+	}
 	log.Debug().Str("gid", gb.manager.ID).Int("board-idx", gb.Idx).Msg("gb-quitting")
 }
 
@@ -408,40 +1475,57 @@ func (gb *GameBoard) Tick() {
 	gb.Lock()
 	defer gb.Unlock()
 	var topOfStack int
+	if gb.status == PieceLocking {
+		gb.lockPiece()
+		return
+	}
+	// resting is a faller that rode the stack down (see compactAbove), and
+	// so is already sitting on it.
+	resting := false
 	if gb.status == PieceDropping {
 
 		topOfStack = gb.topOfStack()
 		if topOfStack == 0 {
 			// This player lost - the whole stack is full?
 			log.Debug().Msg("stack-full-losing")
-			gb.Dead = true
-			gb.LastStateChange = StateChange{ChangeType: Lost}
+			if gb.die(DeathStackFull) {
+				gb.setStateChange(StateChange{ChangeType: Lost, PayloadString: string(DeathStackFull)})
+				return
+			}
+			// Wait for the player to make room.
+			gb.startTimer(TickDuration)
 			return
 		}
 
 		// Drop faller down.
-		if gb.fallerPos == -1 {
+		if gb.FallerPos == -1 {
 			gb.LetGoNextPiece()
 		}
-		gb.fallerPos++
+		if gb.FallerPos != -1 && gb.FallerPos == topOfStack-1 {
+			resting = true
+		} else {
+			gb.FallerPos++
+		}
 
 	} else if gb.status == PieceAboutToDrop || gb.status == PlayerQueueEmpty {
 
-		if gb.oppqueueReady {
+		holdRise := len(gb.Queue) == 0 && gb.manager.Config.HoldRisesWhenQueueEmpty
+		if gb.oppqueueReady && !holdRise {
 			if len(gb.OppQueue) == 0 {
 				log.Error().Msg("oppqueue-zero-length-but-ready?")
 			} else {
-				added := gb.addOppQueue()
+				positions := gb.addOppQueue()
 				gb.oppqueueReady = false
 				if gb.Dead {
-					gb.LastStateChange = StateChange{ChangeType: Lost}
+					gb.setStateChange(StateChange{ChangeType: Lost, PayloadString: string(gb.DeathReason)})
 					return
 				}
 				// If we are adding the opp queue contents, we give the player a little breather
 				// before we drop the next piece.
 				// Note that the status remains "PieceAboutToDrop"
-				gb.Timer = time.NewTimer(TickDuration)
-				gb.LastStateChange = StateChange{ChangeType: StackRise, PayloadNum: added}
+				gb.startTimer(TickDuration)
+				gb.setStateChange(StateChange{ChangeType: StackRise, PayloadNum: len(positions),
+					Positions: positions})
 
 				return
 			}
@@ -449,59 +1533,100 @@ func (gb *GameBoard) Tick() {
 		}
 		if len(gb.Queue) == 0 {
 			gb.status = PlayerQueueEmpty
-			gb.Timer = time.NewTimer(TickDuration)
+			gb.startTimer(TickDuration)
 			return
 		} else {
 			topOfStack = gb.topOfStack()
 			if topOfStack == 0 {
 				log.Debug().Msg("abttodrop-stack-full-losing")
-				gb.Dead = true
-				gb.LastStateChange = StateChange{ChangeType: Lost}
+				if gb.die(DeathStackFull) {
+					gb.setStateChange(StateChange{ChangeType: Lost, PayloadString: string(DeathStackFull)})
+					return
+				}
+				gb.startTimer(TickDuration)
 				return
 			}
 			gb.LetGoNextPiece()
-			gb.fallerPos = 0
+			gb.FallerPos = 0
 		}
 	}
 
-	if gb.fallerPos == topOfStack-1 {
+	if gb.FallerPos == topOfStack-1 {
 		// landed naturally.
-		gb.LastStateChange = StateChange{ChangeType: PieceLand, PayloadNum: gb.fallerPos, PayloadNum2: gb.fallerPos - 1}
+		from := gb.FallerPos - 1
+		if resting {
+			from = gb.FallerPos
+		}
+		gb.setStateChange(StateChange{ChangeType: PieceLand, PayloadNum: gb.FallerPos, PayloadNum2: from})
 
-		if gb.fallerPos > 0 {
-			gb.Slots[gb.fallerPos-1], gb.Slots[gb.fallerPos] = gb.Slots[gb.fallerPos], gb.Slots[gb.fallerPos-1]
+		if gb.FallerPos > 0 && !resting {
+			gb.Slots[gb.FallerPos-1], gb.Slots[gb.FallerPos] = gb.Slots[gb.FallerPos], gb.Slots[gb.FallerPos-1]
 		}
 		// Piece landed.
-		// If we are at the very top, give a bit of a more lenient pause to the player.
-		tickDuration := TickDuration / 4
-		if gb.fallerPos == 0 {
-			tickDuration = TickDuration
+		if lockDelay := gb.manager.Config.LockDelay; lockDelay > 0 {
+			// Leave it as the faller for a bit, so it can still be solved
+			// before it's stuck on the stack.
+			gb.status = PieceLocking
+			gb.startTimer(lockDelay)
+			return
 		}
-
-		gb.fallerPos = -1
-		// if piece lands naturally, wait a beat to bring down the next piece.
-		gb.status = PieceAboutToDrop
-		gb.Timer = time.NewTimer(tickDuration)
+		gb.commitLanded()
 		return
-	} else if gb.fallerPos == 0 && topOfStack == 0 {
+	} else if gb.FallerPos == 0 && topOfStack == 0 {
 		// Player lost
 		log.Debug().Msg("no-space-for-faller-losing")
-		gb.Dead = true
-		gb.LastStateChange = StateChange{ChangeType: Lost}
-
+		if gb.die(DeathNoRoomForFaller) {
+			gb.setStateChange(StateChange{ChangeType: Lost, PayloadString: string(DeathNoRoomForFaller)})
+			return
+		}
+		gb.startTimer(TickDuration)
 		return
 	} else {
 		// drop piece down a slot, it's still in the air
-		if gb.fallerPos > 0 {
-			gb.Slots[gb.fallerPos-1], gb.Slots[gb.fallerPos] = gb.Slots[gb.fallerPos], gb.Slots[gb.fallerPos-1]
+		if gb.FallerPos > 0 {
+			gb.Slots[gb.FallerPos-1], gb.Slots[gb.FallerPos] = gb.Slots[gb.FallerPos], gb.Slots[gb.FallerPos-1]
 		}
-		gb.LastStateChange = StateChange{ChangeType: PieceFall, PayloadNum: gb.fallerPos, PayloadNum2: gb.fallerPos - 1}
+		gb.setStateChange(StateChange{ChangeType: PieceFall, PayloadNum: gb.FallerPos, PayloadNum2: gb.FallerPos - 1})
 
 	}
 
 	// start next timer
 	gb.status = PieceDropping
-	gb.Timer = time.NewTimer(TickDuration)
+	gb.startTimer(TickDuration)
+}
+
+// commitLanded makes the faller, which just landed, part of the stack, and
+// gets ready to bring down the next piece. With a lock delay, it's also how
+// the board moves on from a faller that got solved, so that the next piece
+// comes after the same pause either way.
+func (gb *GameBoard) commitLanded() {
+	// If we are at the very top, give a bit of a more lenient pause to the player.
+	tickDuration := TickDuration / 4
+	if gb.FallerPos == 0 {
+		tickDuration = TickDuration
+	}
+	// if piece lands naturally, wait a beat to bring down the next piece.
+	gb.nextPieceAfter(tickDuration)
+}
+
+// nextPieceAfter gets ready to bring down the next piece once the pause is
+// up.
+func (gb *GameBoard) nextPieceAfter(pause time.Duration) {
+	gb.FallerPos = -1
+	gb.status = PieceAboutToDrop
+	gb.startTimer(pause)
+}
+
+// lockPiece is called when a landed piece's lock delay is up. If the stack
+// under it was solved away in the meantime, it starts falling again instead.
+func (gb *GameBoard) lockPiece() {
+	if gb.topOfStack() > gb.FallerPos+1 {
+		gb.status = PieceDropping
+		gb.startTimer(TickDuration)
+		return
+	}
+	gb.setStateChange(StateChange{ChangeType: PieceLocked, PayloadNum: gb.FallerPos})
+	gb.commitLanded()
 }
 
 // LetGoNextPiece lets go the next alphagram, i.e., starts it falling.
@@ -509,6 +1634,7 @@ func (gb *GameBoard) LetGoNextPiece() bool {
 	if len(gb.Queue) > 0 {
 		nextq := gb.Queue[len(gb.Queue)-1]
 		gb.Queue = gb.Queue[:len(gb.Queue)-1]
+		nextq.landedAt = gb.manager.clock.Now()
 		gb.Slots[0] = nextq
 		return true
 	}
@@ -519,29 +1645,47 @@ func (gb *GameBoard) SetOppQueueReady() {
 	gb.oppqueueReady = true
 }
 
-func (gb *GameBoard) addOppQueue() int {
+// addOppQueue raises the whole opp queue onto the board. It returns the slot
+// that each added rack ended up in, in the order they were added, so that
+// the front-end can stagger the rise.
+//
+// The board dies only if the top slot is filled while there are still racks
+// left to raise. An attack that exactly fills the board is survivable.
+func (gb *GameBoard) addOppQueue() []int {
 	added := 0
 	for len(gb.OppQueue) > 0 {
 
 		nextq := gb.OppQueue[0]
 		gb.OppQueue = gb.OppQueue[1:]
+		if nextq.AnswerMap == nil {
+			nextq.populateMap()
+		}
+		nextq.landedAt = gb.manager.clock.Now()
 		// Shift everything up and insert the queued item at the bottom
 		for i := 1; i < len(gb.Slots); i++ {
 			gb.Slots[i], gb.Slots[i-1] = gb.Slots[i-1], gb.Slots[i]
 		}
 		gb.Slots[len(gb.Slots)-1] = nextq
 		// The top slot is filled up, and the opp queue still has words in it. GG.
+		// With NoDeath, the racks that get pushed off the top are just gone.
 		if gb.Slots[0] != nil && len(gb.OppQueue) > 0 {
 			log.Debug().Msg("oppqueue-too-full-losing")
-			gb.Dead = true
+			gb.die(DeathBuried)
 		}
 		added += 1
 	}
-	return added
+	positions := make([]int, added)
+	for i := range positions {
+		positions[i] = len(gb.Slots) - added + i
+	}
+	return positions
 }
 
-// RandomWord only used for debugging/etc
+// RandomWord only used for debugging/etc. It needs the answers, so it only
+// works on a board on the server, not one decoded from the state.
 func (gb *GameBoard) RandomWord(wrongSometimes bool) string {
+	gb.Lock()
+	defer gb.Unlock()
 	left := []string{}
 
 	for slot, question := range gb.Slots {
@@ -569,103 +1713,379 @@ func (gb *GameBoard) RandomWord(wrongSometimes bool) string {
 	return ourguess
 }
 
-func (gb *GameBoard) handleGuessEvent(g string) bool {
+func (gb *GameBoard) handleGuessEvent(g string) GuessOutcome {
 	gb.Lock()
 	defer gb.Unlock()
 	// for loop is fast and fine right?
 	g = strings.ToLower(strings.TrimSpace(g))
 
-	partiallySolved := false
+	outcome := GuessUnrelated
+	defer func() { gb.LastGuessOutcome = outcome }()
+	if len([]rune(g)) < gb.manager.Config.MinWordLength {
+		outcome = GuessTooShort
+		return outcome
+	}
+
 	fullySolvedQuestion := false
-	gotWrong := false
 	fullySolvedSlot := -1
-	madePunishableMistake := false
-	stateChanged := false
 
-	for slot, question := range gb.Slots {
-		if gb.Slots[slot] == nil {
-			continue
+	if slot := gb.pickSolvableSlot(g); slot != -1 {
+		o, fully := solveQuestion(gb.Slots[slot], g)
+		outcome = o
+		if o == GuessSolved {
+			gb.AnswersFound++
 		}
-		partiallySolved, fullySolvedQuestion, gotWrong = solveQuestion(question, g)
-		if fullySolvedQuestion {
+		fullySolvedQuestion = fully
+		if fully {
 			fullySolvedSlot = slot
+		} else {
+			gb.awardRarestFirst(gb.Slots[slot])
+			gb.revealAnswersLeft(gb.Slots[slot])
 		}
-		if partiallySolved {
-			stateChanged = true
-			break
+	}
+
+	if outcome != GuessSolved {
+		// See if the guess was a wrong anagram of something.
+		for slot, question := range gb.Slots {
+			if question == nil {
+				continue
+			}
+			o, _ := solveQuestion(question, g)
+			switch o {
+			case GuessWrongAnagram:
+				if slot == gb.FallerPos {
+					outcome = GuessPenalized
+				} else if outcome == GuessUnrelated {
+					outcome = GuessWrongAnagram
+				}
+			case GuessAlreadySolved:
+				if outcome == GuessUnrelated || outcome == GuessWrongAnagram {
+					outcome = GuessAlreadySolved
+				}
+			}
 		}
-		if gotWrong && slot == gb.fallerPos {
-			stateChanged = true
-			madePunishableMistake = true
+		if outcome == GuessAlreadySolved && !gb.manager.Config.ReportAlreadySolved {
+			outcome = GuessUnrelated
 		}
 	}
-	if !partiallySolved && madePunishableMistake {
+	if outcome != GuessSolved && outcome != GuessPenalized && gb.manager.Config.SolveQueued {
+		if gb.solveQueued(g) {
+			outcome = GuessSolved
+			return outcome
+		}
+	}
+	if outcome == GuessPenalized {
 		// if our guess didn't even partially solve anything, then the user
 		// made a mistake. Drop the current piece and bring up the next one
-		gb.Timer.Stop()
 		topOfStack := gb.topOfStack()
-		if topOfStack == 0 {
-			// This shouldn't happen, because the piece would not have dropped?
-			log.Error().Msg("badcondition-top-of-stack-0")
-			gb.Dead = true
-			gb.LastStateChange = StateChange{ChangeType: Lost}
-			return stateChanged
-		}
-		// Drop item immediately and set short timer for next piece.
-		gb.Slots[gb.fallerPos], gb.Slots[topOfStack-1] = gb.Slots[topOfStack-1], gb.Slots[gb.fallerPos]
-		gb.LastStateChange = StateChange{ChangeType: PieceLand, PayloadNum: topOfStack - 1, PayloadNum2: gb.fallerPos}
-		gb.fallerPos = -1
-		gb.status = PieceAboutToDrop
-		gb.Timer = time.NewTimer(TickDuration / 4)
-		return stateChanged
+		if topOfStack <= gb.FallerPos {
+			// There's nowhere below the faller to drop it to. Racks only rise
+			// while nothing is falling, so the stack can't be over the faller;
+			// if it somehow is, the board isn't really full, and killing the
+			// player for a wrong guess would be wrong. Let the guess go
+			// without a penalty; the normal tick will sort out whether
+			// they've lost.
+			log.Error().Int("top", topOfStack).Int("faller", gb.FallerPos).
+				Msg("badcondition-no-room-below-faller")
+			outcome = GuessWrongAnagram
+			return outcome
+		}
+		gb.Timer.Stop()
+		if gb.status == PieceLocking {
+			// It's already landed. No more grace for it; a wrong guess
+			// mustn't buy it another lock delay.
+			gb.setStateChange(StateChange{ChangeType: PieceLocked, PayloadNum: gb.FallerPos})
+			gb.commitLanded()
+			return outcome
+		}
+		// Drop item immediately. It lands just like a piece that fell
+		// there, lock delay and all.
+		gb.Slots[gb.FallerPos], gb.Slots[topOfStack-1] = gb.Slots[topOfStack-1], gb.Slots[gb.FallerPos]
+		gb.setStateChange(StateChange{ChangeType: PieceForcedDrop, PayloadNum: topOfStack - 1, PayloadNum2: gb.FallerPos})
+		gb.FallerPos = topOfStack - 1
+		if lockDelay := gb.manager.Config.LockDelay; lockDelay > 0 {
+			gb.status = PieceLocking
+			gb.startTimer(lockDelay)
+			return outcome
+		}
+		// Without a lock delay, a dropped piece never gets the lenient
+		// pause, even at the top.
+		gb.nextPieceAfter(TickDuration / 4)
+		return outcome
 	}
 	if fullySolvedQuestion {
 		// The slot X is fully solved. if we solved a question that was meant for us, send it to the opp
-		if gb.Slots[fullySolvedSlot].Whose == gb.Idx {
-			q := gb.Slots[fullySolvedSlot]
-			// Repopulate the answer map for the opponent:
-			q.populateMap()
-			gb.manager.addToOppQueue <- q
+		if gb.manager.mode().OnSolve(gb, gb.Slots[fullySolvedSlot]) {
+			gb.sendAttack(gb.Slots[fullySolvedSlot])
 		}
+		gb.noteSolveTime(gb.Slots[fullySolvedSlot])
+		gb.addSolved(gb.Slots[fullySolvedSlot])
 		gb.Slots[fullySolvedSlot] = nil
-		gb.Solved++
-		gb.LastStateChange = StateChange{ChangeType: FullySolveQuestion, PayloadNum: fullySolvedSlot}
-
-		if gb.fallerPos == fullySolvedSlot {
-			// If we solved the faller just return now. Set short timer for next piece.
-			gb.fallerPos = -1
-			gb.status = PieceAboutToDrop
-			gb.Timer = time.NewTimer(TickDuration / 4)
-			return stateChanged
+		gb.setStateChange(StateChange{ChangeType: FullySolveQuestion, PayloadNum: fullySolvedSlot})
+
+		if gb.FallerPos == fullySolvedSlot {
+			// If we solved the faller, falling or landed, just return now.
+			// Whatever it was waiting on is off.
+			gb.Timer.Stop()
+			if gb.manager.Config.LockDelay > 0 {
+				gb.commitLanded()
+			} else {
+				gb.nextPieceAfter(TickDuration / 4)
+			}
+			return outcome
 		}
 		// Otherwise, shift some items downwards
+		gb.compactAbove(fullySolvedSlot)
 
-		// Start at any items directly on top of item we just solved.
-		lastSlot := fullySolvedSlot - 1
-		for lastSlot > 0 && gb.Slots[lastSlot] != nil && lastSlot != gb.fallerPos {
-			gb.Slots[lastSlot], gb.Slots[lastSlot+1] = gb.Slots[lastSlot+1], gb.Slots[lastSlot]
-			lastSlot--
+		gb.checkWon()
+	}
+	return outcome
+}
+
+// solveQueued tries the guess against the questions in the queue, starting
+// with the next one to drop. It returns true if it solved an answer.
+func (gb *GameBoard) solveQueued(g string) bool {
+	for i := len(gb.Queue) - 1; i >= 0; i-- {
+		q := gb.Queue[i]
+		o, fully := solveQuestion(q, g)
+		if o != GuessSolved {
+			continue
+		}
+		gb.AnswersFound++
+		if fully {
+			if gb.manager.mode().OnSolve(gb, q) {
+				gb.sendAttack(q)
+			}
+			gb.Queue = append(gb.Queue[:i], gb.Queue[i+1:]...)
+			gb.addSolved(q)
+			gb.setStateChange(StateChange{ChangeType: FullySolveQueuedQuestion, PayloadNum: i})
+			gb.checkWon()
+		} else {
+			gb.awardRarestFirst(q)
+			gb.revealAnswersLeft(q)
 		}
+		return true
+	}
+	return false
+}
 
-		// Check if everything is fully solved.
-		if len(gb.Queue) == 0 {
-			// Purposefully not checking if the opp queue is empty.
-			weWon := true
-			for i := range gb.Slots {
-				if gb.Slots[i] != nil {
-					weWon = false
-				}
+// revealAnswersLeft updates how many answers the question shows as left,
+// after one of them got solved. With reveal pacing on, it only goes down by
+// one per RevealPacing; paceReveals catches it up later.
+func (gb *GameBoard) revealAnswersLeft(q *Question) {
+	pacing := gb.manager.Config.RevealPacing
+	if pacing <= 0 {
+		q.AnswersLeft = q.answersLeft()
+		return
+	}
+	now := gb.manager.clock.Now()
+	if q.AnswersLeft > q.answersLeft() && now.Sub(q.revealedAt) >= pacing {
+		q.AnswersLeft--
+		q.revealedAt = now
+	}
+}
+
+// paceReveals brings each question's shown answer count one step closer to
+// the real one, if it's been long enough. It returns true if any changed.
+func (gb *GameBoard) paceReveals() bool {
+	gb.Lock()
+	defer gb.Unlock()
+	changed := false
+	for slot, q := range gb.Slots {
+		if q == nil {
+			continue
+		}
+		before := q.AnswersLeft
+		gb.revealAnswersLeft(q)
+		if q.AnswersLeft != before {
+			gb.setStateChange(StateChange{ChangeType: AnswersRevealed, PayloadNum: slot})
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sendAttack sends a fully solved question over to the opponent. The mode
+// has already decided that it goes; see Mode.OnSolve.
+func (gb *GameBoard) sendAttack(q *Question) {
+	// The opponent gets a question of their own, so that nothing we do
+	// with ours afterwards can touch theirs. A counterattack is ours now;
+	// it's routed away from whoever's it is.
+	q = &Question{
+		OrigQuestion: q.OrigQuestion,
+		Whose:        gb.Idx,
+		AnswersTotal: q.AnswersTotal,
+		Rarity:       q.Rarity,
+	}
+	// Give it its answers back, unless they should stay hidden until the
+	// rack actually rises onto their board.
+	if !gb.manager.Config.RedactQueuedAttacks {
+		q.populateMap()
+	}
+	if len(gb.unsentAttacks) == 0 {
+		select {
+		case gb.manager.addToOppQueue <- q:
+			return
+		default:
+		}
+	}
+	// The manager is busy, and the board is locked, so don't wait for it;
+	// the board loop sends the attack on. Anything after it queues up
+	// behind it, to keep them in order.
+	gb.unsentAttacks = append(gb.unsentAttacks, q)
+}
+
+// noteSolveTime keeps track of the board's fastest solve, from when the
+// question landed.
+func (gb *GameBoard) noteSolveTime(q *Question) {
+	if q.landedAt.IsZero() {
+		return
+	}
+	took := gb.manager.clock.Now().Sub(q.landedAt)
+	if gb.fastestSolve == 0 || took < gb.fastestSolve {
+		gb.fastestSolve = took
+	}
+}
+
+// addSolved counts the fully solved question.
+func (gb *GameBoard) addSolved(q *Question) {
+	gb.Solved++
+	if q.Whose != gb.Idx {
+		gb.AttacksCleared++
+	}
+	gb.manager.solvedCounts[gb.Idx].Store(int64(gb.Solved))
+}
+
+// checkWon marks the board as won if the mode says it is, e.g. once
+// everything is cleared off of it.
+func (gb *GameBoard) checkWon() {
+	if gb.manager.mode().CheckWin(gb) {
+		gb.Won = true
+	}
+}
+
+// compactAbove shifts the items directly on top of an emptied slot down
+// into it, all the way up to the top of the stack.
+//
+// The faller isn't part of the stack. By default it stays where it is, even
+// if that leaves a gap under it; it keeps falling at its usual pace and lands
+// on the new top of the stack. With FallerRidesStack, a faller sitting right
+// on top of the stack moves down along with it instead, so it stays just
+// about to land.
+func (gb *GameBoard) compactAbove(slot int) {
+	// Start at any items directly on top of the emptied slot.
+	lastSlot := slot - 1
+	for lastSlot >= 0 && gb.Slots[lastSlot] != nil {
+		if lastSlot == gb.FallerPos {
+			if !gb.manager.Config.FallerRidesStack {
+				break
 			}
-			if weWon {
-				gb.Won = true
+			gb.FallerPos++
+		}
+		gb.Slots[lastSlot], gb.Slots[lastSlot+1] = gb.Slots[lastSlot+1], gb.Slots[lastSlot]
+		lastSlot--
+	}
+}
+
+// expireQuestions clears any landed question that has gone unsolved for
+// longer than the question timeout, without credit. It returns whether
+// anything changed.
+func (gb *GameBoard) expireQuestions() bool {
+	gb.Lock()
+	defer gb.Unlock()
+	if gb.Dead || gb.Won {
+		return false
+	}
+	timeout := gb.manager.Config.QuestionTimeout
+	now := gb.manager.clock.Now()
+	changed := false
+	// Go from the bottom up, so that compacting doesn't move a question
+	// we haven't looked at yet.
+	for slot := len(gb.Slots) - 1; slot >= 0; slot-- {
+		q := gb.Slots[slot]
+		if q == nil || slot == gb.FallerPos || now.Sub(q.landedAt) < timeout {
+			continue
+		}
+		sc := StateChange{ChangeType: QuestionTimedOut, PayloadNum: slot}
+		if gb.manager.Config.RevealOnTimeout {
+			left := make([]string, 0, len(q.AnswerMap))
+			for answer := range q.AnswerMap {
+				left = append(left, answer)
 			}
+			sort.Strings(left)
+			sc.PayloadString = strings.Join(left, ",")
+		}
+		gb.Slots[slot] = nil
+		gb.compactAbove(slot)
+		gb.setStateChange(sc)
+		changed = true
+		// Anything that was compacted into this slot gets looked at again.
+		slot++
+	}
+	if changed {
+		gb.checkWon()
+	}
+	return changed
+}
+
+// Guess queues up a guess for this board. If the game has a minimum guess
+// interval, guesses that come in too quickly are rejected with ErrGuessTooFast.
+// Once the board loop has exited, e.g. because the board won or died, or
+// the round is over, guesses are rejected with ErrBoardOut.
+func (gb *GameBoard) Guess(guess string) error {
+	select {
+	case <-gb.done:
+		return ErrBoardOut
+	default:
+	}
+	now := gb.manager.clock.Now()
+	gb.Lock()
+	if interval := gb.manager.Config.MinGuessInterval; interval > 0 {
+		if !gb.lastAcceptedAt.IsZero() && now.Sub(gb.lastAcceptedAt) < interval {
+			gb.Unlock()
+			return ErrGuessTooFast
 		}
 	}
-	return stateChanged
+	gb.lastAcceptedAt = now
+	gb.lastGuessAt = now
+	gb.idleWarned = false
+	gb.Unlock()
+	select {
+	case gb.guessEvents <- guess:
+	case <-gb.done:
+		return ErrBoardOut
+	}
+	gb.manager.recordGuess(gb.Idx, guess)
+	return nil
 }
 
-func (gb *GameBoard) Guess(guess string) {
-	gb.guessEvents <- guess
+// checkIdle forfeits the board if the player hasn't guessed in a long time.
+// Halfway there, they get a warning, since they might just be thinking.
+// It returns whether anything changed.
+func (gb *GameBoard) checkIdle() bool {
+	gb.Lock()
+	defer gb.Unlock()
+	if gb.Dead || gb.Won {
+		return false
+	}
+	forfeitAfter := gb.manager.Config.IdleForfeit
+	idle := gb.manager.clock.Now().Sub(gb.lastGuessAt)
+	if idle >= forfeitAfter {
+		log.Debug().Int("idx", gb.Idx).Dur("idle", idle).Msg("idle-forfeit")
+		if gb.die(DeathIdle) {
+			gb.setStateChange(StateChange{ChangeType: Lost, PayloadString: string(DeathIdle)})
+			return true
+		}
+		gb.lastGuessAt = gb.manager.clock.Now()
+		return false
+	}
+	if idle >= forfeitAfter/2 && !gb.idleWarned {
+		gb.idleWarned = true
+		gb.setStateChange(StateChange{ChangeType: IdleWarning,
+			PayloadNum: int((forfeitAfter - idle).Seconds())})
+		return true
+	}
+	return false
 }
 
 func (gb *GameBoard) Printable() []string {
@@ -681,8 +2101,10 @@ func (gb *GameBoard) Printable() []string {
 			if s.Whose == 1 {
 				// color = "\x1b[0;36m" // cyan
 			}
-			// strarr = append(strarr, fmt.Sprintf("%0s %d %-20s %0s", color, s.answersLeft(), s.OrigQuestion.Alphagram, reset))
-			strarr = append(strarr, fmt.Sprintf("| %d %s [p%d]", s.answersLeft(), s.OrigQuestion.Alphagram, s.Whose))
+			// strarr = append(strarr, fmt.Sprintf("%0s %d %-20s %0s", color, s.AnswersLeft, s.OrigQuestion.Alphagram, reset))
+			// The answers themselves don't go out with the state; see
+			// questionJSON. The count does.
+			strarr = append(strarr, fmt.Sprintf("| %d %s [p%d]", s.AnswersLeft, s.OrigQuestion.Alphagram, s.Whose))
 		} else {
 			strarr = append(strarr, "|                 |")
 		}
@@ -696,24 +2118,61 @@ func (gb *GameBoard) Printable() []string {
 	return strarr
 }
 
-func solveQuestion(q *Question, guess string) (bool, bool, bool) {
-	fullySolved := false
-	partiallySolved := false
-	wrong := false
+// pickSolvableSlot returns the slot whose question the guess should solve,
+// or -1 if it doesn't answer any of them. When more than one slot has the
+// guess as an answer (e.g. the same alphagram got dealt twice), the game's
+// SolveTieBreak decides which one gets it, and so which one can go on to
+// become an attack.
+func (gb *GameBoard) pickSolvableSlot(guess string) int {
+	candidates := []int{}
+	for slot, q := range gb.Slots {
+		if q == nil {
+			continue
+		}
+		if _, ok := q.AnswerMap[guess]; ok {
+			candidates = append(candidates, slot)
+		}
+	}
+	switch len(candidates) {
+	case 0:
+		return -1
+	case 1:
+		return candidates[0]
+	}
+	switch gb.manager.Config.SolveTieBreak {
+	case TieBreakBottom:
+		return candidates[len(candidates)-1]
+	case TieBreakSeeded:
+		h := fnv.New64a()
+		h.Write(gb.manager.randSeed[:])
+		fmt.Fprintf(h, "%d:%s", gb.Idx, guess)
+		return candidates[h.Sum64()%uint64(len(candidates))]
+	default:
+		return candidates[0]
+	}
+}
+
+// solveQuestion applies the guess to a single question. It returns
+// GuessSolved if the guess was one of the answers (and whether that was the
+// last answer), GuessAlreadySolved if it was one that's been solved already,
+// GuessWrongAnagram if it has the right letters but isn't an answer, and
+// GuessUnrelated otherwise.
+func solveQuestion(q *Question, guess string) (GuessOutcome, bool) {
 	if _, ok := q.AnswerMap[guess]; ok {
 		delete(q.AnswerMap, guess)
-		partiallySolved = true
-	} else {
-		if alphagrammize(guess) == strings.ToLower(q.OrigQuestion.Alphagram) {
-			// Wrong guess
-			wrong = true
+		if q.solved == nil {
+			q.solved = map[string]bool{}
 		}
+		q.solved[guess] = true
+		return GuessSolved, len(q.AnswerMap) == 0
 	}
-
-	if partiallySolved && len(q.AnswerMap) == 0 {
-		fullySolved = true
+	if q.solved[guess] {
+		return GuessAlreadySolved, false
 	}
-	return partiallySolved, fullySolved, wrong
+	if alphagrammize(guess) == strings.ToLower(q.OrigQuestion.Alphagram) {
+		return GuessWrongAnagram, false
+	}
+	return GuessUnrelated, false
 }
 
 func (gs *GameStateManager) Printable() string {
@@ -724,14 +2183,133 @@ func (gs *GameStateManager) Printable() string {
 	builder.WriteString(fmt.Sprintf("GameID: %s\n", gs.ID))
 	builder.WriteString(fmt.Sprintf("Question Offset %d\n", gs.QuestionOffset))
 
-	b0 := gs.Boards[0].Printable()
-	b1 := gs.Boards[1].Printable()
-	for i := 0; i < len(b0); i++ {
-		builder.WriteString(fmt.Sprintf("              %-40s          %-45s\n", b0[i], b1[i]))
+	// Lay the boards out side by side, however many there are.
+	columns := make([][]string, len(gs.Boards))
+	rows := 0
+	for i, b := range gs.Boards {
+		if b == nil {
+			columns[i] = []string{"(No board)"}
+		} else {
+			columns[i] = b.Printable()
+		}
+		rows = max(rows, len(columns[i]))
+	}
+	for r := 0; r < rows; r++ {
+		builder.WriteString("              ")
+		for i, col := range columns {
+			line := ""
+			if r < len(col) {
+				line = col[r]
+			}
+			if i == len(columns)-1 {
+				builder.WriteString(strings.TrimRight(line, " "))
+			} else {
+				builder.WriteString(fmt.Sprintf("%-40s          ", line))
+			}
+		}
+		builder.WriteString("\n")
 	}
 	return builder.String()
 }
 
+// boardJSON lets a board be marshaled with the default encoding, without
+// going through GameBoard.MarshalJSON.
+type boardJSON GameBoard
+
+// publishedBoard is a board as it's sent out. Status is only there with
+// GameConfig.ShowBoardStatus.
+type publishedBoard struct {
+	*boardJSON
+	Status *BoardStatus `json:",omitempty"`
+}
+
+// Status returns what the board is doing: dropping a piece, about to drop
+// the next one, and so on.
+func (gb *GameBoard) Status() BoardStatus {
+	gb.Lock()
+	defer gb.Unlock()
+	return gb.status
+}
+
+// publish marshals the board under its own lock and stores the result as
+// the board's snapshot. It must be called after every state change that
+// should reach the players. Every change to a board (a tick, with any racks
+// rising; a guess; an attack arriving) happens under the lock in one go, so
+// a snapshot never catches one halfway through.
+func (gb *GameBoard) publish() {
+	gb.Lock()
+	pb := publishedBoard{boardJSON: (*boardJSON)(gb)}
+	if gb.manager.Config.ShowBoardStatus {
+		// Taken under the same lock as the rest, so it always goes with
+		// FallerPos.
+		status := gb.status
+		pb.Status = &status
+	}
+	bts, err := json.Marshal(pb)
+	gb.Unlock()
+	if err != nil {
+		panic(err)
+	}
+	gb.snapshot.Store(&bts)
+}
+
+// notifyStateChange publishes the board's state and tells the manager
+// about it.
+func (gb *GameBoard) notifyStateChange() {
+	gb.publish()
+	gb.signalStateChange()
+}
+
+// signalStateChange tells the manager that the board's state changed, if
+// the manager loop is still there to hear it.
+func (gb *GameBoard) signalStateChange() {
+	select {
+	case gb.manager.stateChange <- struct{}{}:
+	case <-gb.manager.done:
+	}
+}
+
+// MarshalJSON returns the board's last published snapshot. Boards don't
+// need to be locked to be marshaled, so one busy board never holds up the
+// others.
+func (gb *GameBoard) MarshalJSON() ([]byte, error) {
+	if bts := gb.snapshot.Load(); bts != nil {
+		return *bts, nil
+	}
+	return []byte("null"), nil
+}
+
+// CurrentState returns the game as the manager loop last sent it out. It's
+// safe to call from anywhere: the loop is the only one that marshals the
+// manager itself, so the state is never caught halfway through a change.
+func (gs *GameStateManager) CurrentState() []byte {
+	if bts := gs.snapshot.Load(); bts != nil {
+		return *bts
+	}
+	return []byte("null")
+}
+
+// publishState marshals the game and keeps it for CurrentState. Only the
+// manager loop calls it, or whoever has the manager before the loop starts.
+func (gs *GameStateManager) publishState() []byte {
+	bts := gs.Marshal()
+	gs.snapshot.Store(&bts)
+	gs.sentStatus.Store(int64(gs.Status))
+	return bts
+}
+
+// boards returns the boards of the current round, for use outside the
+// manager loop.
+func (gs *GameStateManager) boards() []*GameBoard {
+	gs.boardsMu.RLock()
+	defer gs.boardsMu.RUnlock()
+	return gs.Boards
+}
+
+// Marshal marshals the game from each board's last published snapshot.
+// Every board's state is self-consistent, without locking all the boards at
+// once. The manager's own fields aren't locked, so it's only for the manager
+// loop; use CurrentState anywhere else.
 func (gs *GameStateManager) Marshal() []byte {
 	bts, err := json.Marshal(gs)
 	if err != nil {
@@ -0,0 +1,2638 @@
+package game
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+	"google.golang.org/protobuf/proto"
+)
+
+func testSeed() [32]byte {
+	var seed [32]byte
+	for i := range seed {
+		seed[i] = byte(0xa0 + i)
+	}
+	return seed
+}
+
+var testEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testAlphagrams makes n questions' worth of alphagrams, each with one
+// answer: the alphagram backwards, in lower case.
+func testAlphagrams(n int) ([]*wordsearcher.Alphagram, []string) {
+	var alphs []*wordsearcher.Alphagram
+	var answers []string
+	for i := range n {
+		alphagram := fmt.Sprintf("AB%c%c", 'C'+i/20, 'E'+i%20)
+		answer := []rune(strings.ToLower(alphagram))
+		slices.Reverse(answer)
+		alphs = append(alphs, &wordsearcher.Alphagram{
+			Alphagram: alphagram,
+			Words:     []*wordsearcher.Word{{Word: string(answer)}},
+		})
+		answers = append(answers, string(answer))
+	}
+	return alphs, answers
+}
+
+// fakeSearcher answers every search with the same alphagrams.
+type fakeSearcher struct {
+	alphs []*wordsearcher.Alphagram
+}
+
+func (f fakeSearcher) Search(context.Context, *wordsearcher.SearchRequest) (*wordsearcher.SearchResponse, error) {
+	resp := &wordsearcher.SearchResponse{}
+	for _, a := range f.alphs {
+		// Games change the questions they're dealt; give each its own.
+		resp.Alphagrams = append(resp.Alphagrams, proto.Clone(a).(*wordsearcher.Alphagram))
+	}
+	return resp, nil
+}
+
+func (f fakeSearcher) Expand(_ context.Context, r *wordsearcher.SearchResponse) (*wordsearcher.SearchResponse, error) {
+	return r, nil
+}
+
+// fakeWordDB serves the alphagrams as a word DB server, and returns its
+// address.
+func fakeWordDB(t testing.TB, alphs []*wordsearcher.Alphagram) string {
+	srv := httptest.NewServer(wordsearcher.NewQuestionSearcherServer(fakeSearcher{alphs}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// runClock moves the clock along, a tenth of a second at a time, until
+// stop is closed.
+func runClock(clock *ManualClock, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		clock.Advance(100 * time.Millisecond)
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+func TestManualClockFiresInOrder(t *testing.T) {
+	clock := NewManualClock(testEpoch)
+	late := clock.NewTimer(3 * time.Second)
+	early := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(2 * time.Second)
+	if !stopped.Stop() {
+		t.Error("Stop on a pending timer returned false")
+	}
+
+	clock.Advance(1500 * time.Millisecond)
+	select {
+	case at := <-early.C():
+		if !at.Equal(testEpoch.Add(time.Second)) {
+			t.Errorf("early fired at %v", at)
+		}
+	default:
+		t.Fatal("early didn't fire")
+	}
+	select {
+	case <-late.C():
+		t.Fatal("late fired too soon")
+	default:
+	}
+	clock.Advance(10 * time.Second)
+	<-late.C()
+	select {
+	case <-stopped.C():
+		t.Error("a stopped timer fired")
+	default:
+	}
+	if got := clock.Now(); !got.Equal(testEpoch.Add(11500 * time.Millisecond)) {
+		t.Errorf("Now = %v", got)
+	}
+}
+
+func TestFullGameOnManualClock(t *testing.T) {
+	// Only enough questions for one round; nobody guesses, so the stacks
+	// fill up, and the next round can't start.
+	alphs, _ := testAlphagrams(TotalNumQuestions)
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", stateOut, testSeed(), nil)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	var state struct {
+		Status Status
+		Boards []struct{ Dead bool }
+	}
+	played := false
+	timeout := time.After(20 * time.Second)
+	for state.Status != PermanentlyOver {
+		select {
+		case bts := <-stateOut:
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			played = played || state.Status == Playing
+		case <-timeout:
+			t.Fatal("game never ended")
+		}
+	}
+	if !played {
+		t.Fatal("the round never started")
+	}
+	if !state.Boards[0].Dead && !state.Boards[1].Dead {
+		t.Error("the round ended with nobody dead")
+	}
+	if gs.QuestionOffset != TotalNumQuestions {
+		t.Errorf("QuestionOffset = %d, want %d", gs.QuestionOffset, TotalNumQuestions)
+	}
+}
+
+func TestMinGuessInterval(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.MinGuessInterval = time.Second
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gb := newGameBoard(0, gs)
+
+	// A burst: only the first one gets through.
+	if err := gb.Guess("one"); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []string{"two", "three"} {
+		if err := gb.Guess(g); err != ErrGuessTooFast {
+			t.Errorf("Guess(%q) = %v, want %v", g, err, ErrGuessTooFast)
+		}
+	}
+	clock.Advance(999 * time.Millisecond)
+	if err := gb.Guess("four"); err != ErrGuessTooFast {
+		t.Errorf("a guess just short of the interval got %v", err)
+	}
+
+	// Paced guesses all get through. Rejected ones don't hold them up.
+	for _, g := range []string{"five", "six", "seven"} {
+		clock.Advance(time.Second)
+		if err := gb.Guess(g); err != nil {
+			t.Errorf("Guess(%q) = %v", g, err)
+		}
+	}
+	var queued []string
+	for len(gb.guessEvents) > 0 {
+		queued = append(queued, <-gb.guessEvents)
+	}
+	if want := []string{"one", "five", "six", "seven"}; !slices.Equal(queued, want) {
+		t.Errorf("queued %v, want %v", queued, want)
+	}
+}
+
+func TestTooFewQuestionsEndsGame(t *testing.T) {
+	// The list got smaller since the seek, say.
+	alphs, _ := testAlphagrams(TotalNumQuestions - 1)
+	stateOut := make(chan []byte, 1)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", stateOut, testSeed(), nil)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	var state struct {
+		Status Status
+		Error  string
+	}
+	select {
+	case bts := <-stateOut:
+		if err := json.Unmarshal(bts, &state); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("no state came out")
+	}
+	if state.Status != PermanentlyOver || !strings.HasPrefix(state.Error, ErrTooFewQuestions.Error()) {
+		t.Errorf("got status %v and error %q, want the game over with %q", state.Status, state.Error, ErrTooFewQuestions)
+	}
+	if err := gs.TryDestroy(); err != nil {
+		t.Errorf("TryDestroy on a game that never started: %v", err)
+	}
+}
+
+func TestGuessOnlyTouchesOwnBoard(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b", "c"}, "", "gid", nil, testSeed(), nil)
+	gs.SetClock(NewManualClock(testEpoch))
+	gs.solvedCounts = make([]atomic.Int64, len(gs.Players))
+	alphs, answers := testAlphagrams(1)
+	for i := range gs.Players {
+		gb := newGameBoard(i, gs)
+		// Everyone's dealt the same question, like racing a ghost.
+		q := &Question{OrigQuestion: alphs[0], Whose: i}
+		q.populateMap()
+		gb.Slots[NumSlots-1] = q
+		gb.Queue = append(gb.Queue, &Question{OrigQuestion: alphs[0], Whose: i})
+		gb.publish()
+		gs.Boards = append(gs.Boards, gb)
+	}
+	before := make([][]byte, len(gs.Boards))
+	for i, gb := range gs.Boards {
+		before[i], _ = gb.MarshalJSON()
+	}
+
+	if err := gs.Guess("a", answers[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs.Guess("nobody", answers[0]); !errors.Is(err, ErrNotAPlayer) {
+		t.Errorf("a guess from someone not playing got %v", err)
+	}
+	a := gs.Boards[0]
+	if len(a.guessEvents) != 1 {
+		t.Fatalf("a's board got %d guesses, want 1", len(a.guessEvents))
+	}
+	if outcome := a.handleGuessEvent(<-a.guessEvents); outcome != GuessSolved {
+		t.Fatalf("a's guess got %v", outcome)
+	}
+	a.publish()
+	if a.Solved != 1 || a.Slots[NumSlots-1] != nil {
+		t.Error("a's guess didn't solve a's rack")
+	}
+	for _, gb := range gs.Boards[1:] {
+		gb.publish()
+		after, _ := gb.MarshalJSON()
+		if len(gb.guessEvents) != 0 || !reflect.DeepEqual(after, before[gb.Idx]) {
+			t.Errorf("a's guess changed board %d", gb.Idx)
+		}
+		if q := gb.Slots[NumSlots-1]; q == nil || q.answersLeft() != 1 {
+			t.Errorf("a's guess solved board %d's rack", gb.Idx)
+		}
+	}
+
+	// If the boards were ever out of order, a guess goes nowhere rather
+	// than to someone else's board.
+	gs.Boards[1], gs.Boards[2] = gs.Boards[2], gs.Boards[1]
+	if err := gs.Guess("b", answers[0]); !errors.Is(err, ErrBadPlayerOrder) {
+		t.Errorf("a guess with the boards out of order got %v", err)
+	}
+	for _, gb := range gs.Boards[1:] {
+		if len(gb.guessEvents) != 0 {
+			t.Errorf("board %d got a guess", gb.Idx)
+		}
+	}
+}
+
+func TestTryDestroyDuringCountdown(t *testing.T) {
+	stateOut := make(chan []byte, 1)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, "", "gid", stateOut, testSeed(), nil)
+	gs.SetClock(NewManualClock(testEpoch))
+	gs.StartGameCountdown()
+
+	destroyed := make(chan error, 1)
+	go func() { destroyed <- gs.TryDestroy() }()
+	select {
+	case err := <-destroyed:
+		if err != nil {
+			t.Fatalf("TryDestroy during the countdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("TryDestroy hung")
+	}
+	select {
+	case <-gs.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("manager loop didn't exit")
+	}
+	// Stopping it again is harmless.
+	gs.Stop()
+}
+
+func TestGuessOnAFinishedBoard(t *testing.T) {
+	gb, clock := testBoard(2)
+	gb.Timer = clock.NewTimer(time.Hour)
+	go gb.loop()
+	gb.Quit()
+	<-gb.manager.boardexited
+
+	// More guesses than the board's buffer holds.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 2 * cap(gb.guessEvents) {
+			if err := gb.Guess("anything"); !errors.Is(err, ErrBoardOut) {
+				t.Errorf("guess on a finished board: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("guessing on a finished board hung")
+	}
+}
+
+func TestTryDestroyBetweenRounds(t *testing.T) {
+	for _, review := range []bool{false, true} {
+		alphs, _ := testAlphagrams(3 * TotalNumQuestions)
+		cfg := DefaultGameConfig()
+		want := Countdown
+		if review {
+			cfg.ReviewPhase = time.Hour
+			want = Reviewing
+		}
+		stateOut := make(chan []byte)
+		gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid",
+			stateOut, testSeed(), cfg)
+		clock := NewManualClock(testEpoch)
+		gs.SetClock(clock)
+		gs.StartGameCountdown()
+		stop := make(chan struct{})
+		go runClock(clock, stop)
+
+		// Nobody guesses, so the first round ends with both boards dead, and
+		// their loops gone.
+		played := false
+		timeout := time.After(20 * time.Second)
+	wait:
+		for {
+			select {
+			case bts := <-stateOut:
+				var state struct{ Status Status }
+				if err := json.Unmarshal(bts, &state); err != nil {
+					t.Fatal(err)
+				}
+				if state.Status == Playing {
+					played = true
+				} else if played && state.Status == want {
+					break wait
+				}
+			case <-timeout:
+				t.Fatalf("review %v: the first round never ended", review)
+			}
+		}
+		// Hold the next round off.
+		close(stop)
+		go func() {
+			for {
+				select {
+				case <-stateOut:
+				case <-gs.Done():
+					return
+				}
+			}
+		}()
+
+		destroyed := make(chan error, 1)
+		go func() { destroyed <- gs.TryDestroy() }()
+		select {
+		case err := <-destroyed:
+			if err != nil {
+				t.Errorf("review %v: TryDestroy between rounds: %v", review, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("review %v: TryDestroy hung", review)
+		}
+		select {
+		case <-gs.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("review %v: manager loop didn't exit", review)
+		}
+	}
+}
+
+func TestFinalStateTimeout(t *testing.T) {
+	alphs, _ := testAlphagrams(TotalNumQuestions - 1)
+	// Nobody ever reads the states.
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid",
+		make(chan []byte), testSeed(), nil)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	select {
+	case <-gs.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the manager loop is stuck on its final state")
+	}
+}
+
+// testBoard makes a standalone board, off a manual clock, with n questions
+// waiting in its queue. Nothing runs until the test calls Tick.
+func testBoard(n int) (*GameBoard, *ManualClock) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.addToOppQueue = make(chan *Question, TotalNumQuestions)
+	gs.solvedCounts = make([]atomic.Int64, len(gs.Players))
+	gb := newGameBoard(0, gs)
+	alphs, _ := testAlphagrams(n)
+	for _, alph := range alphs {
+		q := &Question{OrigQuestion: alph}
+		q.populateMap()
+		gb.Queue = append(gb.Queue, q)
+	}
+	gb.status = PieceDropping
+	return gb, clock
+}
+
+func TestPublishedBoardStatus(t *testing.T) {
+	gb, _ := testBoard(1)
+	gb.manager.Config.ShowBoardStatus = true
+	check := func(when string) {
+		t.Helper()
+		gb.publish()
+		bts, _ := gb.MarshalJSON()
+		var pub struct {
+			Status    *BoardStatus
+			FallerPos int
+		}
+		if err := json.Unmarshal(bts, &pub); err != nil {
+			t.Fatal(err)
+		}
+		if pub.Status == nil || *pub.Status != gb.Status() {
+			t.Errorf("%s: published status %v, want %v", when, pub.Status, gb.Status())
+		}
+		if pub.FallerPos != gb.FallerPos {
+			t.Errorf("%s: published faller at %d, want %d", when, pub.FallerPos, gb.FallerPos)
+		}
+	}
+
+	check("before the first tick")
+	gb.Tick()
+	if gb.Status() != PieceDropping {
+		t.Fatalf("status %v after the first tick", gb.Status())
+	}
+	check("while dropping")
+	for gb.Status() == PieceDropping {
+		gb.Tick()
+	}
+	if gb.Status() != PieceAboutToDrop {
+		t.Fatalf("status %v after landing", gb.Status())
+	}
+	check("after landing")
+	gb.Tick()
+	if gb.Status() != PlayerQueueEmpty {
+		t.Fatalf("status %v with the queue empty", gb.Status())
+	}
+	check("with the queue empty")
+
+	gb.manager.Config.ShowBoardStatus = false
+	gb.publish()
+	bts, _ := gb.MarshalJSON()
+	if strings.Contains(string(bts), `"Status"`) {
+		t.Errorf("status published with ShowBoardStatus off: %s", bts)
+	}
+}
+
+func TestBoardSizes(t *testing.T) {
+	for _, n := range []int{10, 24} {
+		cfg := DefaultGameConfig()
+		cfg.NumSlots = n
+		gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+		gs.SetClock(NewManualClock(testEpoch))
+		gs.solvedCounts = make([]atomic.Int64, len(gs.Players))
+		gb := newGameBoard(0, gs)
+		if len(gb.Slots) != n || gb.topOfStack() != n {
+			t.Fatalf("%d slots: board has %d, top of stack %d", n, len(gb.Slots), gb.topOfStack())
+		}
+		alphs, _ := testAlphagrams(3)
+		for _, alph := range alphs[:1] {
+			q := &Question{OrigQuestion: alph}
+			q.populateMap()
+			gb.Queue = append(gb.Queue, q)
+		}
+		gb.status = PieceDropping
+		for gb.LastStateChange.ChangeType != PieceLand {
+			gb.Tick()
+		}
+		if landed := gb.LastStateChange.PayloadNum; landed != n-1 || gb.Slots[n-1] == nil {
+			t.Errorf("%d slots: the piece landed in slot %d", n, landed)
+		}
+		// Attacks rise from the bottom of the board, whatever its size.
+		for _, alph := range alphs[1:] {
+			gb.OppQueue = append(gb.OppQueue, &Question{OrigQuestion: alph, Whose: 1})
+		}
+		if got, want := gb.addOppQueue(), []int{n - 2, n - 1}; !slices.Equal(got, want) {
+			t.Errorf("%d slots: attacks rose to %v, want %v", n, got, want)
+		}
+		if gb.topOfStack() != n-3 {
+			t.Errorf("%d slots: top of stack %d after the rise", n, gb.topOfStack())
+		}
+
+		gb.publish()
+		bts, _ := gb.MarshalJSON()
+		back := &GameBoard{}
+		if err := json.Unmarshal(bts, back); err != nil {
+			t.Fatal(err)
+		}
+		if len(back.Slots) != n {
+			t.Errorf("%d slots: unmarshaled a board of %d", n, len(back.Slots))
+		}
+		// The status isn't marshaled.
+		back.status = gb.status
+		if diffs := DiffBoards(gb, back); len(diffs) > 0 {
+			t.Errorf("%d slots: the board changed on the way through JSON: %v", n, diffs)
+		}
+	}
+}
+
+func TestLandingChangeTypes(t *testing.T) {
+	gb, _ := testBoard(2)
+
+	// Let the first piece fall all the way down.
+	for gb.LastStateChange.ChangeType != PieceLand {
+		gb.Tick()
+		if ct := gb.LastStateChange.ChangeType; ct != PieceFall && ct != PieceLand {
+			t.Fatalf("unexpected change %q while falling", ct)
+		}
+	}
+	if gb.LastStateChange.PayloadNum != NumSlots-1 {
+		t.Errorf("landed at %d, want %d", gb.LastStateChange.PayloadNum, NumSlots-1)
+	}
+
+	// Next piece comes in; a wrong guess slams it down.
+	gb.Tick()
+	gb.Tick()
+	from := gb.FallerPos
+	wrong := strings.ToLower(gb.Slots[from].OrigQuestion.Alphagram)
+	if o := gb.handleGuessEvent(wrong); o != GuessPenalized {
+		t.Fatalf("a wrong guess on the faller was %q", o)
+	}
+	want := StateChange{ChangeType: PieceForcedDrop, PayloadNum: NumSlots - 2, PayloadNum2: from}
+	if !reflect.DeepEqual(gb.LastStateChange, want) {
+		t.Errorf("got %+v, want %+v", gb.LastStateChange, want)
+	}
+}
+
+func TestQueuedAttacksAreRedacted(t *testing.T) {
+	attacker, _ := testBoard(1)
+	attacker.manager.Config.RedactQueuedAttacks = true
+	for attacker.LastStateChange.ChangeType != PieceLand {
+		attacker.Tick()
+	}
+	q := attacker.Slots[NumSlots-1]
+	answer := q.OrigQuestion.Words[0].Word
+	attacker.handleGuessEvent(answer)
+	sent := <-attacker.manager.addToOppQueue
+	if sent.OrigQuestion != q.OrigQuestion || sent.AnswerMap != nil {
+		t.Fatalf("the attack went out with answers %v", sent.AnswerMap)
+	}
+
+	// The defender's answer map stays empty while the rack waits in the queue.
+	defender, _ := testBoard(0)
+	defender.OppQueue = append(defender.OppQueue, sent)
+	defender.publish()
+	bts, err := json.Marshal(defender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var view struct {
+		OppQueue []struct{ AnswerMap map[string]bool }
+	}
+	if err := json.Unmarshal(bts, &view); err != nil {
+		t.Fatal(err)
+	}
+	if len(view.OppQueue) != 1 || view.OppQueue[0].AnswerMap != nil {
+		t.Errorf("queued attack shows its answers: %s", bts)
+	}
+
+	// Once it rises, it can be solved.
+	defender.SetOppQueueReady()
+	defender.status = PieceAboutToDrop
+	defender.Tick()
+	if defender.LastStateChange.ChangeType != StackRise || defender.Slots[NumSlots-1] != sent {
+		t.Fatalf("the attack didn't rise: %+v", defender.LastStateChange)
+	}
+	defender.handleGuessEvent(answer)
+	if defender.Solved != 1 || defender.Slots[NumSlots-1] != nil {
+		t.Error("the risen attack couldn't be solved")
+	}
+}
+
+// watchStatuses runs a game on a manual clock, with nobody guessing, and
+// reports each status it sends out until done returns true.
+func watchStatuses(t *testing.T, gs *GameStateManager, done func(Status) bool) []Status {
+	stateOut := make(chan []byte)
+	gs.stateOut = stateOut
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	var statuses []Status
+	timeout := time.After(20 * time.Second)
+	for {
+		select {
+		case bts := <-stateOut:
+			var state struct{ Status Status }
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			statuses = append(statuses, state.Status)
+			if done(state.Status) {
+				return statuses
+			}
+		case <-timeout:
+			t.Fatalf("timed out; statuses so far %v", statuses)
+		}
+	}
+}
+
+func TestSingleGameSeries(t *testing.T) {
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.SeriesMode = SingleGame
+	// Nobody guesses, so it's a draw.
+	cfg.ReplayDraws = false
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), cfg)
+	statuses := watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+	if last := statuses[len(statuses)-1]; last != Finished {
+		t.Errorf("ended with %v, want %v", last, Finished)
+	}
+	select {
+	case <-gs.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("manager loop didn't exit")
+	}
+	if gs.QuestionOffset != TotalNumQuestions {
+		t.Errorf("played %d questions, want one game's worth", gs.QuestionOffset)
+	}
+}
+
+func TestDrawnSingleGameReplays(t *testing.T) {
+	// Nobody guesses, so every round is a draw, and gets replayed until
+	// the questions run out.
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.SeriesMode = SingleGame
+	cfg.ReplayDraws = true
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), cfg)
+	statuses := watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+	i := slices.Index(statuses, Playing)
+	if i == -1 || !slices.Contains(statuses[i:], Countdown) {
+		t.Errorf("the drawn game wasn't replayed: %v", statuses)
+	}
+	if !gs.Result.IsDraw() {
+		t.Errorf("result %+v, want a draw", gs.Result)
+	}
+	if gs.Status != PermanentlyOver || gs.QuestionOffset != 2*TotalNumQuestions {
+		t.Errorf("ended with %v after %d questions", gs.Status, gs.QuestionOffset)
+	}
+}
+
+func TestContinuousSeries(t *testing.T) {
+	// Enough questions for two games; the third can't start.
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), nil)
+	watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+	if gs.Status != PermanentlyOver || !strings.HasPrefix(gs.Error, ErrTooFewQuestions.Error()) {
+		t.Errorf("ended with %v (%q), want the series to run out of questions", gs.Status, gs.Error)
+	}
+	if gs.QuestionOffset != 2*TotalNumQuestions {
+		t.Errorf("played %d questions, want two games' worth", gs.QuestionOffset)
+	}
+}
+
+func TestHistoryCap(t *testing.T) {
+	// Two rounds, each with far more state changes than the cap.
+	const limit = 20
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.MaxHistory = limit
+	cfg.ArchiveHistory = true
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), cfg)
+	var replays []*Replay
+	biggest := 0
+	gs.SetReplaySink(func(r *Replay) {
+		replays = append(replays, r)
+		biggest = max(biggest, gs.HistorySize())
+	})
+	watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+
+	if biggest == 0 || biggest > limit {
+		t.Errorf("kept %d state changes, want at most %d", biggest, limit)
+	}
+	if len(replays) != 4 {
+		t.Fatalf("got %d replays, want one per player per round", len(replays))
+	}
+	// Replays have the whole round, not just what's left in the history.
+	for round := range 2 {
+		if n := len(replays[2*round].History) + len(replays[2*round+1].History); n <= limit {
+			t.Errorf("round %d's replays have just %d state changes", round+1, n)
+		}
+	}
+	for _, r := range replays {
+		for _, e := range r.History {
+			if gs.Players[e.Board] != r.Player {
+				t.Fatalf("%s's replay has a change on board %d", r.Player, e.Board)
+			}
+		}
+	}
+	if n := gs.HistorySize(); n > limit {
+		t.Errorf("ended up keeping %d state changes", n)
+	}
+}
+
+func TestRecentHistoryWrapsAround(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Config.MaxHistory = 3
+	gs.Config.ArchiveHistory = true
+	for i := range 5 {
+		gs.recordHistory(HistoryEntry{Board: i})
+	}
+	var boards []int
+	for _, e := range gs.RecentHistory(10) {
+		boards = append(boards, e.Board)
+	}
+	if !slices.Equal(boards, []int{2, 3, 4}) {
+		t.Errorf("recent history is boards %v, want [2 3 4]", boards)
+	}
+	if len(gs.archived) != 2 || gs.archived[0].Board != 0 || gs.archived[1].Board != 1 {
+		t.Errorf("archived %+v, want the first two", gs.archived)
+	}
+}
+
+func TestNumQuestions(t *testing.T) {
+	// Enough for two short rounds. The boards are small too, so that
+	// nobody guessing still kills them.
+	const n = 20
+	alphs, _ := testAlphagrams(2*n + 5)
+	cfg := DefaultGameConfig()
+	cfg.NumQuestions = n
+	cfg.NumSlots = MinNumSlots
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), cfg)
+	watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+	if gs.QuestionOffset != 2*n {
+		t.Errorf("played %d questions, want two rounds of %d", gs.QuestionOffset, n)
+	}
+	if want := fmt.Sprintf("need %d questions, there are 5 left", n); !strings.Contains(gs.Error, want) {
+		t.Errorf("ended with %q, want it to say it needs %d", gs.Error, n)
+	}
+}
+
+// countingSearcher is a fakeSearcher that counts the searches it answers.
+type countingSearcher struct {
+	fakeSearcher
+	searches *atomic.Int32
+}
+
+func (c countingSearcher) Search(ctx context.Context, r *wordsearcher.SearchRequest) (*wordsearcher.SearchResponse, error) {
+	c.searches.Add(1)
+	return c.fakeSearcher.Search(ctx, r)
+}
+
+func TestFreshEachRound(t *testing.T) {
+	// Only enough questions for one game, but every round draws from the
+	// whole list, so the second round still starts.
+	alphs, _ := testAlphagrams(TotalNumQuestions)
+	var searches atomic.Int32
+	srv := httptest.NewServer(wordsearcher.NewQuestionSearcherServer(countingSearcher{fakeSearcher{alphs}, &searches}))
+	t.Cleanup(srv.Close)
+	cfg := DefaultGameConfig()
+	cfg.FreshEachRound = true
+	cfg.MaxRounds = 2
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, srv.URL, "gid", nil, testSeed(), cfg)
+	watchStatuses(t, gs, func(s Status) bool { return s == PermanentlyOver })
+	if gs.Error != "" {
+		t.Errorf("series ended with %q", gs.Error)
+	}
+	if gs.RoundsPlayed != 2 {
+		t.Errorf("played %d rounds, want 2", gs.RoundsPlayed)
+	}
+	if n := searches.Load(); n != 2 {
+		t.Errorf("ran %d searches, want 2", n)
+	}
+}
+
+func TestSetQuestions(t *testing.T) {
+	// The list was already fetched, for the seek, so the first round
+	// doesn't search for it; the second one does.
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	var searches atomic.Int32
+	srv := httptest.NewServer(wordsearcher.NewQuestionSearcherServer(countingSearcher{fakeSearcher{alphs}, &searches}))
+	t.Cleanup(srv.Close)
+	cfg := DefaultGameConfig()
+	cfg.MaxRounds = 2
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, srv.URL, "gid", nil, testSeed(), cfg)
+	gs.SetQuestions(alphs)
+	watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+	if gs.RoundsPlayed != 2 {
+		t.Errorf("played %d rounds, want 2", gs.RoundsPlayed)
+	}
+	if n := searches.Load(); n != 1 {
+		t.Errorf("ran %d searches, want 1", n)
+	}
+}
+
+func TestMaxRounds(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	gs.Config.MaxRounds = 4
+	for i, winner := range []int{1, 0, NoWinner, 1} {
+		gs.Result = &GameResult{Winner: winner, Reason: ResultSurvived}
+		if last := gs.countRound(); last != (i == 3) {
+			t.Errorf("after round %d, last = %v", i+1, last)
+		}
+		// Rounds cut short by maintenance don't count.
+		gs.Result = &GameResult{Winner: NoWinner, Reason: ResultMaintenance}
+		if gs.countRound() {
+			t.Error("a maintenance round ended the series")
+		}
+	}
+	if res := gs.seriesResult(); res.Winner != 1 || !slices.Equal(res.Scores, []int{1, 2}) {
+		t.Errorf("series result %+v, want b winning 2 rounds to 1", res)
+	}
+
+	// A series with questions left for another round still stops.
+	alphs, _ := testAlphagrams(3 * TotalNumQuestions)
+	gs = NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), nil)
+	gs.Config.MaxRounds = 1
+	watchStatuses(t, gs, func(s Status) bool { return s == Finished || s == PermanentlyOver })
+	if gs.Status != Finished || gs.RoundsPlayed != 1 || gs.SeriesResult == nil ||
+		gs.SeriesResult.Reason != ResultMaxRounds {
+		t.Errorf("ended with %v after %d rounds, series result %+v", gs.Status, gs.RoundsPlayed, gs.SeriesResult)
+	}
+}
+
+// attackBoard sends the attacks to a board that already holds the first two
+// questions, and returns what ends up in its opp queue.
+func attackBoard(dropDuplicates bool, attacks ...int) []string {
+	gb, _ := testBoard(2)
+	gb.manager.Config.DropDuplicateAttacks = dropDuplicates
+
+	// Attacks are copies of the questions, as in a shared-question game.
+	alphs, _ := testAlphagrams(4)
+	for _, i := range attacks {
+		q := &Question{OrigQuestion: alphs[i], Whose: 1}
+		gb.deliverAttack(q)
+	}
+	gb.receiveAttacks()
+	var queued []string
+	for _, q := range gb.OppQueue {
+		queued = append(queued, q.OrigQuestion.Alphagram)
+	}
+	return queued
+}
+
+func TestDuplicateAttacksDropped(t *testing.T) {
+	alphs, _ := testAlphagrams(4)
+	if got, want := attackBoard(true, 0, 1, 3), []string{alphs[3].Alphagram}; !slices.Equal(got, want) {
+		t.Errorf("queued %v, want %v", got, want)
+	}
+	if got := attackBoard(false, 0, 3); len(got) != 2 {
+		t.Errorf("with the check off, queued %v, want both", got)
+	}
+}
+
+func TestRisePolicy(t *testing.T) {
+	for policy, wantLeft := range map[RisePolicy]time.Duration{
+		RiseBatch:     -time.Second,
+		RisePerAttack: 0,
+	} {
+		gb, clock := testBoard(2)
+		gb.manager.Config.RisePolicy = policy
+		gb.Timer = clock.NewTimer(time.Hour)
+		go gb.loop()
+
+		alphs, _ := testAlphagrams(4)
+		for _, alph := range alphs[2:] {
+			gb.deliverAttack(&Question{OrigQuestion: alph, Whose: 1})
+			<-gb.manager.stateChange
+			clock.Advance(time.Second)
+		}
+		// The second attack came in a second after the first, and it's been
+		// another second since.
+		want := gb.manager.oppTickDuration(gb.Idx) - time.Second + wantLeft
+		if got := gb.OppQueueRisesIn(); got != want {
+			t.Errorf("%s: the queue rises in %v, want %v", policy, got, want)
+		}
+		gb.Quit()
+		<-gb.manager.boardexited
+	}
+}
+
+func TestBoardExitWithoutManager(t *testing.T) {
+	waitForExit := func(gb *GameBoard, clock *ManualClock) bool {
+		gb.Timer = clock.NewTimer(time.Hour)
+		exited := make(chan struct{})
+		go func() {
+			gb.loop()
+			close(exited)
+		}()
+		gb.Quit()
+		stop := make(chan struct{})
+		defer close(stop)
+		go runClock(clock, stop)
+		select {
+		case <-exited:
+			return true
+		case <-time.After(5 * time.Second):
+			return false
+		}
+	}
+
+	// The manager loop is gone, e.g. it was stopped.
+	gb, clock := testBoard(1)
+	close(gb.manager.done)
+	if !waitForExit(gb, clock) {
+		t.Error("the board hung on a manager that had exited")
+	}
+
+	// The manager is there, but never gets to it.
+	gb, clock = testBoard(1)
+	gb.manager.Config.BoardExitTimeout = time.Second
+	if !waitForExit(gb, clock) {
+		t.Error("the board hung past BoardExitTimeout")
+	}
+}
+
+func TestNextTickIn(t *testing.T) {
+	gb, clock := testBoard(1)
+	gb.Tick()
+	if got := gb.NextTickIn(); got != TickDuration {
+		t.Fatalf("right after a tick, NextTickIn = %v, want %v", got, TickDuration)
+	}
+	clock.Advance(TickDuration / 3)
+	if got, want := gb.NextTickIn(), TickDuration-TickDuration/3; got != want {
+		t.Errorf("NextTickIn = %v, want %v", got, want)
+	}
+	clock.Advance(TickDuration)
+	if got := gb.NextTickIn(); got != 0 {
+		t.Errorf("overdue NextTickIn = %v, want 0", got)
+	}
+	gb.Tick()
+	if got := gb.NextTickIn(); got != TickDuration {
+		t.Errorf("NextTickIn didn't reset on tick: %v", got)
+	}
+
+	if got := gb.OppQueueRisesIn(); got != 0 {
+		t.Errorf("empty opp queue rises in %v", got)
+	}
+	gb.Lock()
+	gb.OppQueue = append(gb.OppQueue, gb.Slots[gb.FallerPos])
+	gb.startOppQueueTimer(OppTickDuration)
+	gb.Unlock()
+	clock.Advance(time.Second)
+	if got, want := gb.OppQueueRisesIn(), OppTickDuration-time.Second; got != want {
+		t.Errorf("OppQueueRisesIn = %v, want %v", got, want)
+	}
+}
+
+func TestGuessOutcomes(t *testing.T) {
+	// Two questions land and a third is falling.
+	gb, _ := testBoard(3)
+	for gb.FallerPos != 0 || len(gb.Queue) != 0 {
+		gb.Tick()
+	}
+	faller := gb.Slots[0]
+	landed := gb.Slots[NumSlots-1]
+	wrongAnagram := func(q *Question) string {
+		return strings.ToLower(q.OrigQuestion.Alphagram)
+	}
+
+	for _, tc := range []struct {
+		guess string
+		want  GuessOutcome
+	}{
+		{"x", GuessTooShort},
+		{"zzzz", GuessUnrelated},
+		{"ecb", GuessUnrelated},
+		{wrongAnagram(landed), GuessWrongAnagram},
+		{" " + strings.ToUpper(landed.OrigQuestion.Words[0].Word), GuessSolved},
+		// Already solved: that answer is gone now.
+		{landed.OrigQuestion.Words[0].Word, GuessUnrelated},
+		{wrongAnagram(faller), GuessPenalized},
+	} {
+		if got := gb.handleGuessEvent(tc.guess); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.guess, got, tc.want)
+		}
+		if gb.LastGuessOutcome != tc.want {
+			t.Errorf("%q: LastGuessOutcome = %q", tc.guess, gb.LastGuessOutcome)
+		}
+	}
+	if gb.Solved != 1 {
+		t.Errorf("Solved = %d, want 1", gb.Solved)
+	}
+}
+
+func TestGuessAlreadySolved(t *testing.T) {
+	for _, report := range []bool{true, false} {
+		gb, _ := testBoard(1)
+		gb.manager.Config.ReportAlreadySolved = report
+		q := gb.Queue[0]
+		// Two answers, so solving one leaves the rack falling.
+		q.OrigQuestion.Words = append(q.OrigQuestion.Words, &wordsearcher.Word{Word: "bace"})
+		q.populateMap()
+		gb.Tick()
+		faller := gb.FallerPos
+		answer := q.OrigQuestion.Words[0].Word
+
+		if o := gb.handleGuessEvent(answer); o != GuessSolved {
+			t.Fatalf("first guess got %v", o)
+		}
+		want := GuessAlreadySolved
+		if !report {
+			want = GuessUnrelated
+		}
+		if o := gb.handleGuessEvent(answer); o != want {
+			t.Errorf("report %v: guessing it again got %v, want %v", report, o, want)
+		}
+		if gb.FallerPos != faller || gb.Slots[faller] != q || q.answersLeft() != 1 {
+			t.Errorf("report %v: guessing it again was penalized", report)
+		}
+		if o := gb.handleGuessEvent("bace"); o != GuessSolved {
+			t.Errorf("report %v: the other answer got %v", report, o)
+		}
+	}
+}
+
+func TestAlreadySolvedGoesOut(t *testing.T) {
+	gb, clock := testBoard(1)
+	gs := gb.manager
+	gs.Config.ReportAlreadySolved = true
+	q := gb.Queue[0]
+	q.OrigQuestion.Words = append(q.OrigQuestion.Words, &wordsearcher.Word{Word: "bace"})
+	q.populateMap()
+	gb.Tick()
+	gb.publish()
+	other := newGameBoard(1, gs)
+	other.publish()
+	gs.Boards = []*GameBoard{gb, other}
+	gs.exitedboards = make([]bool, len(gs.Boards))
+	stateOut := make(chan []byte)
+	gs.stateOut = stateOut
+	gs.timer = clock.NewTimer(time.Hour)
+	gb.Timer = clock.NewTimer(time.Hour)
+	go gs.Loop()
+	go gb.loop()
+
+	outcome := func() GuessOutcome {
+		t.Helper()
+		select {
+		case bts := <-stateOut:
+			var state struct {
+				Boards []struct{ LastGuessOutcome GuessOutcome }
+			}
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			return state.Boards[0].LastGuessOutcome
+		case <-time.After(5 * time.Second):
+			t.Fatal("no state came out")
+			return ""
+		}
+	}
+	answer := q.OrigQuestion.Words[0].Word
+	if err := gs.Guess("a", answer); err != nil {
+		t.Fatal(err)
+	}
+	if got := outcome(); got != GuessSolved {
+		t.Fatalf("the first guess went out as %q", got)
+	}
+	if err := gs.Guess("a", answer); err != nil {
+		t.Fatal(err)
+	}
+	if got := outcome(); got != GuessAlreadySolved {
+		t.Errorf("guessing it again went out as %q, want %q", got, GuessAlreadySolved)
+	}
+
+	gb.Quit()
+	go gs.Stop()
+	for {
+		select {
+		case <-stateOut:
+		case <-gs.Done():
+			return
+		case <-time.After(5 * time.Second):
+			t.Fatal("the game didn't stop")
+		}
+	}
+}
+
+func TestStackRisePositions(t *testing.T) {
+	gb, _ := testBoard(1)
+	for gb.LastStateChange.ChangeType != PieceLand {
+		gb.Tick()
+	}
+	bottom := gb.Slots[NumSlots-1]
+	alphs, _ := testAlphagrams(4)
+	for _, alph := range alphs[1:] {
+		gb.OppQueue = append(gb.OppQueue, &Question{OrigQuestion: alph, Whose: 1})
+	}
+	gb.SetOppQueueReady()
+	gb.Tick()
+
+	sc := gb.LastStateChange
+	want := []int{NumSlots - 3, NumSlots - 2, NumSlots - 1}
+	if sc.ChangeType != StackRise || sc.PayloadNum != 3 || !slices.Equal(sc.Positions, want) {
+		t.Fatalf("got %+v, want a rise of 3 into %v", sc, want)
+	}
+	// Each rack, oldest first, is where its position says.
+	for i, pos := range sc.Positions {
+		if got := gb.Slots[pos].OrigQuestion; got != alphs[1+i] {
+			t.Errorf("rack %d ended up with %v at %d", i, got.Alphagram, pos)
+		}
+	}
+	if gb.Slots[NumSlots-4] != bottom {
+		t.Error("the old stack didn't move up by three")
+	}
+	if len(gb.OppQueue) != 0 {
+		t.Errorf("%d racks left in the opp queue", len(gb.OppQueue))
+	}
+}
+
+func TestPrintableBoardCounts(t *testing.T) {
+	gs := NewGameStateManager(nil, nil, "", "gid", nil, testSeed(), nil)
+	if got := gs.Printable(); got != "(Uninitialized)" {
+		t.Errorf("no boards: %q", got)
+	}
+	for n := 1; n <= 3; n++ {
+		gs.Boards = make([]*GameBoard, n)
+		for i := range gs.Boards {
+			gs.Boards[i] = newGameBoard(i, gs)
+		}
+		out := gs.Printable()
+		for i := range n {
+			if !strings.Contains(out, fmt.Sprintf("Board %d Dead", i)) {
+				t.Errorf("%d boards: board %d missing from\n%s", n, i, out)
+			}
+		}
+		// All boards share the same rows.
+		if lines := strings.Count(out, "\n"); lines != 2+len(gs.Boards[0].Printable()) {
+			t.Errorf("%d boards: got %d lines", n, lines)
+		}
+	}
+
+	// A board decoded from the state has the answer counts, but not the
+	// answers.
+	gb, _ := testBoard(1)
+	for gb.LastStateChange.ChangeType != PieceLand {
+		gb.Tick()
+	}
+	gb.publish()
+	bts, _ := gb.MarshalJSON()
+	back := &GameBoard{}
+	if err := json.Unmarshal(bts, back); err != nil {
+		t.Fatal(err)
+	}
+	q := gb.Slots[NumSlots-1]
+	want := fmt.Sprintf("| %d %s", q.AnswersLeft, q.OrigQuestion.Alphagram)
+	if got := strings.Join(back.Printable(), "\n"); q.AnswersLeft == 0 || !strings.Contains(got, want) {
+		t.Errorf("want %q in\n%s", want, got)
+	}
+}
+
+func TestQuestionTimeout(t *testing.T) {
+	for _, reveal := range []bool{false, true} {
+		gb, clock := testBoard(2)
+		gb.manager.Config.QuestionTimeout = 10 * time.Second
+		gb.manager.Config.RevealOnTimeout = reveal
+		for gb.LastStateChange.ChangeType != PieceLand {
+			gb.Tick()
+		}
+		landed := gb.Slots[NumSlots-1]
+		gb.Tick() // the next one starts falling
+		if gb.expireQuestions() {
+			t.Fatal("a question expired early")
+		}
+
+		clock.Advance(10 * time.Second)
+		if !gb.expireQuestions() {
+			t.Fatal("the landed question didn't expire")
+		}
+		if gb.Slots[NumSlots-1] != nil || gb.Slots[gb.FallerPos] == nil {
+			t.Error("expected only the landed question to be cleared, not the faller")
+		}
+		sc := gb.LastStateChange
+		wantAnswers := ""
+		if reveal {
+			wantAnswers = landed.OrigQuestion.Words[0].Word
+		}
+		if sc.ChangeType != QuestionTimedOut || sc.PayloadNum != NumSlots-1 || sc.PayloadString != wantAnswers {
+			t.Errorf("reveal %v: got %+v", reveal, sc)
+		}
+		if gb.Solved != 0 {
+			t.Error("a timed-out question counted as solved")
+		}
+	}
+}
+
+func TestIdleForfeit(t *testing.T) {
+	idler, clock := testBoard(1)
+	idler.manager.Config.IdleForfeit = 30 * time.Second
+	// The guesser is on the same clock.
+	guesser := newGameBoard(1, idler.manager)
+
+	var warnedAt, forfeitAt time.Duration
+	for elapsed := 5 * time.Second; elapsed <= time.Minute; elapsed += 5 * time.Second {
+		clock.Advance(5 * time.Second)
+		if elapsed%(10*time.Second) == 0 {
+			if err := guesser.Guess("anything"); err != nil {
+				t.Fatal(err)
+			}
+			<-guesser.guessEvents
+		}
+		if guesser.checkIdle() {
+			t.Fatalf("at %v, the guesser got %+v", elapsed, guesser.LastStateChange)
+		}
+		if idler.checkIdle() {
+			switch idler.LastStateChange.ChangeType {
+			case IdleWarning:
+				warnedAt = elapsed
+			case Lost:
+				forfeitAt = elapsed
+			}
+		}
+	}
+	if warnedAt != 15*time.Second || idler.LastStateChange.PayloadString != "idle" || forfeitAt != 30*time.Second {
+		t.Errorf("idler was warned at %v and forfeited at %v (%+v)", warnedAt, forfeitAt, idler.LastStateChange)
+	}
+	if !idler.Dead || guesser.Dead {
+		t.Errorf("dead: idler %v, guesser %v", idler.Dead, guesser.Dead)
+	}
+}
+
+func TestMercyMargin(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.solvedCounts = make([]atomic.Int64, 2)
+	gs.solvedCounts[0].Store(12)
+	gs.solvedCounts[1].Store(4)
+	if d := gs.oppTickDuration(0); d != OppTickDuration {
+		t.Errorf("with mercy off, the leader's attacks rise in %v", d)
+	}
+
+	gs.Config.MercyMargin = 5
+	mercy := time.Duration(float64(OppTickDuration) * gs.Config.MercyRiseFactor)
+	for _, tc := range []struct {
+		leader, trailer int64
+		want            time.Duration
+	}{
+		{12, 4, mercy},
+		{9, 4, mercy},
+		{8, 4, OppTickDuration},
+		{4, 4, OppTickDuration},
+	} {
+		gs.solvedCounts[0].Store(tc.leader)
+		gs.solvedCounts[1].Store(tc.trailer)
+		if d := gs.oppTickDuration(0); d != tc.want {
+			t.Errorf("%d vs %d: leader's attacks rise in %v, want %v", tc.leader, tc.trailer, d, tc.want)
+		}
+		if d := gs.oppTickDuration(1); d != OppTickDuration {
+			t.Errorf("%d vs %d: trailer's attacks rise in %v", tc.leader, tc.trailer, d)
+		}
+	}
+}
+
+// raceGhost plays a single game against a ghost that solves the questions
+// at the given time. If live is set, the live player solves them as soon as
+// they've all landed. It returns the final board states.
+func raceGhost(t *testing.T, ghostAt time.Duration, live bool) ([]struct {
+	Won    bool
+	Solved int
+}, []*Replay) {
+	alphs, answers := testAlphagrams(3)
+	ghost := &Replay{Player: "me", Questions: alphs}
+	for _, a := range answers {
+		ghost.Guesses = append(ghost.Guesses, GuessRecord{At: ghostAt, Guess: a})
+	}
+	cfg := DefaultGameConfig()
+	cfg.SeriesMode = SingleGame
+	cfg.Ghost = ghost
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager(nil, []string{"me", GhostPlayer}, "", "gid", stateOut, testSeed(), cfg)
+	var replays []*Replay
+	gs.SetReplaySink(func(r *Replay) { replays = append(replays, r) })
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	var state struct {
+		Status Status
+		Boards []struct {
+			Won    bool
+			Solved int
+			Slots  []*struct{}
+		}
+	}
+	guessed := false
+	timeout := time.After(20 * time.Second)
+	for state.Status != Finished {
+		select {
+		case bts := <-stateOut:
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.Status != Playing || !live || guessed {
+				continue
+			}
+			if s := state.Boards[0].Slots; s[NumSlots-3] != nil && s[NumSlots-2] != nil && s[NumSlots-1] != nil {
+				guessed = true
+				go func() {
+					for _, a := range answers {
+						gs.Guess("me", a)
+					}
+				}()
+			}
+		case <-timeout:
+			t.Fatalf("game never finished; last status %v", state.Status)
+		}
+	}
+	boards := make([]struct {
+		Won    bool
+		Solved int
+	}, len(state.Boards))
+	for i, b := range state.Boards {
+		boards[i].Won, boards[i].Solved = b.Won, b.Solved
+	}
+	return boards, replays
+}
+
+func TestGhostRace(t *testing.T) {
+	// Idle, the player loses to the ghost, which solves everything.
+	boards, replays := raceGhost(t, time.Minute, false)
+	if !boards[1].Won || boards[1].Solved != 3 || boards[0].Won {
+		t.Errorf("idle player vs ghost: %+v", boards)
+	}
+	if len(replays) != 1 || replays[0].Player != "me" || len(replays[0].Guesses) != 0 {
+		t.Errorf("want one empty replay for the live player, got %+v", replays)
+	}
+
+	// Beating the ghost to it wins.
+	boards, replays = raceGhost(t, 5*time.Minute, true)
+	if !boards[0].Won || boards[0].Solved != 3 || boards[1].Won || boards[1].Solved != 0 {
+		t.Errorf("fast player vs ghost: %+v", boards)
+	}
+	if len(replays) != 1 || len(replays[0].Guesses) != 3 {
+		t.Errorf("want the live player's three guesses, got %+v", replays)
+	}
+}
+
+func TestMaxGameDuration(t *testing.T) {
+	alphs, answers := testAlphagrams(4 * TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.MaxGameDuration = 10 * time.Second
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", stateOut, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	var state struct {
+		Status Status
+		Result *GameResult
+	}
+	guessed := false
+	timeout := time.After(20 * time.Second)
+	for state.Status != Finished && state.Status != PermanentlyOver {
+		select {
+		case bts := <-stateOut:
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.Status == Playing && !guessed {
+				// a gets whatever is falling; nobody else does anything.
+				guessed = true
+				go func() {
+					for _, a := range answers {
+						gs.Guess("a", a)
+					}
+				}()
+			}
+		case <-timeout:
+			t.Fatal("the game was never cut off")
+		}
+	}
+	if state.Status != Finished || state.Result == nil {
+		t.Fatalf("ended with status %v, result %+v", state.Status, state.Result)
+	}
+	if r := state.Result; r.Reason != ResultTimeLimit || r.Winner != 0 || r.Scores[0] == 0 || r.Scores[1] != 0 {
+		t.Errorf("result %+v, want a time-limit win for a", r)
+	}
+}
+
+type snapshotQuestion struct {
+	OrigQuestion *struct{ Alphagram string }
+}
+
+// checkSnapshot makes sure a board's snapshot isn't caught halfway through
+// a change: with duplicate attacks dropped, no rack is on a board twice.
+func checkSnapshot(t *testing.T, bts []byte) {
+	var board struct {
+		Slots, Queue, OppQueue []*snapshotQuestion
+	}
+	if err := json.Unmarshal(bts, &board); err != nil {
+		t.Errorf("bad snapshot: %v", err)
+		return
+	}
+	seen := map[string]bool{}
+	for _, qs := range [][]*snapshotQuestion{board.Slots, board.Queue, board.OppQueue} {
+		for _, q := range qs {
+			if q == nil || q.OrigQuestion == nil || q.OrigQuestion.Alphagram == "" {
+				continue
+			}
+			if seen[q.OrigQuestion.Alphagram] {
+				t.Errorf("%s is on the board twice: %s", q.OrigQuestion.Alphagram, bts)
+			}
+			seen[q.OrigQuestion.Alphagram] = true
+		}
+	}
+}
+
+// Run with -race: the boards tick, guess and attack each other while their
+// snapshots are marshaled, by the manager and by other goroutines, the way
+// reconnects and spectators take them.
+func TestSnapshotsWhileBoardsTick(t *testing.T) {
+	alphs, answers := testAlphagrams(TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.SeriesMode = SingleGame
+	cfg.DropDuplicateAttacks = true
+	cfg.MaxGameDuration = time.Minute
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b", "c", "d"}, fakeWordDB(t, alphs), "gid",
+		stateOut, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	// Wait for the boards to be dealt, then keep reading states.
+	for {
+		var state struct{ Status Status }
+		if err := json.Unmarshal(<-stateOut, &state); err != nil {
+			t.Fatal(err)
+		}
+		if state.Status == Playing {
+			break
+		}
+	}
+	go func() {
+		for range stateOut {
+		}
+	}()
+
+	// A guess can block forever on a board that has just exited, so nothing
+	// waits on the guesser.
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-gs.Done():
+				return
+			default:
+			}
+			gs.Guess("a", answers[i%len(answers)])
+			time.Sleep(200 * time.Microsecond)
+		}
+	}()
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-gs.Done():
+					return
+				default:
+				}
+				var state struct{ Boards []json.RawMessage }
+				if err := json.Unmarshal(gs.CurrentState(), &state); err != nil {
+					t.Errorf("bad state: %v", err)
+					return
+				}
+				for _, b := range state.Boards {
+					checkSnapshot(t, b)
+				}
+				gs.TickInfo()
+				bts, err := json.Marshal(gs.boards())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var boards []struct{ Idx int }
+				if err := json.Unmarshal(bts, &boards); err != nil || len(boards) != len(gs.Players) {
+					t.Errorf("bad boards %s: %v", bts, err)
+					return
+				}
+				for i, b := range boards {
+					if b.Idx != i {
+						t.Errorf("board %d marshaled as %d", i, b.Idx)
+					}
+				}
+				for _, b := range gs.boards() {
+					bts, _ := b.MarshalJSON()
+					checkSnapshot(t, bts)
+				}
+				time.Sleep(100 * time.Microsecond)
+			}
+		}()
+	}
+	select {
+	case <-gs.Done():
+	case <-time.After(20 * time.Second):
+		t.Fatal("game never ended")
+	}
+	wg.Wait()
+}
+
+func TestSolveQueued(t *testing.T) {
+	for _, advanced := range []bool{false, true} {
+		// One question falling, two waiting in the queue.
+		gb, _ := testBoard(3)
+		gb.manager.Config.SolveQueued = advanced
+		gb.Tick()
+		queued := gb.Queue[0]
+		answer := queued.OrigQuestion.Words[0].Word
+
+		got := gb.handleGuessEvent(answer)
+		if !advanced {
+			if got != GuessUnrelated || len(gb.Queue) != 2 || gb.Solved != 0 {
+				t.Errorf("normal mode: a queued question got solved (%q)", got)
+			}
+			continue
+		}
+		if got != GuessSolved || gb.Solved != 1 {
+			t.Fatalf("advanced mode: got %q, solved %d", got, gb.Solved)
+		}
+		if len(gb.Queue) != 1 || gb.Queue[0] == queued {
+			t.Error("the solved question is still queued")
+		}
+		if sc := gb.LastStateChange; sc.ChangeType != FullySolveQueuedQuestion || sc.PayloadNum != 0 {
+			t.Errorf("state change %+v", sc)
+		}
+		// It was ours, so it goes to the opponent like any other solve.
+		select {
+		case q := <-gb.manager.addToOppQueue:
+			if q.OrigQuestion != queued.OrigQuestion {
+				t.Error("the wrong question was sent as an attack")
+			}
+		default:
+			t.Error("no attack was sent")
+		}
+		// A wrong anagram of a queued question is no penalty.
+		if got := gb.handleGuessEvent(strings.ToLower(gb.Queue[0].OrigQuestion.Alphagram)); got != GuessUnrelated {
+			t.Errorf("wrong anagram of a queued question: %q", got)
+		}
+	}
+}
+
+func TestSolveTieBreak(t *testing.T) {
+	// The same alphagram, dealt into three slots.
+	dupBoard := func(rule SolveTieBreak, idx int) (*GameBoard, string) {
+		gb, _ := testBoard(0)
+		gb.Idx = idx
+		gb.manager.Config.SolveTieBreak = rule
+		alphs, answers := testAlphagrams(1)
+		for _, slot := range []int{3, 5, 8} {
+			q := &Question{OrigQuestion: alphs[0]}
+			q.populateMap()
+			gb.Slots[slot] = q
+		}
+		return gb, answers[0]
+	}
+
+	gb, answer := dupBoard(TieBreakTop, 0)
+	if got := gb.pickSolvableSlot(answer); got != 3 {
+		t.Errorf("top picked slot %d", got)
+	}
+	gb, answer = dupBoard(TieBreakBottom, 0)
+	if got := gb.pickSolvableSlot(answer); got != 8 {
+		t.Errorf("bottom picked slot %d", got)
+	}
+	if got := gb.pickSolvableSlot("nope"); got != -1 {
+		t.Errorf("a non-answer picked slot %d", got)
+	}
+
+	// Seeded is one of the candidates, and the same for the same seed.
+	first, answer := dupBoard(TieBreakSeeded, 1)
+	pick := first.pickSolvableSlot(answer)
+	if pick != 3 && pick != 5 && pick != 8 {
+		t.Fatalf("seeded picked slot %d", pick)
+	}
+	again, _ := dupBoard(TieBreakSeeded, 1)
+	if got := again.pickSolvableSlot(answer); got != pick {
+		t.Errorf("seeded picked %d, then %d", pick, got)
+	}
+
+	// Only the picked slot gets solved.
+	first.Tick()
+	if o := first.handleGuessEvent(answer); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+	for _, slot := range []int{3, 5, 8} {
+		if solved := first.Slots[slot] == nil; solved != (slot == pick) {
+			t.Errorf("slot %d solved: %v", slot, solved)
+		}
+	}
+}
+
+func TestNoAttacks(t *testing.T) {
+	for _, attacks := range []bool{true, false} {
+		gb, _ := testBoard(2)
+		if !attacks {
+			gb.manager.Config.Mode = ModeRace
+		}
+		for gb.LastStateChange.ChangeType != PieceLand {
+			gb.Tick()
+		}
+		answer := gb.Slots[NumSlots-1].OrigQuestion.Words[0].Word
+		if o := gb.handleGuessEvent(answer); o != GuessSolved {
+			t.Fatalf("guess was %q", o)
+		}
+		if gb.Slots[NumSlots-1] != nil {
+			t.Error("the solved question is still there")
+		}
+		if sent := len(gb.manager.addToOppQueue); (sent > 0) != attacks {
+			t.Errorf("attacks %v: sent %d", attacks, sent)
+		}
+	}
+}
+
+func TestCounterattack(t *testing.T) {
+	for _, counter := range []bool{false, true} {
+		gb, _ := testBoard(2)
+		if counter {
+			gb.manager.Config.Mode = ModeCounterattack
+		}
+		for gb.LastStateChange.ChangeType != PieceLand {
+			gb.Tick()
+		}
+		// The landed rack was sent over by the other board.
+		received := gb.Slots[NumSlots-1]
+		received.Whose = 1 - gb.Idx
+		if o := gb.handleGuessEvent(received.OrigQuestion.Words[0].Word); o != GuessSolved {
+			t.Fatalf("guess was %q", o)
+		}
+		if !counter {
+			if sent := len(gb.manager.addToOppQueue); sent != 0 {
+				t.Errorf("without counterattacks, clearing a received rack sent %d", sent)
+			}
+			continue
+		}
+		// Attacks go to the other board from the one they're from, so this
+		// one goes back to the sender.
+		sent := <-gb.manager.addToOppQueue
+		if sent.Whose != gb.Idx || sent.OrigQuestion.Alphagram != received.OrigQuestion.Alphagram {
+			t.Errorf("the counterattack is %s from board %d", sent.OrigQuestion.Alphagram, sent.Whose)
+		}
+	}
+}
+
+// publishedBoard is what a board's last published snapshot says.
+func publishedBoard(t *testing.T, gb *GameBoard) (b struct{ Dead, Won bool }) {
+	t.Helper()
+	bts, err := json.Marshal(gb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(bts, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestStepperLoss(t *testing.T) {
+	// More questions than slots, and nobody guessing.
+	gb, _ := testBoard(NumSlots + 1)
+	for steps := 0; !gb.Dead; steps++ {
+		if steps > 1000 {
+			t.Fatal("the board never filled up")
+		}
+		gb.StepTick()
+	}
+	if gb.LastStateChange.ChangeType != Lost {
+		t.Errorf("last change was %q", gb.LastStateChange.ChangeType)
+	}
+	if !publishedBoard(t, gb).Dead {
+		t.Error("the loss wasn't published")
+	}
+}
+
+func TestStepperWin(t *testing.T) {
+	// Let everything land, then clear it from the top down.
+	gb, _ := testBoard(3)
+	for len(gb.Queue) > 0 || gb.FallerPos != -1 {
+		gb.StepTick()
+	}
+	for slot, q := range gb.Slots {
+		if q == nil {
+			continue
+		}
+		if o := gb.StepGuess(q.OrigQuestion.Words[0].Word); o != GuessSolved {
+			t.Fatalf("solving slot %d was %q", slot, o)
+		}
+	}
+	if !gb.Won || gb.Solved != 3 {
+		t.Errorf("won %v with %d solved", gb.Won, gb.Solved)
+	}
+	if !publishedBoard(t, gb).Won {
+		t.Error("the win wasn't published")
+	}
+}
+
+func TestColorAssignment(t *testing.T) {
+	players := []string{"a", "b", "c", "d"}
+	gs := NewGameStateManager(nil, players, "", "gid", nil, testSeed(), nil)
+	again := NewGameStateManager(nil, players, "", "gid2", nil, testSeed(), nil)
+	if !slices.Equal(gs.ColorIndices, again.ColorIndices) {
+		t.Errorf("same seed, colors %v then %v", gs.ColorIndices, again.ColorIndices)
+	}
+	seen := map[int]bool{}
+	for _, c := range gs.ColorIndices {
+		if c < 0 || c >= gs.Config.NumColors || seen[c] {
+			t.Errorf("colors %v", gs.ColorIndices)
+			break
+		}
+		seen[c] = true
+	}
+
+	bts, err := json.Marshal(gs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state struct{ ColorIndices []int }
+	if err := json.Unmarshal(bts, &state); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(state.ColorIndices, gs.ColorIndices) {
+		t.Errorf("marshaled colors %v", state.ColorIndices)
+	}
+}
+
+// riseOnto fills all but the top empty slots of a board, then has an attack
+// of the given size rise onto it.
+func riseOnto(empty, attack int) *GameBoard {
+	gb, _ := testBoard(1)
+	gb.status = PieceAboutToDrop
+	alphs, _ := testAlphagrams(NumSlots + attack)
+	for i := empty; i < NumSlots; i++ {
+		gb.Slots[i] = &Question{OrigQuestion: alphs[i]}
+		gb.Slots[i].populateMap()
+	}
+	for _, alph := range alphs[NumSlots:] {
+		gb.OppQueue = append(gb.OppQueue, &Question{OrigQuestion: alph, Whose: 1})
+	}
+	gb.SetOppQueueReady()
+	gb.StepTick()
+	return gb
+}
+
+func TestOppQueueOverflowKills(t *testing.T) {
+	gb := riseOnto(2, 3)
+	if !gb.Dead {
+		t.Fatal("an attack bigger than the room left didn't kill")
+	}
+	if gb.LastStateChange.ChangeType != Lost {
+		t.Errorf("state change %q, want %q", gb.LastStateChange.ChangeType, Lost)
+	}
+}
+
+func TestOppQueueExactFillSurvives(t *testing.T) {
+	gb := riseOnto(2, 2)
+	if gb.Dead {
+		t.Fatal("an attack that just fills the board killed")
+	}
+	if sc := gb.LastStateChange; sc.ChangeType != StackRise || sc.PayloadNum != 2 {
+		t.Errorf("state change %+v, want a rise of 2", sc)
+	}
+	for i, q := range gb.Slots {
+		if q == nil {
+			t.Errorf("slot %d is empty after the rise", i)
+		}
+	}
+}
+
+func TestRevealPacing(t *testing.T) {
+	gb, clock := testBoard(0)
+	gb.manager.Config.RevealPacing = time.Second
+	q := &Question{OrigQuestion: &wordsearcher.Alphagram{Alphagram: "AEST", Words: []*wordsearcher.Word{
+		{Word: "EAST"}, {Word: "EATS"}, {Word: "SEAT"}, {Word: "TEAS"},
+	}}}
+	q.populateMap()
+	gb.Slots[NumSlots-1] = q
+
+	// Three answers in a burst all count, but only one shows.
+	for _, w := range []string{"east", "eats", "seat"} {
+		if o := gb.handleGuessEvent(w); o != GuessSolved {
+			t.Fatalf("%s was %q", w, o)
+		}
+	}
+	if q.answersLeft() != 1 || q.AnswersLeft != 3 {
+		t.Fatalf("%d answers left, %d shown", q.answersLeft(), q.AnswersLeft)
+	}
+	bts, err := json.Marshal(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bts), `"AnswersLeft":3`) {
+		t.Errorf("emitted %s", bts)
+	}
+
+	// Then the shown count catches up, one per interval.
+	if gb.paceReveals() {
+		t.Error("a reveal came too soon")
+	}
+	for _, want := range []int{2, 1} {
+		clock.Advance(time.Second)
+		if !gb.paceReveals() || q.AnswersLeft != want {
+			t.Errorf("shown %d, want %d", q.AnswersLeft, want)
+		}
+		if sc := gb.LastStateChange; sc.ChangeType != AnswersRevealed || sc.PayloadNum != NumSlots-1 {
+			t.Errorf("state change %+v", sc)
+		}
+	}
+	clock.Advance(time.Second)
+	if gb.paceReveals() {
+		t.Error("revealed past the real count")
+	}
+}
+
+func TestCompactUnderFaller(t *testing.T) {
+	for _, rides := range []bool{false, true} {
+		// [faller, X, solved, Y] at the bottom of the board.
+		gb, _ := testBoard(0)
+		gb.manager.Config.FallerRidesStack = rides
+		alphs, answers := testAlphagrams(4)
+		for i, alph := range alphs {
+			gb.Slots[NumSlots-4+i] = &Question{OrigQuestion: alph}
+			gb.Slots[NumSlots-4+i].populateMap()
+		}
+		faller, x, y := gb.Slots[NumSlots-4], gb.Slots[NumSlots-3], gb.Slots[NumSlots-1]
+		gb.FallerPos = NumSlots - 4
+
+		if o := gb.handleGuessEvent(answers[2]); o != GuessSolved {
+			t.Fatalf("rides %v: guess was %q", rides, o)
+		}
+		fallerAt := NumSlots - 4
+		if rides {
+			fallerAt = NumSlots - 3
+		}
+		if gb.FallerPos != fallerAt || gb.Slots[fallerAt] != faller {
+			t.Errorf("rides %v: faller at %d", rides, gb.FallerPos)
+		}
+		if gb.Slots[NumSlots-2] != x || gb.Slots[NumSlots-1] != y {
+			t.Errorf("rides %v: the stack didn't compact", rides)
+		}
+		if !rides && gb.Slots[NumSlots-3] != nil {
+			t.Error("no gap under the faller that stayed put")
+		}
+
+		// Either way, it lands right on the stack on the next tick.
+		gb.Tick()
+		want := StateChange{ChangeType: PieceLand, PayloadNum: NumSlots - 3, PayloadNum2: NumSlots - 4}
+		if rides {
+			want.PayloadNum2 = NumSlots - 3
+		}
+		if !reflect.DeepEqual(gb.LastStateChange, want) {
+			t.Errorf("rides %v: got %+v, want %+v", rides, gb.LastStateChange, want)
+		}
+		if gb.Slots[NumSlots-3] != faller || gb.Slots[NumSlots-2] != x || gb.Slots[NumSlots-4] != nil {
+			t.Errorf("rides %v: the faller didn't land on the stack", rides)
+		}
+	}
+}
+
+func TestFallerPosIsPublished(t *testing.T) {
+	gb, _ := testBoard(1)
+	gb.StepTick()
+	gb.StepTick()
+	var state struct{ FallerPos int }
+	if err := json.Unmarshal(*gb.snapshot.Load(), &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.FallerPos != 1 || state.FallerPos != gb.FallerPos {
+		t.Errorf("published faller at %d, board has it at %d", state.FallerPos, gb.FallerPos)
+	}
+}
+
+func TestWrongGuessWithNoRoomBelowFaller(t *testing.T) {
+	fullBoard := func(faller int) *GameBoard {
+		gb, _ := testBoard(0)
+		alphs, _ := testAlphagrams(NumSlots)
+		for i, alph := range alphs {
+			gb.Slots[i] = &Question{OrigQuestion: alph}
+			gb.Slots[i].populateMap()
+		}
+		gb.FallerPos = faller
+		gb.startTimer(TickDuration)
+		return gb
+	}
+
+	// The faller is in the top slot, on top of a full stack. A wrong guess
+	// drops it where it is.
+	gb := fullBoard(0)
+	wrong := strings.ToLower(gb.Slots[0].OrigQuestion.Alphagram)
+	if o := gb.handleGuessEvent(wrong); o != GuessPenalized {
+		t.Errorf("guess was %q", o)
+	}
+	if gb.Dead {
+		t.Error("a wrong guess killed a player with the faller on the stack")
+	}
+	if want := (StateChange{ChangeType: PieceForcedDrop}); !reflect.DeepEqual(gb.LastStateChange, want) {
+		t.Errorf("state change %+v, want %+v", gb.LastStateChange, want)
+	}
+
+	// The stack is somehow over the faller. That's no reason to die.
+	gb = fullBoard(NumSlots - 1)
+	wrong = strings.ToLower(gb.Slots[NumSlots-1].OrigQuestion.Alphagram)
+	if o := gb.handleGuessEvent(wrong); o != GuessWrongAnagram {
+		t.Errorf("guess was %q", o)
+	}
+	if gb.Dead || gb.FallerPos != NumSlots-1 {
+		t.Errorf("dead %v, faller at %d", gb.Dead, gb.FallerPos)
+	}
+}
+
+func TestLockDelay(t *testing.T) {
+	// landOne lets the first of two questions fall until it lands.
+	landOne := func() *GameBoard {
+		gb, _ := testBoard(2)
+		gb.manager.Config.LockDelay = 500 * time.Millisecond
+		for gb.LastStateChange.ChangeType != PieceLand {
+			gb.Tick()
+		}
+		if gb.status != PieceLocking || gb.FallerPos != NumSlots-1 {
+			t.Fatalf("landed with status %d, faller at %d", gb.status, gb.FallerPos)
+		}
+		if gb.topOfStack() != NumSlots {
+			t.Fatal("the locking piece is already part of the stack")
+		}
+		return gb
+	}
+
+	// Solved in time, it's cleared and counts like any solve.
+	gb := landOne()
+	if o := gb.handleGuessEvent(gb.Slots[NumSlots-1].OrigQuestion.Words[0].Word); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+	if gb.Slots[NumSlots-1] != nil || gb.Solved != 1 || gb.FallerPos != -1 || gb.status != PieceAboutToDrop {
+		t.Errorf("after a solve in the lock delay: faller %d, status %d, solved %d", gb.FallerPos, gb.status, gb.Solved)
+	}
+
+	// Left alone, it locks into the stack.
+	gb = landOne()
+	locking := gb.Slots[NumSlots-1]
+	gb.Tick()
+	if want := (StateChange{ChangeType: PieceLocked, PayloadNum: NumSlots - 1}); !reflect.DeepEqual(gb.LastStateChange, want) {
+		t.Errorf("state change %+v, want %+v", gb.LastStateChange, want)
+	}
+	if gb.Slots[NumSlots-1] != locking || gb.FallerPos != -1 || gb.topOfStack() != NumSlots-1 {
+		t.Error("the piece didn't lock into the stack")
+	}
+}
+
+func TestForcedDropLockDelay(t *testing.T) {
+	// dropOne lets the first of three questions land and lock, and then
+	// drops the second with a wrong guess as soon as it starts falling.
+	dropOne := func() (*GameBoard, *Question) {
+		gb, _ := testBoard(3)
+		gb.manager.Config.LockDelay = 500 * time.Millisecond
+		for gb.LastStateChange.ChangeType != PieceLocked {
+			gb.Tick()
+		}
+		for gb.FallerPos != 0 {
+			gb.Tick()
+		}
+		faller := gb.Slots[0]
+		if o := gb.handleGuessEvent(strings.ToLower(faller.OrigQuestion.Alphagram)); o != GuessPenalized {
+			t.Fatalf("guess was %q", o)
+		}
+		if gb.LastStateChange.ChangeType != PieceForcedDrop || gb.status != PieceLocking ||
+			gb.FallerPos != NumSlots-2 || gb.Slots[NumSlots-2] != faller {
+			t.Fatalf("after the drop: %+v, status %d, faller at %d", gb.LastStateChange, gb.status, gb.FallerPos)
+		}
+		return gb, faller
+	}
+
+	// It gets the same grace as a piece that fell there.
+	gb, dropped := dropOne()
+	if o := gb.handleGuessEvent(dropped.OrigQuestion.Words[0].Word); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+	if gb.Slots[NumSlots-2] != nil || gb.Solved != 1 || gb.FallerPos != -1 || gb.status != PieceAboutToDrop {
+		t.Errorf("after a solve in the lock delay: faller %d, status %d, solved %d", gb.FallerPos, gb.status, gb.Solved)
+	}
+
+	// Another wrong guess doesn't buy it more time.
+	gb, dropped = dropOne()
+	if o := gb.handleGuessEvent(strings.ToLower(dropped.OrigQuestion.Alphagram)); o != GuessPenalized {
+		t.Fatalf("guess was %q", o)
+	}
+	if gb.LastStateChange.ChangeType != PieceLocked || gb.FallerPos != -1 || gb.Slots[NumSlots-2] != dropped {
+		t.Errorf("after a second wrong guess: %+v, faller at %d", gb.LastStateChange, gb.FallerPos)
+	}
+}
+
+func TestShortPauseAtTheTopWithoutLockDelay(t *testing.T) {
+	// topFaller lets a piece go into slot 0 of a board that's full under it.
+	topFaller := func() *GameBoard {
+		gb, _ := testBoard(1)
+		alphs, _ := testAlphagrams(NumSlots + 1)
+		for i := 1; i < NumSlots; i++ {
+			gb.Slots[i] = &Question{OrigQuestion: alphs[i]}
+			gb.Slots[i].populateMap()
+		}
+		for gb.FallerPos != 0 {
+			gb.Tick()
+		}
+		return gb
+	}
+
+	gb := topFaller()
+	if o := gb.handleGuessEvent(gb.Slots[0].OrigQuestion.Words[0].Word); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+	if next := gb.NextTickIn(); next != TickDuration/4 {
+		t.Errorf("after solving the top faller, the next piece comes in %v", next)
+	}
+
+	gb = topFaller()
+	if o := gb.handleGuessEvent(strings.ToLower(gb.Slots[0].OrigQuestion.Alphagram)); o != GuessPenalized {
+		t.Fatalf("guess was %q", o)
+	}
+	if next := gb.NextTickIn(); next != TickDuration/4 {
+		t.Errorf("after dropping the top faller, the next piece comes in %v", next)
+	}
+}
+
+func TestSeedCommitReveal(t *testing.T) {
+	alphs, _ := testAlphagrams(TotalNumQuestions)
+	if gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil); gs.Commitment != "" {
+		t.Error("committed to a seed by default")
+	}
+	cfg := DefaultGameConfig()
+	cfg.CommitSeed = true
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", stateOut, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	var state struct {
+		Status       Status
+		Commitment   string
+		RevealedSeed string
+	}
+	first := true
+	timeout := time.After(20 * time.Second)
+	for state.Status != PermanentlyOver {
+		select {
+		case bts := <-stateOut:
+			state.RevealedSeed = ""
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("game never ended")
+		}
+		if first && state.Commitment != gs.SeedCommitment() {
+			t.Fatalf("the first state committed to %q", state.Commitment)
+		}
+		first = false
+		if state.Status != PermanentlyOver && state.RevealedSeed != "" {
+			t.Fatalf("the seed was revealed while the game was %v", state.Status)
+		}
+	}
+	if !VerifySeed(state.Commitment, state.RevealedSeed) {
+		t.Errorf("revealed seed %q doesn't match commitment %q", state.RevealedSeed, state.Commitment)
+	}
+	if seed := testSeed(); state.RevealedSeed != hex.EncodeToString(seed[:]) {
+		t.Errorf("revealed %q", state.RevealedSeed)
+	}
+	if VerifySeed(state.Commitment, strings.Repeat("00", 32)) {
+		t.Error("a different seed verified")
+	}
+}
+
+func TestDeathReasons(t *testing.T) {
+	buried := riseOnto(2, 3)
+	if buried.DeathReason != DeathBuried || buried.LastStateChange.PayloadString != string(DeathBuried) {
+		t.Errorf("an overflowing attack killed with %q, change %+v", buried.DeathReason, buried.LastStateChange)
+	}
+
+	// Nobody guessing: the stack fills up under the faller.
+	filled, _ := testBoard(NumSlots + 1)
+	for steps := 0; !filled.Dead; steps++ {
+		if steps > 1000 {
+			t.Fatal("the board never filled up")
+		}
+		filled.StepTick()
+	}
+	if r := filled.DeathReason; r != DeathStackFull && r != DeathNoRoomForFaller {
+		t.Errorf("a full board died with %q", r)
+	}
+	if filled.LastStateChange.PayloadString != string(filled.DeathReason) {
+		t.Errorf("the loss said %q, the board %q", filled.LastStateChange.PayloadString, filled.DeathReason)
+	}
+
+	gs := filled.manager
+	survivor := newGameBoard(1, gs)
+	gs.Boards = []*GameBoard{filled, survivor}
+	res := gs.computeResult("")
+	if !slices.Equal(res.DeathReasons, []DeathReason{filled.DeathReason, ""}) {
+		t.Errorf("result death reasons %q", res.DeathReasons)
+	}
+}
+
+func TestReviewPhase(t *testing.T) {
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.ReviewPhase = 10 * time.Second
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", nil, testSeed(), cfg)
+	// The boards' last changes can go out again once a round is over.
+	statuses := slices.Compact(watchStatuses(t, gs, func(s Status) bool { return s == PermanentlyOver }))
+	i := slices.Index(statuses, Reviewing)
+	if i < 1 || statuses[i-1] != Playing || i+1 >= len(statuses) || statuses[i+1] != Countdown {
+		t.Errorf("statuses %v, want a review between playing and the countdown", statuses)
+	}
+}
+
+func TestReadyEndsReview(t *testing.T) {
+	alphs, _ := testAlphagrams(2 * TotalNumQuestions)
+	cfg := DefaultGameConfig()
+	cfg.ReviewPhase = time.Hour
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid", stateOut, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	go runClock(clock, stop)
+
+	next := func() Status {
+		t.Helper()
+		select {
+		case bts := <-stateOut:
+			var state struct{ Status Status }
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			return state.Status
+		case <-time.After(20 * time.Second):
+			t.Fatal("timed out waiting for a state")
+		}
+		return 0
+	}
+	for next() != Reviewing {
+	}
+	// Nothing moves on by itself from here.
+	close(stop)
+	if err := gs.Ready("c"); err == nil {
+		t.Error("someone not in the game said they were ready")
+	}
+	gs.Ready("a")
+	gs.Ready("b")
+	s := next()
+	for s == Reviewing {
+		s = next()
+	}
+	if s != Countdown {
+		t.Errorf("once everyone was ready, the status went to %v", s)
+	}
+	gs.EndNow("test")
+	for next() != Finished {
+	}
+}
+
+func TestNoDeath(t *testing.T) {
+	// The same board that TestStepperLoss fills up, with nobody guessing.
+	gb, _ := testBoard(NumSlots + 1)
+	gb.manager.Config.NoDeath = true
+	for range 1000 {
+		gb.StepTick()
+	}
+	if gb.Dead || gb.LastStateChange.ChangeType == Lost {
+		t.Fatalf("the board died: %+v", gb.LastStateChange)
+	}
+	if gb.topOfStack() != 0 {
+		t.Errorf("the stack only got to %d", gb.topOfStack())
+	}
+
+	// Attacks that don't fit just get pushed off the top.
+	gb, _ = testBoard(1)
+	gb.manager.Config.NoDeath = true
+	gb.status = PieceAboutToDrop
+	alphs, _ := testAlphagrams(NumSlots + 3)
+	for i := 2; i < NumSlots; i++ {
+		gb.Slots[i] = &Question{OrigQuestion: alphs[i]}
+		gb.Slots[i].populateMap()
+	}
+	for _, alph := range alphs[NumSlots:] {
+		gb.OppQueue = append(gb.OppQueue, &Question{OrigQuestion: alph, Whose: 1})
+	}
+	gb.SetOppQueueReady()
+	gb.StepTick()
+	if gb.Dead || gb.Slots[0] == nil {
+		t.Errorf("an overflowing attack left the board dead %v, top slot %v", gb.Dead, gb.Slots[0])
+	}
+}
+
+func TestAttackTargets(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	for from, want := range []int{1, 0} {
+		if got, err := gs.attackTargets(from); err != nil || !slices.Equal(got, []int{want}) {
+			t.Errorf("attack from %d went to %v (%v)", from, got, err)
+		}
+	}
+	if _, err := gs.attackTargets(2); !errors.Is(err, ErrBadPlayerOrder) {
+		t.Errorf("attack from a board that isn't there: %v", err)
+	}
+	gs.Boards = gs.Boards[:1]
+	if _, err := gs.attackTargets(0); !errors.Is(err, ErrBadPlayerOrder) {
+		t.Errorf("attack with nobody to attack: %v", err)
+	}
+}
+
+func TestAttackTargetsThreePlayers(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b", "c"}, "", "gid", nil, testSeed(), nil)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs), newGameBoard(2, gs)}
+	gs.exitedboards = make([]bool, 3)
+	for from, want := range []int{1, 2, 0} {
+		if got, err := gs.attackTargets(from); err != nil || !slices.Equal(got, []int{want}) {
+			t.Errorf("attack from %d went to %v (%v)", from, got, err)
+		}
+	}
+	// Once a board is out, its attacks skip ahead to the next one still in.
+	gs.exitedboards[2] = true
+	if got, _ := gs.attackTargets(1); !slices.Equal(got, []int{0}) {
+		t.Errorf("attack from 1 went to %v, want [0]", got)
+	}
+	if gs.roundOver(2) {
+		t.Error("round over with two boards still in")
+	}
+	gs.exitedboards[0] = true
+	if got, _ := gs.attackTargets(1); len(got) != 0 {
+		t.Errorf("attack with everyone else out went to %v", got)
+	}
+	alphs, _ := testAlphagrams(1)
+	gs.routeAttack(&Question{OrigQuestion: alphs[0], Whose: 1})
+	if n := gs.Boards[1].AttacksSent; n != 0 {
+		t.Errorf("an attack that went nowhere counted %d times", n)
+	}
+	if !gs.roundOver(0) {
+		t.Error("round not over with one board left")
+	}
+}
+
+func TestSpreadAttacks(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.SpreadAttacks = true
+	gs := NewGameStateManager(nil, []string{"a", "b", "c"}, "", "gid", nil, testSeed(), cfg)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs), newGameBoard(2, gs)}
+	alphs, _ := testAlphagrams(1)
+	q := &Question{OrigQuestion: alphs[0], Whose: 1}
+	q.populateMap()
+	gs.routeAttack(q)
+	if n := gs.Boards[1].AttacksSent; n != 1 {
+		t.Errorf("an attack on two boards counted %d times", n)
+	}
+
+	if len(gs.Boards[1].inbox) != 0 {
+		t.Errorf("the sender was attacked with %d racks", len(gs.Boards[1].inbox))
+	}
+	got := []*Question{}
+	for _, i := range []int{0, 2} {
+		if len(gs.Boards[i].inbox) != 1 {
+			t.Fatalf("board %d got %d racks, want 1", i, len(gs.Boards[i].inbox))
+		}
+		got = append(got, gs.Boards[i].inbox[0])
+	}
+	if got[0] == got[1] {
+		t.Fatal("both boards got the same rack")
+	}
+	for _, a := range got {
+		if a.Whose != 1 || a.OrigQuestion.Alphagram != alphs[0].Alphagram || len(a.AnswerMap) != 1 {
+			t.Errorf("got rack %+v", a)
+		}
+	}
+	// Solving it on one board leaves it alone on the other.
+	clear(got[0].AnswerMap)
+	if len(got[1].AnswerMap) != 1 {
+		t.Error("the racks share their answers")
+	}
+
+	// Without spreading, it's just the next board along.
+	gs.Config.SpreadAttacks = false
+	for from, want := range []int{1, 2, 0} {
+		if got, err := gs.attackTargets(from); err != nil || !slices.Equal(got, []int{want}) {
+			t.Errorf("attack from %d went to %v (%v)", from, got, err)
+		}
+	}
+}
+
+// creepingClock is a ManualClock that moves on a little every time it's
+// read, the way a real clock does while a game sets up.
+type creepingClock struct {
+	*ManualClock
+}
+
+func (c creepingClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	c.now = c.now.Add(time.Millisecond)
+	return c.now
+}
+
+func TestSyncStart(t *testing.T) {
+	for _, sync := range []bool{false, true} {
+		cfg := DefaultGameConfig()
+		cfg.SyncStart = sync
+		alphs, _ := testAlphagrams(TotalNumQuestions)
+		stateOut := make(chan []byte)
+		gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, fakeWordDB(t, alphs), "gid",
+			stateOut, testSeed(), cfg)
+		clock := creepingClock{NewManualClock(testEpoch)}
+		gs.SetClock(clock)
+		gs.StartGameCountdown()
+		clock.Advance(InitGameCountdownTime)
+		for {
+			var state struct{ Status Status }
+			if err := json.Unmarshal(<-stateOut, &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.Status == Playing {
+				break
+			}
+		}
+		go func() {
+			for range stateOut {
+			}
+		}()
+		var firstTicks []time.Time
+		for _, gb := range gs.boards() {
+			gb.Lock()
+			firstTicks = append(firstTicks, gb.nextTickAt)
+			gb.Unlock()
+		}
+		if inStep := firstTicks[0].Equal(firstTicks[1]); inStep != sync {
+			t.Errorf("with SyncStart %v, the first ticks were at %v", sync, firstTicks)
+		}
+		gs.EndNow("test")
+	}
+}
+
+func TestGuessTooLong(t *testing.T) {
+	cfg := DefaultGameConfig()
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+	// No boards yet, so a guess that got past the check would fail some
+	// other way.
+	if err := gs.Guess("a", strings.Repeat("A", 1000)); !errors.Is(err, ErrGuessTooLong) {
+		t.Errorf("a 1000-letter guess: %v", err)
+	}
+
+	gs, _, _ = playingGame(t, cfg)
+	defer gs.EndNow("test")
+	// The test questions are four letters long.
+	if err := gs.Guess("a", "ABCDE"); !errors.Is(err, ErrGuessTooLong) {
+		t.Errorf("a guess longer than every question: %v", err)
+	}
+	if err := gs.Guess("a", "ABCD"); errors.Is(err, ErrGuessTooLong) {
+		t.Errorf("a guess as long as the questions: %v", err)
+	}
+}
+
+func TestTimestampChanges(t *testing.T) {
+	gb, clock := testBoard(2)
+	gb.manager.Config.TimestampChanges = true
+	for i := 0; gb.LastStateChange.ChangeType != PieceLand; i++ {
+		gb.Tick()
+		if i == 2 {
+			// The wall clock stepping back doesn't show.
+			clock.Advance(-time.Minute)
+		} else {
+			clock.Advance(TickDuration)
+		}
+	}
+	history := gb.manager.RecentHistory(NumSlots)
+	if len(history) < 3 || history[0].Change.OccurredAt != testEpoch.UnixMilli() {
+		t.Fatalf("history %+v", history)
+	}
+	for i := 1; i < len(history); i++ {
+		if history[i].Change.OccurredAt < history[i-1].Change.OccurredAt {
+			t.Errorf("change %d happened at %d, before the one before it", i, history[i].Change.OccurredAt)
+		}
+	}
+	if gb.LastStateChange.OccurredAt != history[len(history)-1].Change.OccurredAt {
+		t.Error("the board's last state change isn't stamped")
+	}
+
+	gb, _ = testBoard(1)
+	gb.Tick()
+	if at := gb.LastStateChange.OccurredAt; at != 0 {
+		t.Errorf("a change was stamped %d with timestamps off", at)
+	}
+}
+
+func TestSaturatedAttacksDontBlock(t *testing.T) {
+	// No manager loop is running, so nothing takes the attacks off its
+	// queue, which fills up.
+	gb, _ := testBoard(0)
+	gb.manager.addToOppQueue = make(chan *Question, 8)
+	alphs, answers := testAlphagrams(NumSlots)
+	for i, alph := range alphs {
+		q := &Question{OrigQuestion: alph}
+		q.populateMap()
+		gb.Slots[i] = q
+	}
+	guessed := make(chan struct{})
+	go func() {
+		defer close(guessed)
+		for _, a := range answers {
+			gb.StepGuess(a)
+		}
+	}()
+	select {
+	case <-guessed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("solving got stuck on the full attack queue")
+	}
+	queue := gb.manager.addToOppQueue
+	if len(queue) != cap(queue) || len(gb.unsentAttacks) != len(answers)-cap(queue) {
+		t.Fatalf("%d attacks queued and %d held back, want %d and %d",
+			len(queue), len(gb.unsentAttacks), cap(queue), len(answers)-cap(queue))
+	}
+
+	// Once the manager takes them, the held back attacks go too.
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		gb.flushAttacks()
+	}()
+	sent := 0
+	for sent < len(answers) {
+		select {
+		case <-queue:
+			sent++
+		case <-time.After(2 * time.Second):
+			t.Fatalf("only %d of %d attacks arrived", sent, len(answers))
+		}
+	}
+	<-flushed
+}
+
+func TestAttackIsACopy(t *testing.T) {
+	gb, _ := testBoard(2)
+	gb.manager.Config.RedactQueuedAttacks = false
+	for gb.LastStateChange.ChangeType != PieceLand {
+		gb.Tick()
+	}
+	solved := gb.Slots[NumSlots-1]
+	if o := gb.handleGuessEvent(solved.OrigQuestion.Words[0].Word); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+	sent := <-gb.manager.addToOppQueue
+	if sent == solved || reflect.ValueOf(sent.AnswerMap).Pointer() == reflect.ValueOf(solved.AnswerMap).Pointer() {
+		t.Fatal("the attack shares its question with the sender")
+	}
+	if len(sent.AnswerMap) != len(solved.OrigQuestion.Words) {
+		t.Errorf("the attack has %d answers, want all %d", len(sent.AnswerMap), len(solved.OrigQuestion.Words))
+	}
+
+	// The sender going on with its question doesn't touch the opponent's,
+	// as the race detector would see.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gb.Lock()
+		solved.populateMap()
+		solved.AnswersLeft = 0
+		gb.Unlock()
+	}()
+	for range sent.AnswerMap {
+	}
+	_ = sent.AnswersLeft
+	<-done
+}
+
+func TestEmptyQueue(t *testing.T) {
+	for _, hold := range []bool{false, true} {
+		// Both pieces land, and there are no more coming.
+		gb, _ := testBoard(2)
+		gb.manager.Config.HoldRisesWhenQueueEmpty = hold
+		for gb.status != PlayerQueueEmpty {
+			gb.Tick()
+		}
+		if gb.Won {
+			t.Fatal("running out of pieces won the game")
+		}
+
+		// An attack is ready to rise.
+		alphs, _ := testAlphagrams(3)
+		attack := &Question{OrigQuestion: alphs[2], Whose: 1}
+		attack.populateMap()
+		gb.OppQueue = append(gb.OppQueue, attack)
+		gb.SetOppQueueReady()
+		gb.Tick()
+		if risen := gb.LastStateChange.ChangeType == StackRise; risen == hold {
+			t.Errorf("hold %v: the attack rose %v", hold, risen)
+		}
+
+		// Whatever's on the board, cleared, wins it.
+		for _, q := range slices.Clone(gb.Slots[:]) {
+			if q != nil {
+				if o := gb.handleGuessEvent(q.OrigQuestion.Words[0].Word); o != GuessSolved {
+					t.Fatalf("guess was %q", o)
+				}
+			}
+		}
+		if !gb.Won {
+			t.Errorf("hold %v: clearing the board didn't win", hold)
+		}
+	}
+}
+
+func TestScramble(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.ScrambleEvery = 10 * time.Second
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	alphs, _ := testAlphagrams(6)
+	for i, alph := range alphs {
+		q := &Question{OrigQuestion: alph, Whose: i % 2}
+		q.populateMap()
+		gs.Boards[i%2].Slots[NumSlots-1-i/2] = q
+	}
+	gs.startScrambles()
+
+	clock.Advance(cfg.ScrambleEvery - time.Millisecond)
+	select {
+	case <-gs.scrambleC():
+		t.Fatal("scrambled early")
+	default:
+	}
+	clock.Advance(time.Millisecond)
+	select {
+	case <-gs.scrambleC():
+	default:
+		t.Fatal("didn't scramble on time")
+	}
+	gs.scramble()
+
+	for _, gb := range gs.Boards {
+		var pub struct{ Slots []*Question }
+		bts, _ := gb.MarshalJSON()
+		if err := json.Unmarshal(bts, &pub); err != nil {
+			t.Fatal(err)
+		}
+		moved := false
+		for _, q := range pub.Slots {
+			if q == nil {
+				continue
+			}
+			if len(q.DisplayOrder) != 4 {
+				t.Fatalf("board %d: %s has display order %v", gb.Idx, q.OrigQuestion.Alphagram, q.DisplayOrder)
+			}
+			shown := []rune(q.Display())
+			slices.Sort(shown)
+			if string(shown) != q.OrigQuestion.Alphagram {
+				t.Errorf("board %d: %s is shown as %s", gb.Idx, q.OrigQuestion.Alphagram, q.Display())
+			}
+			moved = moved || q.Display() != q.OrigQuestion.Alphagram
+		}
+		if !moved {
+			t.Errorf("board %d: nothing was scrambled", gb.Idx)
+		}
+	}
+	// The answers are still the answers.
+	q := gs.Boards[0].Slots[NumSlots-1]
+	if outcome, _ := solveQuestion(q, alphs[0].Words[0].Word); outcome != GuessSolved {
+		t.Errorf("the answer to a scrambled rack got %v", outcome)
+	}
+	// The next one's lined up.
+	clock.Advance(cfg.ScrambleEvery)
+	select {
+	case <-gs.scrambleC():
+	default:
+		t.Fatal("didn't scramble again")
+	}
+}
@@ -0,0 +1,75 @@
+package game
+
+// A HistoryEntry is a state change that happened on one of the boards.
+type HistoryEntry struct {
+	Board  int
+	Change StateChange
+}
+
+// setStateChange sets the board's last state change and records it in the
+// game's history. The board must be locked.
+func (gb *GameBoard) setStateChange(sc StateChange) {
+	gb.LastStateChange = gb.manager.recordHistory(HistoryEntry{Board: gb.Idx, Change: sc}).Change
+}
+
+// recordHistory adds the entry to the history, stamping it with the time if
+// the game is set up to, and returns it.
+func (gs *GameStateManager) recordHistory(e HistoryEntry) HistoryEntry {
+	gs.historyMu.Lock()
+	defer gs.historyMu.Unlock()
+	if gs.Config.TimestampChanges {
+		// The boards stamp their changes in the order they record them, so
+		// a wall clock step back mustn't show.
+		gs.lastOccurredAt = max(gs.lastOccurredAt, gs.clock.Now().UnixMilli())
+		e.Change.OccurredAt = gs.lastOccurredAt
+	}
+	if limit := gs.Config.MaxHistory; limit > 0 && len(gs.history) >= limit {
+		// This one takes the oldest one's place.
+		if gs.Config.ArchiveHistory {
+			gs.archived = append(gs.archived, gs.history[gs.historyHead])
+		}
+		gs.history[gs.historyHead] = e
+		gs.historyHead = (gs.historyHead + 1) % len(gs.history)
+		return e
+	}
+	gs.history = append(gs.history, e)
+	return e
+}
+
+// historyAt returns the i'th oldest entry in the history. historyMu must be
+// held.
+func (gs *GameStateManager) historyAt(i int) HistoryEntry {
+	return gs.history[(gs.historyHead+i)%len(gs.history)]
+}
+
+// HistorySize returns how many state changes are in the history.
+func (gs *GameStateManager) HistorySize() int {
+	gs.historyMu.Lock()
+	defer gs.historyMu.Unlock()
+	return len(gs.history)
+}
+
+func (gs *GameStateManager) resetHistory() {
+	gs.historyMu.Lock()
+	defer gs.historyMu.Unlock()
+	gs.history = nil
+	gs.historyHead = 0
+	gs.archived = nil
+	gs.guesses = nil
+	gs.roundStartedAt = gs.clock.Now()
+}
+
+// RecentHistory returns up to the last k state changes of the current round,
+// oldest first.
+func (gs *GameStateManager) RecentHistory(k int) []HistoryEntry {
+	gs.historyMu.Lock()
+	defer gs.historyMu.Unlock()
+	if k > len(gs.history) {
+		k = len(gs.history)
+	}
+	recent := make([]HistoryEntry, k)
+	for i := range recent {
+		recent[i] = gs.historyAt(len(gs.history) - k + i)
+	}
+	return recent
+}
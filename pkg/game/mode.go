@@ -0,0 +1,223 @@
+package game
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// A Mode is a set of rules for how a round plays out. The manager and the
+// boards call into it wherever the rules can differ, so a new mode doesn't
+// need a new flag threaded through the game loop. Modes are shared between
+// games, so anything they keep track of has to live on the boards.
+//
+// The GameBoard hooks are called with the board locked. The others are
+// called from the manager loop.
+type Mode interface {
+	// OnDeal picks the board that the i-th question dealt goes to.
+	OnDeal(i, numBoards int) int
+	// OnSolve says whether the fully solved question goes on to be sent as
+	// an attack.
+	OnSolve(gb *GameBoard, q *Question) bool
+	// OnAttack picks the boards that an attack lands on, or returns none to
+	// drop it. q.Whose is the board that sent it.
+	OnAttack(gs *GameStateManager, q *Question) []int
+	// OnDeath says whether the board really dies for the given reason.
+	OnDeath(gb *GameBoard, reason DeathReason) bool
+	// CheckWin says whether the board has won.
+	CheckWin(gb *GameBoard) bool
+	// OnExit says whether the board that just left the round, having won
+	// or died, ends it for everyone still in it.
+	OnExit(gs *GameStateManager, idx int) bool
+	// OnResult gets the last word on the round's result, once the boards
+	// have all exited and computeResult has decided it the usual way.
+	OnResult(gs *GameStateManager, res *GameResult)
+}
+
+// The built-in modes, by name.
+const (
+	ModeClassic       = "classic"
+	ModeRace          = "race"
+	ModeCounterattack = "counterattack"
+	ModeSolo          = "solo"
+	ModeCoop          = "coop"
+)
+
+var (
+	modesMu sync.RWMutex
+	modes   = map[string]Mode{
+		ModeClassic:       ClassicMode{},
+		ModeRace:          RaceMode{},
+		ModeCounterattack: CounterattackMode{},
+		ModeSolo:          SoloMode{},
+		ModeCoop:          CoopMode{},
+	}
+)
+
+// RegisterMode adds a mode under the given name, for GameConfig.Mode. It's
+// usually called from an init function, but it's safe to call any time.
+func RegisterMode(name string, m Mode) {
+	modesMu.Lock()
+	defer modesMu.Unlock()
+	modes[name] = m
+}
+
+// IsMode says whether there's a mode with the given name.
+func IsMode(name string) bool {
+	modesMu.RLock()
+	defer modesMu.RUnlock()
+	_, ok := modes[name]
+	return ok
+}
+
+// mode returns the game's mode. Games without one, or with one that's gone
+// missing, are classic.
+func (gs *GameStateManager) mode() Mode {
+	modesMu.RLock()
+	defer modesMu.RUnlock()
+	if m, ok := modes[gs.Config.Mode]; ok {
+		return m
+	}
+	return ClassicMode{}
+}
+
+// ClassicMode is the usual game: questions are dealt out in turn, solving
+// your own sends it to the opponent, and you win by clearing your board.
+type ClassicMode struct{}
+
+func (ClassicMode) OnDeal(i, numBoards int) int {
+	return i % numBoards
+}
+
+// OnSolve attacks with the board's own questions.
+func (ClassicMode) OnSolve(gb *GameBoard, q *Question) bool {
+	return q.Whose == gb.Idx
+}
+
+// OnAttack sends the attack to the next board still in the round, or with
+// SpreadAttacks, to all of them; see attackTargets.
+func (ClassicMode) OnAttack(gs *GameStateManager, q *Question) []int {
+	opps, err := gs.attackTargets(q.Whose)
+	if err != nil {
+		log.Err(err).Str("gid", gs.ID).Msg("attack-dropped")
+		return nil
+	}
+	return opps
+}
+
+func (ClassicMode) OnDeath(gb *GameBoard, reason DeathReason) bool {
+	return true
+}
+
+// CheckWin is true once the queue and the board are both empty. The opp
+// queue doesn't count.
+func (ClassicMode) CheckWin(gb *GameBoard) bool {
+	if len(gb.Queue) > 0 {
+		return false
+	}
+	for i := range gb.Slots {
+		if gb.Slots[i] != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// OnExit ends the round if the board won, or if there's at most one board
+// left in. With two players, the round is over as soon as either of them is
+// out.
+func (ClassicMode) OnExit(gs *GameStateManager, idx int) bool {
+	gb := gs.Boards[idx]
+	gb.Lock()
+	won := gb.Won
+	gb.Unlock()
+	left := 0
+	for i := range gs.Boards {
+		if !gs.boardOut(i) {
+			left++
+		}
+	}
+	return won || left <= 1
+}
+
+func (ClassicMode) OnResult(gs *GameStateManager, res *GameResult) {}
+
+// RaceMode is classic without the attacks: everyone races to clear their
+// own board first.
+type RaceMode struct {
+	ClassicMode
+}
+
+func (RaceMode) OnSolve(gb *GameBoard, q *Question) bool {
+	return false
+}
+
+// CounterattackMode is classic, except that the racks sent to you go back
+// to the sender when you clear them too, so attacks can go back and forth.
+type CounterattackMode struct {
+	ClassicMode
+}
+
+func (CounterattackMode) OnSolve(gb *GameBoard, q *Question) bool {
+	return true
+}
+
+// SoloMode has everyone play their own board on their own: nothing gets
+// sent, and nobody else clearing their board or dying ends the round for
+// you. The round goes on until everyone's out of it, and whoever scored the
+// most takes it.
+type SoloMode struct {
+	ClassicMode
+}
+
+func (SoloMode) OnSolve(gb *GameBoard, q *Question) bool {
+	return false
+}
+
+func (SoloMode) OnExit(gs *GameStateManager, idx int) bool {
+	return false
+}
+
+// OnResult decides the round on score, even if someone cleared their board
+// or outlived the rest.
+func (SoloMode) OnResult(gs *GameStateManager, res *GameResult) {
+	if res.Reason == ResultCleared || res.Reason == ResultSurvived {
+		res.Winner = topScorer(res.Scores)
+		res.Reason = ResultScore
+	}
+}
+
+// CoopMode puts everyone on one team against the stack. Nothing gets sent
+// between teammates. The team clears the round once every board is clear,
+// and loses it as soon as any board dies. Nobody wins a round on their own,
+// so either way it has no winner; see ResultTeamCleared.
+type CoopMode struct {
+	ClassicMode
+}
+
+func (CoopMode) OnSolve(gb *GameBoard, q *Question) bool {
+	return false
+}
+
+// OnExit ends the round for the whole team once a board dies. A board that
+// cleared waits on the rest.
+func (CoopMode) OnExit(gs *GameStateManager, idx int) bool {
+	gb := gs.Boards[idx]
+	gb.Lock()
+	defer gb.Unlock()
+	return gb.Dead
+}
+
+func (CoopMode) OnResult(gs *GameStateManager, res *GameResult) {
+	if res.Reason == ResultMaintenance {
+		return
+	}
+	res.Winner = NoWinner
+	res.Reason = ResultTeamCleared
+	for _, gb := range gs.Boards {
+		if !gb.Won {
+			res.Reason = ResultTeamLost
+			return
+		}
+	}
+}
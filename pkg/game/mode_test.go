@@ -0,0 +1,172 @@
+package game
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// firstSolveMode is classic, except that the first board to fully solve a
+// question wins.
+type firstSolveMode struct {
+	ClassicMode
+}
+
+func (firstSolveMode) CheckWin(gb *GameBoard) bool {
+	return gb.Solved > 0
+}
+
+func init() {
+	RegisterMode("firstsolve", firstSolveMode{})
+}
+
+// solveLanded lets the board's first question land and then solves it.
+func solveLanded(t *testing.T, gb *GameBoard) {
+	t.Helper()
+	for gb.LastStateChange.ChangeType != PieceLand {
+		gb.Tick()
+	}
+	if o := gb.handleGuessEvent(gb.Slots[NumSlots-1].OrigQuestion.Words[0].Word); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+}
+
+func TestClassicMode(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	for _, name := range []string{"", ModeClassic, "nosuchmode"} {
+		gs.Config.Mode = name
+		if _, ok := gs.mode().(ClassicMode); !ok {
+			t.Errorf("mode %q plays as %T", name, gs.mode())
+		}
+	}
+	m := gs.mode()
+	for i, want := range []int{0, 1, 0, 1} {
+		if got := m.OnDeal(i, len(gs.Boards)); got != want {
+			t.Errorf("question %d dealt to %d, want %d", i, got, want)
+		}
+	}
+	for from, want := range []int{1, 0} {
+		if got := m.OnAttack(gs, &Question{Whose: from}); len(got) != 1 || got[0] != want {
+			t.Errorf("attack from %d went to %v, want %d", from, got, want)
+		}
+	}
+	if m.OnSolve(gs.Boards[0], &Question{Whose: 1}) || !m.OnSolve(gs.Boards[0], &Question{Whose: 0}) {
+		t.Error("classic attacks with the wrong questions")
+	}
+
+	// One solve is a long way from a win.
+	gb, _ := testBoard(3)
+	solveLanded(t, gb)
+	if gb.Won || len(gb.manager.addToOppQueue) != 1 {
+		t.Errorf("after one solve, won %v, %d attacks sent", gb.Won, len(gb.manager.addToOppQueue))
+	}
+}
+
+func TestRaceMode(t *testing.T) {
+	gb, _ := testBoard(3)
+	gb.manager.Config.Mode = ModeRace
+	solveLanded(t, gb)
+	if sent := len(gb.manager.addToOppQueue); sent != 0 {
+		t.Errorf("a race sent %d attacks", sent)
+	}
+}
+
+func TestCustomModeWins(t *testing.T) {
+	gb, _ := testBoard(3)
+	gb.manager.Config.Mode = "firstsolve"
+	solveLanded(t, gb)
+	if !gb.Won {
+		t.Error("the custom win condition didn't count")
+	}
+}
+
+func TestRegisterModeWhilePlaying(t *testing.T) {
+	// Run with -race: games look modes up while others get registered.
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterMode(fmt.Sprintf("late%d", i), RaceMode{})
+		}()
+		go func() {
+			defer wg.Done()
+			gs.mode()
+		}()
+	}
+	wg.Wait()
+	if !IsMode("late9") {
+		t.Error("a mode registered late isn't there")
+	}
+}
+
+func TestSoloMode(t *testing.T) {
+	gb, _ := testBoard(3)
+	gb.manager.Config.Mode = ModeSolo
+	solveLanded(t, gb)
+	if sent := len(gb.manager.addToOppQueue); sent != 0 {
+		t.Errorf("a solo game sent %d attacks", sent)
+	}
+
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Config.Mode = ModeSolo
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	gs.exitedboards = make([]bool, 2)
+	gs.Boards[0].Won = true
+	gs.Boards[0].Solved = 1
+	gs.exitedboards[0] = true
+	if gs.roundOver(0) {
+		t.Error("clearing a board ended the round for everyone")
+	}
+	gs.Boards[1].Dead = true
+	gs.Boards[1].Solved = 3
+	if res := gs.computeResult(""); res.Winner != 1 || res.Reason != ResultScore {
+		t.Errorf("won by %d (%s), want the top scorer", res.Winner, res.Reason)
+	}
+}
+
+func TestCoopMode(t *testing.T) {
+	gb, _ := testBoard(3)
+	gb.manager.Config.Mode = ModeCoop
+	solveLanded(t, gb)
+	if sent := len(gb.manager.addToOppQueue); sent != 0 {
+		t.Errorf("a co-op game sent %d attacks", sent)
+	}
+
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Config.Mode = ModeCoop
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	gs.exitedboards = make([]bool, 2)
+	gs.Boards[0].Won = true
+	gs.exitedboards[0] = true
+	if gs.roundOver(0) {
+		t.Error("one board clearing ended the round for the team")
+	}
+	gs.Boards[1].Dead = true
+	if !gs.roundOver(1) {
+		t.Error("a board dying didn't end the round for the team")
+	}
+	if res := gs.computeResult(""); res.Winner != NoWinner || res.Reason != ResultTeamLost || res.IsDraw() {
+		t.Errorf("with a board dead, the result is %+v", res)
+	}
+
+	gs.Boards[1].Dead = false
+	gs.Boards[1].Won = true
+	gs.Result = gs.computeResult("")
+	if gs.Result.Winner != NoWinner || gs.Result.Reason != ResultTeamCleared || gs.Result.IsDraw() {
+		t.Errorf("with every board cleared, the result is %+v", gs.Result)
+	}
+	gs.countRound()
+	if !slices.Equal(gs.RoundsWon, []int{1, 1}) {
+		t.Errorf("rounds won %v, want the clear to count for both", gs.RoundsWon)
+	}
+	var results []PlayerResult
+	gs.SetResultSink(func(r PlayerResult) { results = append(results, r) })
+	gs.saveResults()
+	if len(results) != 2 || !results[0].Won || !results[1].Won {
+		t.Errorf("the team's results are %+v", results)
+	}
+}
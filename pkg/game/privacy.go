@@ -0,0 +1,239 @@
+package game
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// A BoardSummary is what a player sees of a private opponent's board: how
+// they're doing, but not the board itself.
+type BoardSummary struct {
+	Idx     int
+	Private bool
+	Solved  int
+	// Danger is how high the stack is, from 0 (empty) to the number of
+	// slots (full).
+	Danger int
+	Dead   bool
+	// DeathReason is why the board died, if it did.
+	DeathReason DeathReason `json:",omitempty"`
+	Won         bool
+}
+
+func summarizeBoard(gb *GameBoard) BoardSummary {
+	danger := 0
+	for _, q := range gb.Slots {
+		if q != nil {
+			danger++
+		}
+	}
+	return BoardSummary{
+		Idx:     gb.Idx,
+		Private: true,
+		Solved:  gb.Solved,
+		Danger:  danger,
+		Dead:    gb.Dead,
+		Won:     gb.Won,
+
+		DeathReason: gb.DeathReason,
+	}
+}
+
+// HiddenBoardsFor returns the indices of the boards that the given player
+// shouldn't see in full: every other player's board that is private.
+func HiddenBoardsFor(gsm *GameStateManager, player string) []int {
+	if gsm.Config == nil {
+		return nil
+	}
+	hidden := []int{}
+	for i, p := range gsm.Players {
+		if p != player && slices.Contains(gsm.Config.PrivatePlayers, p) {
+			hidden = append(hidden, i)
+		}
+	}
+	return hidden
+}
+
+// StateFor tailors a marshaled game state for the given player: it tells
+// them which board is theirs, and hides the boards they shouldn't see in
+// full. With HideOpponentProgress, the opponents' boards show how many
+// answers each question started with, not how many are left. With FaceDown,
+// the player's own queue is dealt face down. Anyone who isn't playing gets
+// the state as it is; see SpectatorState for what to send them.
+func StateFor(state []byte, gsm *GameStateManager, player string) ([]byte, error) {
+	idx := slices.Index(gsm.Players, player)
+	if idx < 0 {
+		return state, nil
+	}
+	hidden := HiddenBoardsFor(gsm, player)
+	if len(hidden) > 0 {
+		var err error
+		state, err = RedactBoards(state, hidden)
+		if err != nil {
+			return nil, err
+		}
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(state, &fields); err != nil {
+		return nil, err
+	}
+	if gsm.Config != nil && (gsm.Config.HideOpponentProgress || gsm.Config.FaceDown) {
+		err := rewriteBoards(fields, func(i int) func(*boardJSON) {
+			switch {
+			case i == idx && gsm.Config.FaceDown:
+				return dealFaceDown
+			case i != idx && gsm.Config.HideOpponentProgress && !slices.Contains(hidden, i):
+				return hideProgress
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	fields["YourBoard"] = json.RawMessage(strconv.Itoa(idx))
+	return json.Marshal(fields)
+}
+
+// SpectatorState tailors a marshaled game state for someone watching the
+// game who isn't playing in it. They see no more than the players see of
+// each other: private boards are only summaries, with HideOpponentProgress
+// no board shows what's left, and with FaceDown every queue is face down.
+func SpectatorState(state []byte, gsm *GameStateManager) ([]byte, error) {
+	cfg := gsm.Config
+	if cfg == nil {
+		return state, nil
+	}
+	hidden := []int{}
+	for i, p := range gsm.Players {
+		if slices.Contains(cfg.PrivatePlayers, p) {
+			hidden = append(hidden, i)
+		}
+	}
+	if len(hidden) > 0 {
+		var err error
+		state, err = RedactBoards(state, hidden)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.HideOpponentProgress && !cfg.FaceDown {
+		return state, nil
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(state, &fields); err != nil {
+		return nil, err
+	}
+	err := rewriteBoards(fields, func(i int) func(*boardJSON) {
+		if slices.Contains(hidden, i) {
+			return nil
+		}
+		return func(gb *boardJSON) {
+			if cfg.HideOpponentProgress {
+				hideProgress(gb)
+			}
+			if cfg.FaceDown {
+				dealFaceDown(gb)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// rewriteBoards rewrites the boards in the state's fields with whatever
+// rewrite pick gives for each one's index. Boards it gives nil for are left
+// as they are.
+func rewriteBoards(fields map[string]json.RawMessage, pick func(int) func(*boardJSON)) error {
+	boards := []json.RawMessage{}
+	if err := json.Unmarshal(fields["Boards"], &boards); err != nil {
+		return err
+	}
+	for i := range boards {
+		rewrite := pick(i)
+		if rewrite == nil {
+			continue
+		}
+		bts, err := rewriteBoard(boards[i], rewrite)
+		if err != nil {
+			return err
+		}
+		boards[i] = bts
+	}
+	bts, err := json.Marshal(boards)
+	if err != nil {
+		return err
+	}
+	fields["Boards"] = bts
+	return nil
+}
+
+// rewriteBoard unmarshals a board, changes it and marshals it again.
+func rewriteBoard(board json.RawMessage, rewrite func(*boardJSON)) (json.RawMessage, error) {
+	if string(board) == "null" {
+		return board, nil
+	}
+	pb := &publishedBoard{boardJSON: &boardJSON{}}
+	if err := json.Unmarshal(board, pb); err != nil {
+		return nil, err
+	}
+	rewrite(pb.boardJSON)
+	return json.Marshal(pb)
+}
+
+// hideProgress shows each question's original answer count on the board,
+// instead of what's left.
+func hideProgress(gb *boardJSON) {
+	for _, qs := range [][]*Question{gb.Slots, gb.Queue, gb.OppQueue} {
+		for _, q := range qs {
+			if q != nil {
+				q.AnswersLeft = q.AnswersTotal
+			}
+		}
+	}
+}
+
+// dealFaceDown hides the questions in the board's queue, so that the player
+// only finds out what they are once they start falling. How many there are
+// and whose they are still shows.
+func dealFaceDown(gb *boardJSON) {
+	for i, q := range gb.Queue {
+		gb.Queue[i] = &Question{Whose: q.Whose}
+	}
+}
+
+// RedactBoards takes a marshaled game state and replaces the given boards
+// with summaries of them.
+func RedactBoards(state []byte, hidden []int) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(state, &fields); err != nil {
+		return nil, err
+	}
+	boards := []json.RawMessage{}
+	if err := json.Unmarshal(fields["Boards"], &boards); err != nil {
+		return nil, err
+	}
+	for _, idx := range hidden {
+		if idx >= len(boards) {
+			continue
+		}
+		gb := &GameBoard{}
+		if err := json.Unmarshal(boards[idx], gb); err != nil {
+			return nil, err
+		}
+		summary, err := json.Marshal(summarizeBoard(gb))
+		if err != nil {
+			return nil, err
+		}
+		boards[idx] = summary
+	}
+	bts, err := json.Marshal(boards)
+	if err != nil {
+		return nil, err
+	}
+	fields["Boards"] = bts
+	return json.Marshal(fields)
+}
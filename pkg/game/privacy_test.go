@@ -0,0 +1,267 @@
+package game
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+)
+
+func TestPrivateBoardShowsOpponentSummary(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.PrivatePlayers = []string{"a"}
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	alphs, _ := testAlphagrams(2)
+	for i, b := range gs.Boards {
+		b.Slots[NumSlots-1-i] = &Question{OrigQuestion: alphs[i]}
+		b.Solved = 3 + i
+		b.publish()
+	}
+	state := gs.publishState()
+
+	// The hub only has the marshaled state to go on.
+	gsm := &GameStateManager{}
+	if err := json.Unmarshal(state, gsm); err != nil {
+		t.Fatal(err)
+	}
+	if hidden := HiddenBoardsFor(gsm, "a"); len(hidden) != 0 {
+		t.Errorf("the private player can't see %v", hidden)
+	}
+	hidden := HiddenBoardsFor(gsm, "b")
+	if !slices.Equal(hidden, []int{0}) {
+		t.Fatalf("hidden from the opponent: %v", hidden)
+	}
+
+	redacted, err := RedactBoards(state, hidden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct{ Boards []map[string]any }
+	if err := json.Unmarshal(redacted, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"Idx": 0.0, "Private": true, "Solved": 3.0, "Danger": 1.0, "Dead": false, "Won": false}
+	if len(got.Boards[0]) != len(want) {
+		t.Errorf("the private board came through as %v", got.Boards[0])
+	}
+	for k, v := range want {
+		if got.Boards[0][k] != v {
+			t.Errorf("summary %s = %v, want %v", k, got.Boards[0][k], v)
+		}
+	}
+	if _, ok := got.Boards[1]["Slots"]; !ok {
+		t.Errorf("the opponent's own board got redacted: %v", got.Boards[1])
+	}
+}
+
+func TestStateForTellsPlayersTheirBoard(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	state := gs.publishState()
+	for player, want := range map[string]int{"a": 0, "b": 1, "watcher": -1} {
+		tailored, err := StateFor(state, gs, player)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			ID        string
+			YourBoard int
+		}
+		if err := json.Unmarshal(tailored, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != "gid" || got.YourBoard != want {
+			t.Errorf("%s got board %d of %q, want %d", player, got.YourBoard, got.ID, want)
+		}
+	}
+}
+
+func TestHideOpponentProgress(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.HideOpponentProgress = true
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	alphs, _ := testAlphagrams(1)
+	alphs[0].Words = append(alphs[0].Words, &wordsearcher.Word{Word: "other"})
+	for _, b := range gs.Boards {
+		q := &Question{OrigQuestion: alphs[0]}
+		q.populateMap()
+		delete(q.AnswerMap, "other")
+		q.AnswersLeft = 1
+		b.Slots[NumSlots-1] = q
+		b.publish()
+	}
+
+	tailored, err := StateFor(gs.publishState(), gs, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Boards []struct {
+			Slots []*struct{ AnswersLeft int }
+		}
+	}
+	if err := json.Unmarshal(tailored, &got); err != nil {
+		t.Fatal(err)
+	}
+	if left := got.Boards[0].Slots[NumSlots-1].AnswersLeft; left != 1 {
+		t.Errorf("a's own board shows %d left, want 1", left)
+	}
+	if left := got.Boards[1].Slots[NumSlots-1].AnswersLeft; left != 2 {
+		t.Errorf("the opponent's board shows %d left, want the original 2", left)
+	}
+}
+
+func TestFaceDown(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.FaceDown = true
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), cfg)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	alphs, _ := testAlphagrams(4)
+	for i, b := range gs.Boards {
+		for _, alph := range alphs[2*i : 2*i+2] {
+			q := &Question{OrigQuestion: alph, Whose: i}
+			q.populateMap()
+			b.Queue = append(b.Queue, q)
+		}
+	}
+	queues := func(player string) [][]*Question {
+		t.Helper()
+		for _, b := range gs.Boards {
+			b.publish()
+		}
+		state, err := SpectatorState(gs.publishState(), gs)
+		if player != "" {
+			state, err = StateFor(gs.publishState(), gs, player)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got struct {
+			Boards []struct{ Queue []*Question }
+		}
+		if err := json.Unmarshal(state, &got); err != nil {
+			t.Fatal(err)
+		}
+		return [][]*Question{got.Boards[0].Queue, got.Boards[1].Queue}
+	}
+
+	got := queues("a")
+	for _, q := range got[0] {
+		if q.OrigQuestion != nil {
+			t.Errorf("a's own queue shows %s", q.OrigQuestion.Alphagram)
+		}
+	}
+	if len(got[0]) != 2 || len(got[1]) != 2 || got[1][0].OrigQuestion == nil {
+		t.Errorf("a sees the queues as %v", got)
+	}
+	// Spectators can't see more than the players do.
+	for _, q := range slices.Concat(queues("")...) {
+		if q.OrigQuestion != nil {
+			t.Errorf("spectators see %s in a queue", q.OrigQuestion.Alphagram)
+		}
+	}
+
+	// Once a question starts falling, its owner gets to see it.
+	b := gs.Boards[0]
+	b.Slots[0], b.Queue = b.Queue[0], b.Queue[1:]
+	b.publish()
+	tailored, err := StateFor(gs.publishState(), gs, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(tailored), alphs[0].Alphagram) ||
+		strings.Contains(string(tailored), alphs[1].Alphagram) {
+		t.Errorf("after the first one drops, a sees %s", tailored)
+	}
+}
+
+func TestStateHasNoAnswers(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	alphs, answers := testAlphagrams(3)
+	for i, b := range gs.Boards {
+		for j, alph := range alphs {
+			q := &Question{OrigQuestion: alph, Whose: i}
+			q.populateMap()
+			switch j {
+			case 0:
+				b.Slots[NumSlots-1] = q
+			case 1:
+				b.Queue = append(b.Queue, q)
+			default:
+				b.OppQueue = append(b.OppQueue, q)
+			}
+		}
+		b.publish()
+	}
+
+	var state any
+	if err := json.Unmarshal(gs.publishState(), &state); err != nil {
+		t.Fatal(err)
+	}
+	// Look through every key and string value in the state.
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, e := range v {
+				if slices.Contains(answers, strings.ToLower(k)) {
+					t.Errorf("the state has the answer %q as a key", k)
+				}
+				walk(e)
+			}
+		case []any:
+			for _, e := range v {
+				walk(e)
+			}
+		case string:
+			if slices.Contains(answers, strings.ToLower(v)) {
+				t.Errorf("the state has the answer %q", v)
+			}
+		}
+	}
+	walk(state)
+
+	// The letters still go out.
+	var got struct {
+		Boards []struct{ Slots []*Question }
+	}
+	if err := json.Unmarshal(gs.publishState(), &got); err != nil {
+		t.Fatal(err)
+	}
+	q := got.Boards[1].Slots[NumSlots-1]
+	if q == nil || q.OrigQuestion.Alphagram != alphs[0].Alphagram || q.AnswersLeft != 1 {
+		t.Errorf("board 1's rack went out as %+v", q)
+	}
+}
+
+func TestStateHasNoSeed(t *testing.T) {
+	seed := testSeed()
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, seed, nil)
+	gs.Boards = []*GameBoard{newGameBoard(0, gs), newGameBoard(1, gs)}
+	for _, b := range gs.Boards {
+		b.publish()
+	}
+	gs.Status = Playing
+	tailored, err := StateFor(gs.publishState(), gs, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, state := range map[string][]byte{"Marshal": gs.Marshal(), "StateFor": tailored} {
+		for _, enc := range []string{
+			string(seed[:]),
+			hex.EncodeToString(seed[:]),
+			strings.ToUpper(hex.EncodeToString(seed[:])),
+			base64.StdEncoding.EncodeToString(seed[:]),
+		} {
+			if strings.Contains(string(state), enc) {
+				t.Errorf("%s has the seed in it: %s", name, state)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package game
+
+import "time"
+
+// A RecentGame is a game that finished recently, kept in memory so that
+// the lobby can list it and its players can look it over.
+type RecentGame struct {
+	ID       string
+	ListName string
+	Players  []string
+	// Result is how the last round went, if one was played out.
+	Result *GameResult `json:",omitempty"`
+	// ReplayIDs are the replays saved from the game's rounds. They're kept
+	// for as long as the game is.
+	ReplayIDs []string
+	EndedAt   time.Time
+}
+
+// rememberGame adds the ended session to the recent games, and forgets the
+// oldest ones (and their replays) past the configured limit. With no
+// limit, no games are kept, so their replays go right away. The game manager
+// must have exited.
+func (s *SessionManager) rememberGame(sess *GameSession) {
+	rg := &RecentGame{
+		ID:       sess.ID,
+		ListName: sess.ListName,
+		Players:  sess.Players,
+		Result:   sess.GameManager.Result,
+		EndedAt:  time.Now(),
+	}
+	s.replaysMu.Lock()
+	for id, r := range s.replays {
+		if r.GameID == sess.ID {
+			rg.ReplayIDs = append(rg.ReplayIDs, id)
+		}
+	}
+	s.replaysMu.Unlock()
+
+	limit := s.cfg.RecentGames
+	if limit <= 0 {
+		s.forgetGame(rg)
+		return
+	}
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	s.recent = append(s.recent, rg)
+	for len(s.recent) > limit {
+		s.forgetGame(s.recent[0])
+		s.recent = s.recent[1:]
+	}
+}
+
+func (s *SessionManager) forgetGame(rg *RecentGame) {
+	s.replaysMu.Lock()
+	defer s.replaysMu.Unlock()
+	for _, id := range rg.ReplayIDs {
+		delete(s.replays, id)
+	}
+}
+
+// RecentGames returns the games that finished recently, newest first.
+func (s *SessionManager) RecentGames() []*RecentGame {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	games := make([]*RecentGame, 0, len(s.recent))
+	for i := len(s.recent) - 1; i >= 0; i-- {
+		games = append(games, s.recent[i])
+	}
+	return games
+}
+
+// RecentGame returns the recently finished game with the given ID, or nil
+// if it's not one we still have.
+func (s *SessionManager) RecentGame(id string) *RecentGame {
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	for _, rg := range s.recent {
+		if rg.ID == id {
+			return rg
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package game
+
+import (
+	"time"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+	"github.com/lithammer/shortuuid"
+	"github.com/rs/zerolog/log"
+)
+
+// GhostPlayer is the name the board driven by a replay in ghost mode goes by
+// in the game's players. It's empty, which no real player's name can be (see
+// the hub's socketLogin), so nothing meant for a player ever goes to the
+// ghost. Within the game, the ghost is told apart by its board; see isGhost.
+const GhostPlayer = ""
+
+// isGhost is whether the board at the index is played by the ghost.
+func (gs *GameStateManager) isGhost(idx int) bool {
+	return idx == gs.GhostBoard
+}
+
+// A GuessRecord is a guess made on a board, and when, relative to the start
+// of the round.
+type GuessRecord struct {
+	Board int
+	At    time.Duration
+	Guess string
+}
+
+// A Replay is enough of one player's round to play it back: the questions
+// they were dealt and the guesses they made.
+type Replay struct {
+	ID        string
+	GameID    string
+	Player    string
+	Questions []*wordsearcher.Alphagram
+	Guesses   []GuessRecord
+	// History has the state changes on the player's board, with
+	// GameConfig.ArchiveHistory.
+	History []HistoryEntry `json:",omitempty"`
+}
+
+// SetReplaySink sets a function that gets every player's replay at the end
+// of each round. It's called from the manager loop.
+func (gs *GameStateManager) SetReplaySink(sink func(*Replay)) {
+	gs.replaySink = sink
+}
+
+func (gs *GameStateManager) recordGuess(board int, guess string) {
+	gs.historyMu.Lock()
+	defer gs.historyMu.Unlock()
+	gs.guesses = append(gs.guesses, GuessRecord{
+		Board: board,
+		At:    gs.clock.Now().Sub(gs.roundStartedAt),
+		Guess: guess,
+	})
+}
+
+// saveReplays sends a replay for each real player to the replay sink.
+func (gs *GameStateManager) saveReplays() {
+	if gs.replaySink == nil {
+		return
+	}
+	gs.historyMu.Lock()
+	defer gs.historyMu.Unlock()
+	for i, p := range gs.Players {
+		if gs.isGhost(i) {
+			continue
+		}
+		r := &Replay{
+			ID:        shortuuid.New(),
+			GameID:    gs.ID,
+			Player:    p,
+			Questions: gs.dealt[i],
+		}
+		for _, g := range gs.guesses {
+			if g.Board == i {
+				r.Guesses = append(r.Guesses, g)
+			}
+		}
+		if gs.Config.ArchiveHistory {
+			for _, e := range gs.archived {
+				if e.Board == i {
+					r.History = append(r.History, e)
+				}
+			}
+			for j := range gs.history {
+				if e := gs.historyAt(j); e.Board == i {
+					r.History = append(r.History, e)
+				}
+			}
+		}
+		gs.replaySink(r)
+	}
+}
+
+// driveGhost plays back the ghost's recorded guesses on its board, at the
+// times they were originally made.
+func (gs *GameStateManager) driveGhost(board *GameBoard, ghost *Replay) {
+	start := gs.clock.Now()
+	for _, g := range ghost.Guesses {
+		wait := g.At - gs.clock.Now().Sub(start)
+		if wait > 0 {
+			select {
+			case <-gs.clock.After(wait):
+			case <-gs.done:
+				return
+			}
+		}
+		board.Lock()
+		over := board.Dead || board.Won || board.quitting
+		board.Unlock()
+		if over {
+			return
+		}
+		if err := board.Guess(g.Guess); err != nil {
+			log.Debug().Err(err).Str("gid", gs.ID).Msg("ghost-guess")
+		}
+	}
+}
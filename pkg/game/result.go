@@ -0,0 +1,161 @@
+package game
+
+import "slices"
+
+// NoWinner is the GameResult winner for a draw.
+const NoWinner = -1
+
+// A GameResult is how a round ended.
+type GameResult struct {
+	// Winner is the index of the winning board, or NoWinner for a draw.
+	Winner int
+	Reason string
+	Scores []int
+	// Breakdown is what each board's score is made of.
+	Breakdown []ScoreBreakdown `json:",omitempty"`
+	// DeathReasons has why each board died, or "" for boards that didn't.
+	DeathReasons []DeathReason `json:",omitempty"`
+	// Missed has what each board left unsolved, for review.
+	Missed [][]MissedAnswer `json:",omitempty"`
+}
+
+// A ScoreBreakdown is what went into a board's score. Score is just Solved,
+// plus any Bonus, unless the game has ScoreWeights.
+type ScoreBreakdown struct {
+	Solved         int
+	AttacksCleared int
+	AttacksSent    int
+	Answers        int
+	Survived       bool
+	Bonus          int
+	Score          int
+}
+
+// score works out the breakdown's score with the given weights.
+func (b *ScoreBreakdown) score(w *ScoreWeights) int {
+	if w == nil {
+		return b.Solved + b.Bonus
+	}
+	score := b.AttacksCleared*w.AttacksCleared + b.AttacksSent*w.AttacksSent + b.Answers*w.Answer + b.Bonus
+	if b.Survived {
+		score += w.Survival
+	}
+	return score
+}
+
+// IsDraw is whether nobody won a round that was played out. A co-op round
+// has no winner either, but it isn't a draw.
+func (r *GameResult) IsDraw() bool {
+	return r != nil && r.Winner == NoWinner && r.Reason != ResultMaintenance &&
+		!r.isTeamResult()
+}
+
+// isTeamResult is whether the round was won or lost by everyone together.
+func (r *GameResult) isTeamResult() bool {
+	return r.Reason == ResultTeamCleared || r.Reason == ResultTeamLost
+}
+
+// Reasons a round can end.
+const (
+	ResultCleared   = "cleared"   // the winner cleared their whole board
+	ResultSurvived  = "survived"  // everyone else died
+	ResultScore     = "score"     // decided on score
+	ResultTimeLimit = "timelimit" // the game hit its time cap; decided on score
+	ResultMaxRounds = "maxrounds" // a series' result after its last round
+	// In co-op, the team cleared every board, or didn't: a board died or
+	// time ran out first. Nobody wins on their own either way.
+	ResultTeamCleared = "teamcleared"
+	ResultTeamLost    = "teamlost"
+	// The server ended the game for maintenance. Nobody wins.
+	ResultMaintenance = "maintenance"
+)
+
+// computeResult decides who won the round that just ended. endReason is why
+// the game was ended early, if it was: a time limit goes straight to
+// comparing scores, and maintenance means nobody wins. The boards must have
+// exited. The mode has the last word; see Mode.OnResult.
+func (gs *GameStateManager) computeResult(endReason string) *GameResult {
+	res := gs.usualResult(endReason)
+	gs.mode().OnResult(gs, res)
+	return res
+}
+
+// usualResult is the result of the round by the classic rules: whoever
+// cleared their board, or else whoever's left, or else the top score.
+func (gs *GameStateManager) usualResult(endReason string) *GameResult {
+	res := &GameResult{
+		Winner:       NoWinner,
+		Scores:       make([]int, len(gs.Boards)),
+		Missed:       make([][]MissedAnswer, len(gs.Boards)),
+		Breakdown:    make([]ScoreBreakdown, len(gs.Boards)),
+		DeathReasons: make([]DeathReason, len(gs.Boards)),
+	}
+	alive := []int{}
+	for i, b := range gs.Boards {
+		res.Breakdown[i] = ScoreBreakdown{
+			Solved:         b.Solved,
+			AttacksCleared: b.AttacksCleared,
+			AttacksSent:    b.AttacksSent,
+			Answers:        b.AnswersFound,
+			Survived:       !b.Dead,
+			Bonus:          b.Bonus,
+		}
+		res.Breakdown[i].Score = res.Breakdown[i].score(gs.Config.ScoreWeights)
+		res.Scores[i] = res.Breakdown[i].Score
+		res.Missed[i] = b.missedAnswers()
+		res.DeathReasons[i] = b.DeathReason
+		if !b.Dead {
+			alive = append(alive, i)
+		}
+	}
+	switch endReason {
+	case ResultTimeLimit:
+		res.Reason = ResultTimeLimit
+		res.Winner = topScorer(res.Scores)
+		return res
+	case ResultMaintenance:
+		res.Reason = ResultMaintenance
+		return res
+	}
+	for i, b := range gs.Boards {
+		if b.Won {
+			res.Winner = i
+			res.Reason = ResultCleared
+			return res
+		}
+	}
+	if len(alive) == 1 {
+		res.Winner = alive[0]
+		res.Reason = ResultSurvived
+		return res
+	}
+	res.Reason = ResultScore
+	res.Winner = topScorer(res.Scores)
+	return res
+}
+
+// seriesResult is the result of a whole series, decided on who won the most
+// rounds. Its Scores are the rounds each board won.
+func (gs *GameStateManager) seriesResult() *GameResult {
+	wins := slices.Clone(gs.RoundsWon)
+	return &GameResult{
+		Winner: topScorer(wins),
+		Reason: ResultMaxRounds,
+		Scores: wins,
+	}
+}
+
+// topScorer returns the index of the highest score, or NoWinner if it's tied.
+func topScorer(scores []int) int {
+	winner := NoWinner
+	best := -1
+	for i, s := range scores {
+		if s > best {
+			best = s
+			winner = i
+		} else if s == best {
+			winner = NoWinner
+		}
+	}
+	return winner
+}
@@ -0,0 +1,420 @@
+package game
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+)
+
+var (
+	ErrGameOver     = errors.New("game is over")
+	ErrCannotResume = errors.New("game cannot be resumed")
+)
+
+// Dependencies are what a resumed game needs from wherever it's resumed,
+// that can't be saved along with it.
+type Dependencies struct {
+	WordDBServer string
+	StateOut     chan []byte
+	// Clock defaults to RealClock.
+	Clock      Clock
+	ReplaySink func(*Replay)
+	ResultSink func(PlayerResult)
+}
+
+// A savedGame is everything needed to pick a game back up where it was
+// saved. Timers are saved as how long they had left; times as how long ago
+// they were. The history of state changes isn't saved, so a resumed game
+// starts with an empty one.
+type savedGame struct {
+	ID             string
+	Players        []string
+	SearchCriteria []byte
+	Config         *GameConfig
+	// Seed is the game's seed, in hex. It's why a saved game is for the
+	// server only, and never goes to a client; see randSeed.
+	Seed           string
+	Status         Status
+	QuestionOffset int
+	ColorIndices   []int
+	Commitment     string
+	Result         *GameResult
+	EndReason      string
+	RoundsPlayed   int
+	RoundsWon      []int
+	SeriesSolved   []int
+	SeriesFastest  []time.Duration
+	// CountdownLeft is how long the countdown, or the review phase, has
+	// left.
+	CountdownLeft time.Duration
+	// DurationCapLeft is nil if the game has no duration cap (yet).
+	DurationCapLeft *time.Duration
+	// The rest are about the round being played, or the last one played if
+	// we're in Countdown.
+	Boards       []*savedBoard
+	ExitedBoards []bool
+	Dealt        [][]*wordsearcher.Alphagram
+	Guesses      []GuessRecord
+	RoundElapsed time.Duration
+}
+
+type savedBoard struct {
+	Slots            []*savedQuestion
+	Queue            []*savedQuestion
+	OppQueue         []*savedQuestion
+	FallerPos        int
+	Status           BoardStatus
+	Dead             bool
+	DeathReason      DeathReason
+	Won              bool
+	Solved           int
+	AttacksCleared   int
+	AttacksSent      int
+	Bonus            int
+	AnswersFound     int
+	Quitting         bool
+	OppQueueReady    bool
+	IdleWarned       bool
+	NextTickIn       time.Duration
+	OppQueueRisesIn  time.Duration
+	IdleFor          time.Duration
+	FastestSolve     time.Duration
+	LastStateChange  StateChange
+	LastGuessOutcome GuessOutcome
+}
+
+type savedQuestion struct {
+	OrigQuestion *wordsearcher.Alphagram
+	Whose        int
+	// Answers are the answers left to solve, or nil if they haven't been
+	// filled in yet (see sendAttack).
+	Answers []string
+	// Solved are the answers solved already.
+	Solved       []string `json:",omitempty"`
+	AnswersLeft  int
+	AnswersTotal int
+	Rarity       *int `json:",omitempty"`
+	LandedAgo    *time.Duration
+	RevealedAgo  *time.Duration
+}
+
+type savedGameOrErr struct {
+	bts []byte
+	err error
+}
+
+// SaveState returns a snapshot of the game that LoadGameStateManager can
+// pick back up, e.g. after a crash or on another node. Unlike CurrentState,
+// it has everything needed to keep playing, including the seed, so it
+// mustn't be sent to players. The manager loop must be running.
+func (gs *GameStateManager) SaveState() ([]byte, error) {
+	reply := make(chan savedGameOrErr, 1)
+	select {
+	case gs.saveRequests <- reply:
+	case <-gs.done:
+		return nil, ErrGameOver
+	}
+	r := <-reply
+	return r.bts, r.err
+}
+
+// save builds the snapshot for SaveState. It's called from the manager
+// loop, and locks each board in turn.
+func (gs *GameStateManager) save() savedGameOrErr {
+	if gs.Config.Ghost != nil {
+		return savedGameOrErr{err: fmt.Errorf("%w: ghost games are driven from memory", ErrCannotResume)}
+	}
+	now := gs.clock.Now()
+	sg := &savedGame{
+		ID:             gs.ID,
+		Players:        gs.Players,
+		SearchCriteria: gs.SearchCriteria,
+		Config:         gs.Config,
+		Seed:           hex.EncodeToString(gs.randSeed[:]),
+		Status:         gs.Status,
+		QuestionOffset: gs.QuestionOffset,
+		ColorIndices:   gs.ColorIndices,
+		Commitment:     gs.Commitment,
+		Result:         gs.Result,
+		EndReason:      gs.endReason,
+		RoundsPlayed:   gs.RoundsPlayed,
+		RoundsWon:      gs.RoundsWon,
+		SeriesSolved:   gs.seriesSolved,
+		SeriesFastest:  gs.seriesFastest,
+		ExitedBoards:   gs.exitedboards,
+		Dealt:          gs.dealt,
+	}
+	if gs.Status == Countdown || gs.Status == Reviewing {
+		sg.CountdownLeft = max(gs.timerEndsAt.Sub(now), 0)
+	}
+	if gs.durationCap != nil {
+		left := max(gs.durationCapEndsAt.Sub(now), 0)
+		sg.DurationCapLeft = &left
+	}
+	gs.historyMu.Lock()
+	sg.Guesses = append([]GuessRecord(nil), gs.guesses...)
+	sg.RoundElapsed = now.Sub(gs.roundStartedAt)
+	gs.historyMu.Unlock()
+	for _, gb := range gs.Boards {
+		sg.Boards = append(sg.Boards, gb.save(now))
+	}
+	bts, err := json.Marshal(sg)
+	return savedGameOrErr{bts: bts, err: err}
+}
+
+func (gb *GameBoard) save(now time.Time) *savedBoard {
+	gb.Lock()
+	defer gb.Unlock()
+	sb := &savedBoard{
+		FallerPos:        gb.FallerPos,
+		Status:           gb.status,
+		Dead:             gb.Dead,
+		DeathReason:      gb.DeathReason,
+		Won:              gb.Won,
+		Solved:           gb.Solved,
+		AttacksCleared:   gb.AttacksCleared,
+		AttacksSent:      gb.AttacksSent,
+		Bonus:            gb.Bonus,
+		AnswersFound:     gb.AnswersFound,
+		Quitting:         gb.quitting,
+		OppQueueReady:    gb.oppqueueReady,
+		IdleWarned:       gb.idleWarned,
+		NextTickIn:       max(gb.nextTickAt.Sub(now), 0),
+		OppQueueRisesIn:  max(gb.oppQueueRiseAt.Sub(now), 0),
+		IdleFor:          now.Sub(gb.lastGuessAt),
+		FastestSolve:     gb.fastestSolve,
+		LastStateChange:  gb.LastStateChange,
+		LastGuessOutcome: gb.LastGuessOutcome,
+	}
+	sb.Slots = make([]*savedQuestion, len(gb.Slots))
+	for i, q := range gb.Slots {
+		sb.Slots[i] = saveQuestion(q, now)
+	}
+	for _, q := range gb.Queue {
+		sb.Queue = append(sb.Queue, saveQuestion(q, now))
+	}
+	for _, q := range gb.OppQueue {
+		sb.OppQueue = append(sb.OppQueue, saveQuestion(q, now))
+	}
+	return sb
+}
+
+func saveQuestion(q *Question, now time.Time) *savedQuestion {
+	if q == nil {
+		return nil
+	}
+	sq := &savedQuestion{
+		OrigQuestion: q.OrigQuestion,
+		Whose:        q.Whose,
+		AnswersLeft:  q.AnswersLeft,
+		AnswersTotal: q.AnswersTotal,
+		Rarity:       q.Rarity,
+		LandedAgo:    ago(q.landedAt, now),
+		RevealedAgo:  ago(q.revealedAt, now),
+	}
+	if q.AnswerMap != nil {
+		sq.Answers = []string{}
+		for a := range q.AnswerMap {
+			sq.Answers = append(sq.Answers, a)
+		}
+	}
+	for a := range q.solved {
+		sq.Solved = append(sq.Solved, a)
+	}
+	return sq
+}
+
+// LoadGameStateManager resumes a game saved with SaveState. The game picks
+// up where it was: a round in progress keeps going, with each board's
+// timers set to what they had left, and a countdown keeps counting down.
+// The manager loop is started; there's no need to call StartGameCountdown.
+func LoadGameStateManager(state []byte, deps Dependencies) (*GameStateManager, error) {
+	sg := &savedGame{}
+	if err := json.Unmarshal(state, sg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCannotResume, err)
+	}
+	if sg.Status != Countdown && sg.Status != Playing && sg.Status != Reviewing {
+		return nil, ErrGameOver
+	}
+	if sg.Config == nil || len(sg.Players) == 0 {
+		return nil, fmt.Errorf("%w: missing config or players", ErrCannotResume)
+	}
+	var seed [32]byte
+	b, err := hex.DecodeString(sg.Seed)
+	if err != nil || len(b) != len(seed) {
+		return nil, fmt.Errorf("%w: bad seed", ErrCannotResume)
+	}
+	copy(seed[:], b)
+	if sg.Status == Playing && len(sg.Boards) != len(sg.Players) {
+		return nil, fmt.Errorf("%w: %d boards for %d players", ErrCannotResume,
+			len(sg.Boards), len(sg.Players))
+	}
+
+	gs := NewGameStateManager(sg.SearchCriteria, sg.Players, deps.WordDBServer, sg.ID,
+		deps.StateOut, seed, sg.Config)
+	if deps.Clock != nil {
+		gs.clock = deps.Clock
+	}
+	gs.replaySink = deps.ReplaySink
+	gs.resultSink = deps.ResultSink
+	gs.Status = sg.Status
+	gs.QuestionOffset = sg.QuestionOffset
+	gs.ColorIndices = sg.ColorIndices
+	gs.Commitment = sg.Commitment
+	gs.Result = sg.Result
+	gs.endReason = sg.EndReason
+	gs.RoundsPlayed = sg.RoundsPlayed
+	gs.RoundsWon = sg.RoundsWon
+	gs.seriesSolved = sg.SeriesSolved
+	gs.seriesFastest = sg.SeriesFastest
+	gs.dealt = sg.Dealt
+	longest := 0
+	for _, alphs := range gs.dealt {
+		for _, a := range alphs {
+			longest = max(longest, len([]rune(a.Alphagram)))
+		}
+	}
+	gs.longestWord.Store(int64(longest))
+
+	now := gs.clock.Now()
+	if sg.DurationCapLeft != nil {
+		gs.durationCap = gs.clock.NewTimer(*sg.DurationCapLeft)
+		gs.durationCapEndsAt = now.Add(*sg.DurationCapLeft)
+	}
+	gs.historyMu.Lock()
+	gs.guesses = sg.Guesses
+	gs.roundStartedAt = now.Add(-sg.RoundElapsed)
+	gs.historyMu.Unlock()
+
+	gs.Boards = make([]*GameBoard, len(sg.Boards))
+	gs.solvedCounts = make([]atomic.Int64, len(sg.Boards))
+	for i, sb := range sg.Boards {
+		gs.Boards[i] = sb.restore(i, gs, now)
+		gs.solvedCounts[i].Store(int64(sb.Solved))
+		gs.Boards[i].publish()
+	}
+
+	if len(gs.Boards) > 0 {
+		if err := gs.checkPlayerOrder(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCannotResume, err)
+		}
+	}
+
+	if gs.Status == Countdown || gs.Status == Reviewing {
+		gs.ready = make([]bool, len(gs.Players))
+		gs.startCountdown(sg.CountdownLeft)
+		gs.publishState()
+		go gs.Loop()
+		return gs, nil
+	}
+
+	// The round is under way. The manager's timer only matters between
+	// rounds, so it starts out stopped.
+	gs.timer = gs.clock.NewTimer(0)
+	if !gs.timer.Stop() {
+		<-gs.timer.C()
+	}
+	gs.exitedboards = make([]bool, len(gs.Players))
+	copy(gs.exitedboards, sg.ExitedBoards)
+	gs.startScrambles()
+	gs.publishState()
+	for i, gb := range gs.Boards {
+		switch {
+		case gs.exitedboards[i]:
+			close(gb.done)
+		case gb.Dead || gb.Won:
+			// It was saved on its way out of its loop.
+			close(gb.done)
+			go gb.reportExit()
+		default:
+			go gb.loop()
+		}
+	}
+	go gs.Loop()
+	return gs, nil
+}
+
+func (sb *savedBoard) restore(idx int, gs *GameStateManager, now time.Time) *GameBoard {
+	gb := newGameBoard(idx, gs)
+	gb.FallerPos = sb.FallerPos
+	gb.status = sb.Status
+	gb.Dead = sb.Dead
+	gb.DeathReason = sb.DeathReason
+	gb.Won = sb.Won
+	gb.Solved = sb.Solved
+	gb.AttacksCleared = sb.AttacksCleared
+	gb.AttacksSent = sb.AttacksSent
+	gb.Bonus = sb.Bonus
+	gb.AnswersFound = sb.AnswersFound
+	gb.quitting = sb.Quitting
+	gb.oppqueueReady = sb.OppQueueReady
+	gb.idleWarned = sb.IdleWarned
+	gb.lastGuessAt = now.Add(-sb.IdleFor)
+	gb.fastestSolve = sb.FastestSolve
+	gb.LastStateChange = sb.LastStateChange
+	gb.LastGuessOutcome = sb.LastGuessOutcome
+	for i, sq := range sb.Slots {
+		gb.Slots[i] = sq.restore(now)
+	}
+	for _, sq := range sb.Queue {
+		gb.Queue = append(gb.Queue, sq.restore(now))
+	}
+	for _, sq := range sb.OppQueue {
+		gb.OppQueue = append(gb.OppQueue, sq.restore(now))
+	}
+	gb.startTimer(sb.NextTickIn)
+	if len(gb.OppQueue) > 0 && !gb.oppqueueReady {
+		gb.startOppQueueTimer(sb.OppQueueRisesIn)
+	}
+	return gb
+}
+
+func (sq *savedQuestion) restore(now time.Time) *Question {
+	if sq == nil {
+		return nil
+	}
+	q := &Question{
+		OrigQuestion: sq.OrigQuestion,
+		Whose:        sq.Whose,
+		AnswersLeft:  sq.AnswersLeft,
+		AnswersTotal: sq.AnswersTotal,
+		Rarity:       sq.Rarity,
+		landedAt:     since(sq.LandedAgo, now),
+		revealedAt:   since(sq.RevealedAgo, now),
+	}
+	if sq.Answers != nil {
+		q.AnswerMap = map[string]bool{}
+		for _, a := range sq.Answers {
+			q.AnswerMap[a] = true
+		}
+	}
+	if sq.Solved != nil {
+		q.solved = map[string]bool{}
+		for _, a := range sq.Solved {
+			q.solved[a] = true
+		}
+	}
+	return q
+}
+
+// ago returns how long before now t was, or nil if t is unset.
+func ago(t, now time.Time) *time.Duration {
+	if t.IsZero() {
+		return nil
+	}
+	d := now.Sub(t)
+	return &d
+}
+
+// since undoes ago.
+func since(d *time.Duration, now time.Time) time.Time {
+	if d == nil {
+		return time.Time{}
+	}
+	return now.Add(-*d)
+}
@@ -0,0 +1,140 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// playingGame starts a game on a manual clock and returns it once the first
+// round is dealt, with its states being drained.
+func playingGame(t *testing.T, cfg *GameConfig) (*GameStateManager, *ManualClock, string) {
+	t.Helper()
+	alphs, _ := testAlphagrams(TotalNumQuestions)
+	wdb := fakeWordDB(t, alphs)
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager([]byte("{}"), []string{"a", "b"}, wdb, "gid", stateOut, testSeed(), cfg)
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.StartGameCountdown()
+	clock.Advance(InitGameCountdownTime)
+	for {
+		var state struct{ Status Status }
+		if err := json.Unmarshal(<-stateOut, &state); err != nil {
+			t.Fatal(err)
+		}
+		if state.Status == Playing {
+			break
+		}
+	}
+	go func() {
+		for range stateOut {
+		}
+	}()
+	return gs, clock, wdb
+}
+
+func TestSaveAndResume(t *testing.T) {
+	cfg := DefaultGameConfig()
+	cfg.SeriesMode = SingleGame
+	cfg.ReplayDraws = false
+	gs, clock, wdb := playingGame(t, cfg)
+	// Let a few pieces fall first, and wait for the boards to catch up, so
+	// nothing is due the moment the game is resumed.
+	for range 5 {
+		clock.Advance(TickDuration)
+		for _, gb := range gs.boards() {
+			for {
+				gb.Lock()
+				caughtUp := gb.nextTickAt.After(clock.Now())
+				gb.Unlock()
+				if caughtUp {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+	saved, err := gs.SaveState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The boards may have moved on since; what matters is what was saved.
+	sg := &savedGame{}
+	if err := json.Unmarshal(saved, sg); err != nil {
+		t.Fatal(err)
+	}
+	now := testEpoch.Add(time.Hour)
+	var restored []*GameBoard
+	for i, sb := range sg.Boards {
+		restored = append(restored, sb.restore(i, gs, now))
+	}
+	before, err := json.Marshal(boardsOf(restored))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stateOut := make(chan []byte)
+	go func() {
+		for range stateOut {
+		}
+	}()
+	resumedClock := NewManualClock(now)
+	resumed, err := LoadGameStateManager(saved, Dependencies{
+		WordDBServer: wdb,
+		StateOut:     stateOut,
+		Clock:        resumedClock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := json.Marshal(boardsOf(resumed.boards()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("boards were\n%s\nresumed as\n%s", before, after)
+	}
+
+	// Nobody guesses; the resumed round plays out to the end.
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(resumedClock, stop)
+	select {
+	case <-resumed.Done():
+	case <-time.After(20 * time.Second):
+		t.Fatal("the resumed game never ended")
+	}
+	if resumed.Status != Finished || resumed.Result == nil {
+		t.Errorf("resumed game ended with %v, result %+v", resumed.Status, resumed.Result)
+	}
+	if _, err := resumed.SaveState(); !errors.Is(err, ErrGameOver) {
+		t.Errorf("saving a finished game: %v", err)
+	}
+}
+
+// boardsOf marshals the boards as they are, not as last published.
+func boardsOf(boards []*GameBoard) []json.RawMessage {
+	var out []json.RawMessage
+	for _, gb := range boards {
+		gb.Lock()
+		bts, _ := json.Marshal((*boardJSON)(gb))
+		gb.Unlock()
+		out = append(out, bts)
+	}
+	return out
+}
+
+func TestResumeRejectsBadState(t *testing.T) {
+	if _, err := LoadGameStateManager([]byte("{"), Dependencies{}); !errors.Is(err, ErrCannotResume) {
+		t.Errorf("garbage: %v", err)
+	}
+	if _, err := LoadGameStateManager([]byte(`{"Status":2}`), Dependencies{}); !errors.Is(err, ErrGameOver) {
+		t.Errorf("a game that's over: %v", err)
+	}
+	if _, err := LoadGameStateManager([]byte(`{"Status":0,"Players":["a","b"],"Config":{},"Seed":"00"}`),
+		Dependencies{}); !errors.Is(err, ErrCannotResume) {
+		t.Errorf("a short seed: %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package game
+
+import (
+	"sort"
+	"strings"
+)
+
+// A MissedAnswer is an answer a player didn't get, for post-game review.
+// The definition and lexicon symbols are only there if the word DB gave them
+// to us, i.e. the list's search criteria asked for expanded results.
+type MissedAnswer struct {
+	Word           string
+	Definition     string `json:",omitempty"`
+	LexiconSymbols string `json:",omitempty"`
+}
+
+// MissedAnswers returns the question's answers that haven't been solved yet,
+// in alphabetical order, with whatever the word DB told us about them.
+func (a *Question) MissedAnswers() []MissedAnswer {
+	missed := []MissedAnswer{}
+	for _, w := range a.OrigQuestion.Words {
+		word := strings.ToLower(w.GetWord())
+		if !a.AnswerMap[word] {
+			continue
+		}
+		missed = append(missed, MissedAnswer{
+			Word:           word,
+			Definition:     w.GetDefinition(),
+			LexiconSymbols: w.GetLexiconSymbols(),
+		})
+	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].Word < missed[j].Word })
+	return missed
+}
+
+// missedAnswers returns everything left unsolved on the board's slots, from
+// the top down. The board must be locked, or have exited.
+func (gb *GameBoard) missedAnswers() []MissedAnswer {
+	missed := []MissedAnswer{}
+	for _, q := range gb.Slots {
+		if q != nil {
+			missed = append(missed, q.MissedAnswers()...)
+		}
+	}
+	return missed
+}
@@ -0,0 +1,103 @@
+package game
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+)
+
+func TestMissedAnswersInReview(t *testing.T) {
+	q := &Question{OrigQuestion: &wordsearcher.Alphagram{
+		Alphagram: "AEST",
+		Words: []*wordsearcher.Word{
+			{Word: "SEAT", Definition: "a place to sit", LexiconSymbols: "#"},
+			{Word: "EATS"},
+			{Word: "TEAS", Definition: "drinks"},
+		},
+	}}
+	q.populateMap()
+	if o, _ := solveQuestion(q, "seat"); o != GuessSolved {
+		t.Fatalf("solving seat was %q", o)
+	}
+	want := []MissedAnswer{{Word: "eats"}, {Word: "teas", Definition: "drinks"}}
+	if got := q.MissedAnswers(); !reflect.DeepEqual(got, want) {
+		t.Errorf("missed %+v, want %+v", got, want)
+	}
+
+	gb, _ := testBoard(0)
+	gb.Slots[2] = q
+	gb.manager.Boards = []*GameBoard{gb}
+	res := gb.manager.computeResult("")
+	bts, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(bts); !strings.Contains(s, `{"Word":"teas","Definition":"drinks"}`) ||
+		!strings.Contains(s, `{"Word":"eats"}`) {
+		t.Errorf("review payload %s", s)
+	}
+}
+
+func TestScoreBreakdown(t *testing.T) {
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	a, b := newGameBoard(0, gs), newGameBoard(1, gs)
+	a.Solved, a.AttacksCleared, a.AttacksSent = 4, 1, 3
+	b.Solved, b.AttacksCleared, b.AttacksSent = 4, 4, 0
+	gs.Boards = []*GameBoard{a, b}
+
+	res := gs.computeResult(ResultTimeLimit)
+	if !slices.Equal(res.Scores, []int{4, 4}) || res.Winner != NoWinner {
+		t.Errorf("unweighted: scores %v, winner %d", res.Scores, res.Winner)
+	}
+	want := ScoreBreakdown{Solved: 4, AttacksCleared: 1, AttacksSent: 3, Survived: true, Score: 4}
+	if res.Breakdown[0] != want {
+		t.Errorf("breakdown %+v, want %+v", res.Breakdown[0], want)
+	}
+
+	gs.Config.ScoreWeights = &ScoreWeights{AttacksCleared: 2, AttacksSent: 1, Survival: 10}
+	res = gs.computeResult(ResultTimeLimit)
+	if !slices.Equal(res.Scores, []int{15, 18}) || res.Winner != 1 {
+		t.Errorf("weighted: scores %v, winner %d", res.Scores, res.Winner)
+	}
+
+	// Only solving someone else's question clears an attack; solving your
+	// own is what sends one.
+	gb, _ := testBoard(0)
+	gb.addSolved(&Question{Whose: gb.Idx})
+	gb.addSolved(&Question{Whose: gb.Idx + 1})
+	if gb.Solved != 2 || gb.AttacksCleared != 1 {
+		t.Errorf("solved %d, cleared %d attacks, want 2 and 1", gb.Solved, gb.AttacksCleared)
+	}
+}
+
+func TestPartialCredit(t *testing.T) {
+	gb, _ := testBoard(2)
+	for gb.LastStateChange.ChangeType != PieceLand {
+		gb.Tick()
+	}
+	// Give the landed question a second answer, and only find one.
+	q := gb.Slots[NumSlots-1]
+	q.OrigQuestion.Words = append(q.OrigQuestion.Words,
+		&wordsearcher.Word{Word: strings.ToLower(q.OrigQuestion.Alphagram)})
+	q.populateMap()
+	if o := gb.handleGuessEvent(q.OrigQuestion.Words[0].Word); o != GuessSolved {
+		t.Fatalf("guess was %q", o)
+	}
+	if gb.Solved != 0 || gb.AnswersFound != 1 {
+		t.Fatalf("solved %d, found %d answers", gb.Solved, gb.AnswersFound)
+	}
+
+	gs := gb.manager
+	gs.Boards = []*GameBoard{gb, newGameBoard(1, gs)}
+	if res := gs.computeResult(ResultTimeLimit); res.Scores[0] != 0 {
+		t.Errorf("classic scoring gave %d for a partial solve", res.Scores[0])
+	}
+	gs.Config.ScoreWeights = &ScoreWeights{Answer: 1}
+	if res := gs.computeResult(ResultTimeLimit); res.Scores[0] != 1 || res.Breakdown[0].Answers != 1 {
+		t.Errorf("with partial credit, scored %d (%+v)", res.Scores[0], res.Breakdown[0])
+	}
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// searchQuestions runs the given JSON search criteria against the word DB.
+func searchQuestions(ctx context.Context, wdbServer string, criteria []byte) (*wordsearcher.SearchResponse, error) {
+	s := wordsearcher.NewQuestionSearcherProtobufClient(wdbServer, &http.Client{})
+	sr := &wordsearcher.SearchRequest{}
+	err := protojson.Unmarshal(criteria, sr)
+	if err != nil {
+		return nil, err
+	}
+	return s.Search(ctx, sr)
+}
+
+// A SearchBuilder builds the JSON search criteria for a word list, without
+// having to put together the protobuf request by hand:
+//
+//	criteria, err := NewSearch().Lexicon("NWL23").Length(7, 8).JSON()
+type SearchBuilder struct {
+	sr *wordsearcher.SearchRequest
+}
+
+func NewSearch() *SearchBuilder {
+	return &SearchBuilder{sr: &wordsearcher.SearchRequest{}}
+}
+
+func (b *SearchBuilder) Lexicon(lex string) *SearchBuilder {
+	return b.add(&wordsearcher.SearchRequest_SearchParam{
+		Condition: wordsearcher.SearchRequest_LEXICON,
+		Conditionparam: &wordsearcher.SearchRequest_SearchParam_Stringvalue{
+			Stringvalue: &wordsearcher.SearchRequest_StringValue{Value: lex},
+		},
+	})
+}
+
+func (b *SearchBuilder) Length(min, max int32) *SearchBuilder {
+	return b.minMax(wordsearcher.SearchRequest_LENGTH, min, max)
+}
+
+func (b *SearchBuilder) ProbabilityRange(min, max int32) *SearchBuilder {
+	return b.minMax(wordsearcher.SearchRequest_PROBABILITY_RANGE, min, max)
+}
+
+func (b *SearchBuilder) NumAnagrams(min, max int32) *SearchBuilder {
+	return b.minMax(wordsearcher.SearchRequest_NUMBER_OF_ANAGRAMS, min, max)
+}
+
+func (b *SearchBuilder) NumVowels(min, max int32) *SearchBuilder {
+	return b.minMax(wordsearcher.SearchRequest_NUMBER_OF_VOWELS, min, max)
+}
+
+func (b *SearchBuilder) DifficultyRange(min, max int32) *SearchBuilder {
+	return b.minMax(wordsearcher.SearchRequest_DIFFICULTY_RANGE, min, max)
+}
+
+// Expand asks for definitions, hooks and so on with each word.
+func (b *SearchBuilder) Expand() *SearchBuilder {
+	b.sr.Expand = true
+	return b
+}
+
+// Request returns the search request built so far.
+func (b *SearchBuilder) Request() *wordsearcher.SearchRequest {
+	return b.sr
+}
+
+// JSON returns the search criteria, in the form the rest of the game expects.
+func (b *SearchBuilder) JSON() ([]byte, error) {
+	return protojson.Marshal(b.sr)
+}
+
+func (b *SearchBuilder) minMax(cond wordsearcher.SearchRequest_Condition, min, max int32) *SearchBuilder {
+	return b.add(&wordsearcher.SearchRequest_SearchParam{
+		Condition: cond,
+		Conditionparam: &wordsearcher.SearchRequest_SearchParam_Minmax{
+			Minmax: &wordsearcher.SearchRequest_MinMax{Min: min, Max: max},
+		},
+	})
+}
+
+func (b *SearchBuilder) add(p *wordsearcher.SearchRequest_SearchParam) *SearchBuilder {
+	b.sr.Searchparams = append(b.sr.Searchparams, p)
+	return b
+}
@@ -0,0 +1,46 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSearchBuilderRoundTrips(t *testing.T) {
+	bts, err := NewSearch().Lexicon("NWL23").Length(7, 8).NumAnagrams(1, 3).Expand().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &wordsearcher.SearchRequest{}
+	if err := protojson.Unmarshal(bts, got); err != nil {
+		t.Fatal(err)
+	}
+	want := &wordsearcher.SearchRequest{
+		Searchparams: []*wordsearcher.SearchRequest_SearchParam{
+			{
+				Condition: wordsearcher.SearchRequest_LEXICON,
+				Conditionparam: &wordsearcher.SearchRequest_SearchParam_Stringvalue{
+					Stringvalue: &wordsearcher.SearchRequest_StringValue{Value: "NWL23"},
+				},
+			},
+			{
+				Condition: wordsearcher.SearchRequest_LENGTH,
+				Conditionparam: &wordsearcher.SearchRequest_SearchParam_Minmax{
+					Minmax: &wordsearcher.SearchRequest_MinMax{Min: 7, Max: 8},
+				},
+			},
+			{
+				Condition: wordsearcher.SearchRequest_NUMBER_OF_ANAGRAMS,
+				Conditionparam: &wordsearcher.SearchRequest_SearchParam_Minmax{
+					Minmax: &wordsearcher.SearchRequest_MinMax{Min: 1, Max: 3},
+				},
+			},
+		},
+		Expand: true,
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -1,24 +1,50 @@
 package game
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/domino14/word_db_server/rpc/wordsearcher"
 	"github.com/lithammer/shortuuid"
+	"github.com/rs/zerolog/log"
 
 	"github.com/domino14/tetrolith/pkg/config"
 )
 
+// A SessionState is where a game session is in its life.
+type SessionState string
+
+const (
+	// SessionOpen is a seek waiting for an opponent. It's the only state a
+	// session can be joined in.
+	SessionOpen SessionState = "open"
+	// SessionStarted is when the game has been set up, player list and all.
+	SessionStarted SessionState = "started"
+	// SessionEnded is when the game is over and the session cleaned up.
+	SessionEnded SessionState = "ended"
+)
+
 // a game session is a single instance of a game being played.
 type GameSession struct {
 	Players        []string // first one is the seeker
 	ID             string   // game ID for URL
+	State          SessionState
 	ListName       string
-	SearchCriteria []byte            // JSON representation of list search criteria
+	SearchCriteria []byte // JSON representation of list search criteria
+	Options        SeekOptions
+	NumQuestions   int               `json:",omitempty"` // questions in the list, if it was checked
 	GameManager    *GameStateManager `json:"-"`
+
+	// questions is the list as the seek was checked against it, so the
+	// game doesn't have to search for it again.
+	questions []*wordsearcher.Alphagram
 }
 
 type SessionManager struct {
@@ -28,17 +54,152 @@ type SessionManager struct {
 	SessionsForPlayer map[string]*GameSession
 	cfg               *config.Config
 	eventsOut         chan []byte
+
+	// Replays of finished rounds, by replay ID. They have their own lock
+	// since they're saved from game manager loops.
+	replaysMu sync.Mutex
+	replays   map[string]*Replay
+
+	// Every player's running totals, for their stats, and where their
+	// results are kept, if anywhere; see UseResultStore.
+	resultsMu   sync.Mutex
+	results     map[string]*playerRecord
+	resultStore ResultStore
+
+	// The players in recently ended sessions, so that the last messages from
+	// a game can still find their way after the session is cleaned up.
+	endedPlayers map[string][]string
+	endedOrder   []string
+
+	// Recently finished games, oldest first. See rememberGame.
+	recentMu sync.Mutex
+	recent   []*RecentGame
+
+	// reseekSink gets seeks that were posted again automatically, and
+	// connected says whether a player is still around to have one.
+	reseekSink func(*GameSession)
+	connected  func(player string) bool
+
+	// draining is set once we're going down for maintenance. No new games
+	// can be sought or joined after that.
+	draining bool
 }
 
+// maxEndedSessions is how many ended sessions we remember the players of.
+const maxEndedSessions = 128
+
+var (
+	ErrNotInGame = errors.New("not in this game")
+	ErrDraining  = errors.New("the server is going down for maintenance; no new games")
+)
+
 func NewSessionManager(cfg *config.Config, eventsOut chan []byte) *SessionManager {
 	return &SessionManager{
 		Sessions:          make(map[string]*GameSession),
 		SessionsForPlayer: make(map[string]*GameSession),
 		cfg:               cfg,
 		eventsOut:         eventsOut,
+		replays:           make(map[string]*Replay),
+		results:           make(map[string]*playerRecord),
+		endedPlayers:      make(map[string][]string),
 	}
 }
 
+func (s *SessionManager) saveReplay(r *Replay) {
+	s.replaysMu.Lock()
+	defer s.replaysMu.Unlock()
+	s.replays[r.ID] = r
+}
+
+// ReplaysFor returns the IDs of the player's replays, which can be raced as
+// ghosts.
+func (s *SessionManager) ReplaysFor(player string) []string {
+	s.replaysMu.Lock()
+	defer s.replaysMu.Unlock()
+	ids := []string{}
+	for id, r := range s.replays {
+		if r.Player == player {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Replay returns the replay with the given ID, if we have it.
+func (s *SessionManager) Replay(id string) *Replay {
+	s.replaysMu.Lock()
+	defer s.replaysMu.Unlock()
+	return s.replays[id]
+}
+
+// SetReseekSink sets a function that gets every seek that's automatically
+// posted again after a game, so it can be announced. It's called from its
+// own goroutine, without the session manager locked.
+func (s *SessionManager) SetReseekSink(sink func(*GameSession)) {
+	s.reseekSink = sink
+}
+
+// SetConnectedCheck sets a function that says whether a player is connected,
+// so that seeks aren't posted again for players who have gone away. Without
+// one, everyone is taken to be connected. It's called with the session
+// manager locked, so it mustn't call back into it.
+func (s *SessionManager) SetConnectedCheck(connected func(player string) bool) {
+	s.connected = connected
+}
+
+// UseResultStore loads the results already in the store into everyone's
+// stats, and saves every result to it from then on. It should be called
+// before any games are played.
+func (s *SessionManager) UseResultStore(store ResultStore) error {
+	results, err := store.Load()
+	if err != nil {
+		return err
+	}
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	for _, r := range results {
+		s.addResult(r)
+	}
+	s.resultStore = store
+	return nil
+}
+
+func (s *SessionManager) saveResult(r PlayerResult) {
+	s.resultsMu.Lock()
+	s.addResult(r)
+	store := s.resultStore
+	s.resultsMu.Unlock()
+	if store == nil {
+		return
+	}
+	if err := store.Save(r); err != nil {
+		log.Err(err).Str("gid", r.GameID).Str("player", r.Player).Msg("saving-result")
+	}
+}
+
+// addResult adds the result to the player's record. resultsMu must be held.
+func (s *SessionManager) addResult(r PlayerResult) {
+	pr := s.results[r.Player]
+	if pr == nil {
+		pr = &playerRecord{}
+		s.results[r.Player] = pr
+	}
+	pr.add(r)
+}
+
+// Stats returns the player's all-time stats, as seen by the asker. Players
+// get their own full stats, and only the public ones for anyone else.
+func (s *SessionManager) Stats(asker, player string) PlayerStats {
+	s.resultsMu.Lock()
+	defer s.resultsMu.Unlock()
+	pr := s.results[player]
+	if pr == nil {
+		pr = &playerRecord{}
+	}
+	return pr.stats(player, asker == player)
+}
+
 func (s *SessionManager) SendGuess(sender, gid, guess string) error {
 	s.Lock()
 	defer s.Unlock()
@@ -47,13 +208,146 @@ func (s *SessionManager) SendGuess(sender, gid, guess string) error {
 	if gs == nil {
 		return errors.New("no session with that game id")
 	}
+	// A guess can still be in flight after its sender left the game. Make
+	// sure it's for the game they're in now.
+	if s.SessionsForPlayer[sender] != gs || !slices.Contains(gs.Players, sender) {
+		return ErrNotInGame
+	}
+	if gs.GameManager == nil {
+		return errors.New("game has not started")
+	}
 
 	return gs.GameManager.Guess(sender, guess)
 }
 
-func (s *SessionManager) Seek(seeker, listname string, searchcriteria []byte) (*GameSession, error) {
+// Ready tells the game that the sender is done reviewing the last round.
+func (s *SessionManager) Ready(sender, gid string) error {
 	s.Lock()
 	defer s.Unlock()
+
+	gs := s.Sessions[gid]
+	if gs == nil {
+		return errors.New("no session with that game id")
+	}
+	if s.SessionsForPlayer[sender] != gs || !slices.Contains(gs.Players, sender) {
+		return ErrNotInGame
+	}
+	if gs.GameManager == nil {
+		return errors.New("game has not started")
+	}
+	return gs.GameManager.Ready(sender)
+}
+
+func (s *SessionManager) Seek(seeker, listname string, searchcriteria []byte, opts SeekOptions) (*GameSession, error) {
+	switch opts.SeriesMode {
+	case "":
+		opts.SeriesMode = ContinuousSeries
+	case ContinuousSeries, SingleGame:
+	default:
+		return nil, errors.New("unknown series mode")
+	}
+	if opts.QuestionTimeoutSecs < 0 || opts.QuestionTimeoutSecs > MaxQuestionTimeoutSecs {
+		return nil, fmt.Errorf("question timeout must be at most %d seconds", MaxQuestionTimeoutSecs)
+	}
+	if n := opts.NumQuestions; n != 0 && (n < MinNumQuestions || n > MaxNumQuestions) {
+		return nil, fmt.Errorf("rounds must have %d to %d questions", MinNumQuestions, MaxNumQuestions)
+	}
+	numQuestions := TotalNumQuestions
+	if opts.NumQuestions > 0 {
+		numQuestions = opts.NumQuestions
+	}
+	if opts.MercyMargin < 0 || opts.MercyMargin > numQuestions {
+		return nil, fmt.Errorf("mercy margin must be at most %d", numQuestions)
+	}
+	if opts.LockDelayMs < 0 || opts.LockDelayMs > MaxLockDelayMs {
+		return nil, fmt.Errorf("lock delay must be at most %d ms", MaxLockDelayMs)
+	}
+	if opts.ScrambleEverySecs < 0 || (opts.ScrambleEverySecs > 0 && opts.ScrambleEverySecs < MinScrambleEverySecs) {
+		return nil, fmt.Errorf("scrambles must be at least %d seconds apart", MinScrambleEverySecs)
+	}
+	if n := opts.NumSlots; n != 0 && (n < MinNumSlots || n > MaxNumSlots) {
+		return nil, fmt.Errorf("boards must have %d to %d slots", MinNumSlots, MaxNumSlots)
+	}
+	if opts.LengthMix != nil {
+		if err := opts.LengthMix.check(); err != nil {
+			return nil, err
+		}
+	}
+	if w := opts.ScoreWeights; w != nil && (w.AttacksCleared < 0 || w.AttacksSent < 0 || w.Survival < 0 || w.Answer < 0) {
+		return nil, errors.New("score weights can't be negative")
+	}
+	switch opts.SolveTieBreak {
+	case "":
+		opts.SolveTieBreak = TieBreakTop
+	case TieBreakTop, TieBreakBottom, TieBreakSeeded:
+	default:
+		return nil, errors.New("unknown solve tie-break")
+	}
+	if opts.Counterattack && opts.NoAttacks {
+		return nil, errors.New("counterattacks need attacks on")
+	}
+	if (opts.Counterattack || opts.NoAttacks) && opts.Mode != "" {
+		return nil, errors.New("the mode already says what happens to attacks")
+	}
+	if m := opts.mode(); opts.SpreadAttacks && (m == ModeRace || m == ModeSolo || m == ModeCoop) {
+		return nil, errors.New("spreading attacks needs attacks on")
+	}
+	switch opts.RisePolicy {
+	case "":
+		opts.RisePolicy = RiseBatch
+	case RiseBatch, RisePerAttack:
+	default:
+		return nil, errors.New("unknown rise policy")
+	}
+	if n := opts.NumPlayers; n != 0 && (n < 2 || n > MaxNumPlayers) {
+		return nil, fmt.Errorf("games take 2 to %d players", MaxNumPlayers)
+	}
+	if opts.NumPlayers > 2 && opts.GhostReplayID != "" {
+		return nil, errors.New("a ghost game is just you and the ghost")
+	}
+	if opts.FreshEachRound && opts.GhostReplayID != "" {
+		return nil, errors.New("a ghost game deals the replay's questions, not fresh ones")
+	}
+	if opts.Mode != "" && !IsMode(opts.Mode) {
+		return nil, errors.New("unknown game mode")
+	}
+	if s.isDraining() {
+		return nil, ErrDraining
+	}
+	if opts.GhostReplayID != "" {
+		return s.startGhostGame(seeker, listname, opts)
+	}
+
+	// Make sure the list can actually fill a game before anyone joins it.
+	// This costs an RPC, so it can be turned off. Don't hold the lock over it.
+	count := 0
+	var questions []*wordsearcher.Alphagram
+	if s.cfg.ValidateSeeks {
+		resp, err := searchQuestions(context.Background(), s.cfg.WordDBServerAddress, searchcriteria)
+		if err != nil {
+			return nil, err
+		}
+		questions = resp.Alphagrams
+		set := NewAlphagramSet(resp.Alphagrams)
+		count = set.Len()
+		if count < numQuestions {
+			return nil, fmt.Errorf("%w: need %d questions, the list has %d",
+				ErrTooFewQuestions, numQuestions, count)
+		}
+		if len(opts.LengthMix) > 0 {
+			// Every length needs enough words of its own. The seed doesn't
+			// matter for that.
+			if _, err := set.SampleMix([32]byte{}, 0, numQuestions, opts.LengthMix); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.draining {
+		return nil, ErrDraining
+	}
 	if s, ok := s.SessionsForPlayer[seeker]; ok {
 		errMsg := "player already in game session"
 		if s.GameManager == nil {
@@ -67,12 +361,27 @@ func (s *SessionManager) Seek(seeker, listname string, searchcriteria []byte) (*
 		ID:             shortuuid.New(),
 		ListName:       listname,
 		SearchCriteria: searchcriteria,
+		Options:        opts,
+		NumQuestions:   count,
+		State:          SessionOpen,
+		questions:      questions,
 	}
 	s.Sessions[gs.ID] = gs
 	s.SessionsForPlayer[seeker] = gs
 	return gs, nil
 }
 
+// numPlayers is how many players the session waits for.
+func (sess *GameSession) numPlayers() int {
+	if sess.Options.NumPlayers == 0 {
+		return 2
+	}
+	return sess.Options.NumPlayers
+}
+
+// Unseek takes the player out of the open seek they made or are waiting on.
+// The seeker leaving takes the seek down with everyone on it; anyone else
+// leaving just frees up their spot.
 func (s *SessionManager) Unseek(seeker string) error {
 	s.Lock()
 	defer s.Unlock()
@@ -81,9 +390,17 @@ func (s *SessionManager) Unseek(seeker string) error {
 		return errors.New("not seeking a game")
 	} else if sess.GameManager != nil {
 		return errors.New("game already started")
+	} else if sess.Players[0] != seeker {
+		// Someone waiting on another player's seek; it stays up without
+		// them.
+		sess.Players = slices.DeleteFunc(sess.Players, func(p string) bool { return p == seeker })
+		delete(s.SessionsForPlayer, seeker)
 	} else {
+		// The seek goes, and so does everyone waiting on it.
 		delete(s.Sessions, sess.ID)
-		delete(s.SessionsForPlayer, seeker)
+		for _, p := range sess.Players {
+			delete(s.SessionsForPlayer, p)
+		}
 	}
 	return nil
 }
@@ -103,6 +420,9 @@ func CryptoSeed() [32]byte {
 func (s *SessionManager) Join(joiner, id string) (*GameSession, error) {
 	s.Lock()
 	defer s.Unlock()
+	if s.draining {
+		return nil, ErrDraining
+	}
 
 	if sess, ok := s.SessionsForPlayer[joiner]; ok {
 		errMsg := "player already in game session"
@@ -113,20 +433,309 @@ func (s *SessionManager) Join(joiner, id string) (*GameSession, error) {
 	}
 	gs := s.Sessions[id]
 	if gs == nil {
-		fmt.Println("sessions are", s.Sessions, s.Sessions[id])
 		return nil, errors.New("session did not exist")
 	}
+	// Only an open seek can be joined. Once the game is set up, its player
+	// list is final; we hold the lock from here until it is.
+	if gs.State != SessionOpen || gs.GameManager != nil {
+		return nil, errors.New("game already started")
+	}
+	// The seeker stays at index 0 and gets board 0; joiners get the boards
+	// after it in the order they join. Anything else would deal the boards
+	// to the wrong players.
+	if len(gs.Players) == 0 || len(gs.Players) >= gs.numPlayers() || slices.Contains(gs.Players, joiner) {
+		return nil, fmt.Errorf("%w: %s can't join %v", ErrBadPlayerOrder, joiner, gs.Players)
+	}
 	gs.Players = append(gs.Players, joiner)
+	s.SessionsForPlayer[joiner] = gs
+	if len(gs.Players) < gs.numPlayers() {
+		// Still waiting on someone.
+		return gs, nil
+	}
+	gs.State = SessionStarted
 	// Get the game started!
 
-	gs.GameManager = NewGameStateManager(gs.SearchCriteria, gs.Players,
-		s.cfg.WordDBServerAddress, id, s.eventsOut, CryptoSeed())
+	cfg := s.gameConfig(gs.Options)
+	if gs.Options.PrivateBoard {
+		cfg.PrivatePlayers = []string{gs.Players[0]}
+	}
+	gs.GameManager = NewGameStateManager(gs.SearchCriteria, slices.Clone(gs.Players),
+		s.cfg.WordDBServerAddress, id, s.eventsOut, CryptoSeed(), cfg)
+	gs.GameManager.SetReplaySink(s.saveReplay)
+	gs.GameManager.SetResultSink(s.saveResult)
+	gs.GameManager.SetQuestions(gs.questions)
+	gs.questions = nil
+	gs.GameManager.StartGameCountdown()
+	go s.cleanupWhenDone(gs)
+	return gs, nil
+}
+
+// startGhostGame starts a single practice game against a replay of one of
+// the seeker's earlier games. There's nobody to wait for, so it starts
+// right away.
+func (s *SessionManager) startGhostGame(seeker, listname string, opts SeekOptions) (*GameSession, error) {
+	ghost := s.Replay(opts.GhostReplayID)
+	if ghost == nil || ghost.Player != seeker {
+		return nil, errors.New("no such replay")
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	if s.draining {
+		return nil, ErrDraining
+	}
+	if _, ok := s.SessionsForPlayer[seeker]; ok {
+		return nil, errors.New("player already in game session")
+	}
+	opts.SeriesMode = SingleGame
+	// There's nobody to match with in practice.
+	opts.AutoReseek = false
+	gs := &GameSession{
+		Players:  []string{seeker, GhostPlayer},
+		ID:       shortuuid.New(),
+		ListName: listname,
+		Options:  opts,
+		State:    SessionStarted,
+	}
+	cfg := s.gameConfig(opts)
+	cfg.Ghost = ghost
+	gs.GameManager = NewGameStateManager(nil, gs.Players, s.cfg.WordDBServerAddress, gs.ID,
+		s.eventsOut, CryptoSeed(), cfg)
+	gs.GameManager.SetReplaySink(s.saveReplay)
+	gs.GameManager.SetResultSink(s.saveResult)
 	gs.GameManager.StartGameCountdown()
+	go s.cleanupWhenDone(gs)
 
-	s.SessionsForPlayer[joiner] = gs
+	s.Sessions[gs.ID] = gs
+	s.SessionsForPlayer[seeker] = gs
 	return gs, nil
 }
 
+// cleanupWhenDone removes the session once its game manager has exited, i.e.
+// the series is finished or the game could not continue.
+func (s *SessionManager) cleanupWhenDone(sess *GameSession) {
+	<-sess.GameManager.Done()
+	s.cleanup(sess)
+	s.rememberGame(sess)
+	if sess.Options.AutoReseek {
+		s.reseek(sess)
+	}
+}
+
+func (s *SessionManager) cleanup(sess *GameSession) {
+	s.Lock()
+	defer s.Unlock()
+	sess.State = SessionEnded
+	if s.Sessions[sess.ID] == sess {
+		delete(s.Sessions, sess.ID)
+	}
+	s.endedPlayers[sess.ID] = sess.Players
+	s.endedOrder = append(s.endedOrder, sess.ID)
+	if len(s.endedOrder) > maxEndedSessions {
+		delete(s.endedPlayers, s.endedOrder[0])
+		s.endedOrder = s.endedOrder[1:]
+	}
+	for _, p := range sess.Players {
+		// The player might be in a newer session already.
+		if s.SessionsForPlayer[p] == sess {
+			delete(s.SessionsForPlayer, p)
+		}
+	}
+}
+
+// GameFor returns the game manager of the game the player is in, or nil if
+// they're not in a game that has started.
+func (s *SessionManager) GameFor(player string) *GameStateManager {
+	s.Lock()
+	defer s.Unlock()
+	sess := s.SessionsForPlayer[player]
+	if sess == nil {
+		return nil
+	}
+	return sess.GameManager
+}
+
+// PlayersIn returns the players in the game session with the given ID, even
+// if it has recently ended, or nil if there's no such session.
+func (s *SessionManager) PlayersIn(id string) []string {
+	s.Lock()
+	defer s.Unlock()
+	if sess := s.Sessions[id]; sess != nil {
+		return append([]string(nil), sess.Players...)
+	}
+	return append([]string(nil), s.endedPlayers[id]...)
+}
+
+// reseek posts the ended session's seek again for its seeker, unless they're
+// already in another session or have disconnected. The check is made with
+// the lock held, so a seeker who goes right after it still has the seek
+// taken down when they're dropped.
+func (s *SessionManager) reseek(ended *GameSession) {
+	seeker := ended.Players[0]
+	s.Lock()
+	if _, ok := s.SessionsForPlayer[seeker]; ok || s.draining {
+		s.Unlock()
+		return
+	}
+	if s.connected != nil && !s.connected(seeker) {
+		s.Unlock()
+		log.Info().Str("seeker", seeker).Str("prev", ended.ID).Msg("no-reseek-disconnected")
+		return
+	}
+	gs := &GameSession{
+		Players:        []string{seeker},
+		ID:             shortuuid.New(),
+		ListName:       ended.ListName,
+		SearchCriteria: ended.SearchCriteria,
+		Options:        ended.Options,
+		NumQuestions:   ended.NumQuestions,
+		State:          SessionOpen,
+	}
+	s.Sessions[gs.ID] = gs
+	s.SessionsForPlayer[seeker] = gs
+	s.Unlock()
+
+	log.Info().Str("seeker", seeker).Str("gid", gs.ID).Str("prev", ended.ID).Msg("auto-reseek")
+	if s.reseekSink != nil {
+		s.reseekSink(gs)
+	}
+}
+
+func (s *SessionManager) isDraining() bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.draining
+}
+
+// DrainForMaintenance gets the server ready to go down. It stops new games
+// from being sought or joined, and cancels open seeks. Games in progress get
+// up to grace to finish on their own; the rest are ended with no winner. It
+// returns once every game is over, with the players whose seeks it
+// cancelled, so the lobby can be told.
+func (s *SessionManager) DrainForMaintenance(grace time.Duration) []string {
+	s.Lock()
+	s.draining = true
+	managers := []*GameStateManager{}
+	dropped := []string{}
+	for id, sess := range s.Sessions {
+		if sess.GameManager == nil {
+			delete(s.Sessions, id)
+			for _, p := range sess.Players {
+				delete(s.SessionsForPlayer, p)
+			}
+			dropped = append(dropped, sess.Players...)
+			continue
+		}
+		managers = append(managers, sess.GameManager)
+	}
+	s.Unlock()
+	log.Info().Int("games", len(managers)).Dur("grace", grace).Msg("draining-for-maintenance")
+
+	deadline := time.After(grace)
+	for i, gm := range managers {
+		select {
+		case <-gm.Done():
+			continue
+		case <-deadline:
+		}
+		log.Info().Int("games-left", len(managers)-i).Msg("drain-grace-over")
+		for _, left := range managers[i:] {
+			left.EndNow(ResultMaintenance)
+		}
+		break
+	}
+	for _, gm := range managers {
+		<-gm.Done()
+	}
+	log.Info().Msg("drained")
+	return dropped
+}
+
+// gameConfig builds the rules for a new game from the server config and the
+// seeker's options.
+func (s *SessionManager) gameConfig(opts SeekOptions) *GameConfig {
+	gc := DefaultGameConfig()
+	gc.MinGuessInterval = s.cfg.MinGuessInterval
+	gc.IdleForfeit = s.cfg.IdleForfeit
+	gc.MaxGameDuration = s.cfg.MaxGameDuration
+	gc.RevealPacing = s.cfg.RevealPacing
+	gc.ReviewPhase = s.cfg.ReviewPhase
+	gc.NoDeath = s.cfg.NoDeath
+	gc.SyncStart = s.cfg.SyncStart
+	gc.TimestampChanges = s.cfg.TimestampChanges
+	gc.ShowBoardStatus = s.cfg.ShowBoardStatus
+	gc.MaxHistory = s.cfg.MaxHistory
+	gc.ArchiveHistory = s.cfg.ArchiveHistory
+	gc.MaxRounds = s.cfg.MaxRounds
+	gc.RedactQueuedAttacks = s.cfg.RedactQueuedAttacks
+	gc.CommitSeed = s.cfg.CommitSeed
+	gc.SeriesMode = opts.SeriesMode
+	gc.QuestionTimeout = time.Duration(opts.QuestionTimeoutSecs) * time.Second
+	gc.RevealOnTimeout = opts.RevealOnTimeout
+	gc.MercyMargin = opts.MercyMargin
+	gc.SolveQueued = opts.SolveQueued
+	gc.SolveTieBreak = opts.SolveTieBreak
+	gc.FallerRidesStack = opts.FallerRidesStack
+	gc.LengthMix = opts.LengthMix
+	gc.LockDelay = time.Duration(opts.LockDelayMs) * time.Millisecond
+	gc.HideOpponentProgress = opts.HideOpponentProgress
+	gc.ScoreWeights = opts.ScoreWeights
+	gc.FaceDown = opts.FaceDown
+	gc.RisePolicy = opts.RisePolicy
+	if opts.RarestFirstBonus {
+		gc.RarestFirstBonus = RarestFirstBonusPoints
+	}
+	gc.Mode = opts.mode()
+	gc.HoldRisesWhenQueueEmpty = opts.HoldRisesWhenQueueEmpty
+	gc.NumSlots = opts.NumSlots
+	gc.ScrambleEvery = time.Duration(opts.ScrambleEverySecs) * time.Second
+	gc.NumQuestions = opts.NumQuestions
+	gc.ReportAlreadySolved = opts.ReportAlreadySolved
+	gc.FreshEachRound = opts.FreshEachRound
+	gc.SpreadAttacks = opts.SpreadAttacks
+	gc.DropDuplicateAttacks = opts.DropDuplicateAttacks
+	gc.ReplayDraws = opts.ReplayDraws
+	return gc
+}
+
+// LobbyStats are counts of what's going on in the lobby, for operators.
+type LobbyStats struct {
+	OpenSeeks      int
+	ActiveGames    int
+	RecentGames    int // finished games still kept in memory
+	PlayersWaiting int // seekers with an open seek
+	PlayersInGames int
+	// HistoryEntries is how many state changes the games in progress are
+	// keeping in their histories, all together.
+	HistoryEntries int
+}
+
+// LobbyStats counts the seeks and games in progress. It's unrelated to the
+// per-player Stats.
+func (s *SessionManager) LobbyStats() LobbyStats {
+	s.Lock()
+	st := LobbyStats{}
+	for _, sess := range s.Sessions {
+		switch sess.State {
+		case SessionOpen:
+			st.OpenSeeks++
+			st.PlayersWaiting += len(sess.Players)
+		case SessionStarted:
+			st.ActiveGames++
+			st.PlayersInGames += len(sess.Players)
+			if sess.GameManager != nil {
+				st.HistoryEntries += sess.GameManager.HistorySize()
+			}
+		}
+	}
+	s.Unlock()
+
+	s.recentMu.Lock()
+	defer s.recentMu.Unlock()
+	st.RecentGames = len(s.recent)
+	return st
+}
+
 func (s *SessionManager) AllSessions() ([]byte, error) {
 	s.Lock()
 	defer s.Unlock()
@@ -138,6 +747,49 @@ func (s *SessionManager) AllSessions() ([]byte, error) {
 	return json.Marshal(sessList)
 }
 
+// Spectate returns what a spectator joining the game late needs to catch up:
+// the last k state changes, and the current state.
+func (s *SessionManager) Spectate(id string, k int) ([]HistoryEntry, []byte, error) {
+	s.Lock()
+	sess := s.Sessions[id]
+	s.Unlock()
+	if sess == nil {
+		return nil, nil, errors.New("session did not exist")
+	}
+	if sess.GameManager == nil {
+		return nil, nil, errors.New("game has not started yet")
+	}
+	return sess.GameManager.RecentHistory(k), sess.GameManager.CurrentState(), nil
+}
+
+// Game returns the game manager for the session with the given ID.
+func (s *SessionManager) Game(id string) (*GameStateManager, error) {
+	s.Lock()
+	sess := s.Sessions[id]
+	s.Unlock()
+	if sess == nil {
+		return nil, errors.New("session did not exist")
+	}
+	if sess.GameManager == nil {
+		return nil, errors.New("game has not started yet")
+	}
+	return sess.GameManager, nil
+}
+
+// TickInfo returns the per-board timing info for a game.
+func (s *SessionManager) TickInfo(id string) ([]TickInfo, error) {
+	s.Lock()
+	sess := s.Sessions[id]
+	s.Unlock()
+	if sess == nil {
+		return nil, errors.New("session did not exist")
+	}
+	if sess.GameManager == nil {
+		return nil, errors.New("game has not started yet")
+	}
+	return sess.GameManager.TickInfo(), nil
+}
+
 // Leave destroys a game. For now any player can do it, but only in between rounds.
 func (s *SessionManager) Leave(leaver, id string) error {
 
@@ -150,6 +802,10 @@ func (s *SessionManager) Leave(leaver, id string) error {
 		if sess.ID != id {
 			return errors.New("unexpected - game session ID did not match!")
 		}
+		if sess.GameManager == nil {
+			// Still a seek, maybe waiting on more players; that's Unseek.
+			return errors.New("game has not started")
+		}
 		players := sess.GameManager.Players
 		err := sess.GameManager.TryDestroy()
 		if err != nil {
@@ -0,0 +1,735 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/domino14/tetrolith/pkg/config"
+)
+
+// testSessions makes a session manager whose word DB has n questions. Seeks
+// are validated.
+func testSessions(t *testing.T, n int) *SessionManager {
+	alphs, _ := testAlphagrams(n)
+	cfg := &config.Config{WordDBServerAddress: fakeWordDB(t, alphs), ValidateSeeks: true}
+	return NewSessionManager(cfg, make(chan []byte, 16))
+}
+
+func TestSeekChecksListSize(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions-1)
+	if _, err := s.Seek("seeker", "small list", []byte("{}"), SeekOptions{}); !errors.Is(err, ErrTooFewQuestions) {
+		t.Fatalf("Seek on a small list: %v, want %v", err, ErrTooFewQuestions)
+	}
+	if len(s.Sessions) != 0 {
+		t.Error("the seek got posted anyway")
+	}
+
+	s = testSessions(t, TotalNumQuestions+23)
+	sess, err := s.Seek("seeker", "big enough", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.NumQuestions != TotalNumQuestions+23 {
+		t.Errorf("NumQuestions = %d, want %d", sess.NumQuestions, TotalNumQuestions+23)
+	}
+	// It has to be big enough for the rounds asked for, too.
+	_, err = s.Seek("seeker2", "big enough", []byte("{}"), SeekOptions{NumQuestions: TotalNumQuestions + 24})
+	if !errors.Is(err, ErrTooFewQuestions) {
+		t.Errorf("seeking more questions than the list has: %v", err)
+	}
+
+	// With validation off, the seek goes up without a count.
+	s = testSessions(t, TotalNumQuestions-1)
+	s.cfg.ValidateSeeks = false
+	sess, err = s.Seek("seeker", "small list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.NumQuestions != 0 {
+		t.Errorf("unvalidated seek has NumQuestions %d", sess.NumQuestions)
+	}
+}
+
+// playOut starts a game for the session on a manual clock and lets it run,
+// with nobody guessing, until it is over.
+func playOut(t *testing.T, s *SessionManager, sess *GameSession) {
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager(sess.SearchCriteria, sess.Players, s.cfg.WordDBServerAddress,
+		sess.ID, stateOut, testSeed(), s.gameConfig(sess.Options))
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	gs.SetResultSink(s.saveResult)
+	sess.GameManager = gs
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	defer close(stop)
+	go runClock(clock, stop)
+
+	timeout := time.After(20 * time.Second)
+	for {
+		select {
+		case bts := <-stateOut:
+			var state struct{ Status Status }
+			if err := json.Unmarshal(bts, &state); err != nil {
+				t.Fatal(err)
+			}
+			if state.Status == PermanentlyOver || state.Status == Finished {
+				return
+			}
+		case <-timeout:
+			t.Fatal("game never ended")
+		}
+	}
+}
+
+func TestSpectateCatchUp(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Spectate(sess.ID, 5); err == nil {
+		t.Error("spectating a game that hasn't started should fail")
+	}
+	sess.Players = append(sess.Players, "joiner")
+	playOut(t, s, sess)
+
+	all, _, err := s.Spectate(sess.ID, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) < 5 {
+		t.Fatalf("only %d state changes in a whole game", len(all))
+	}
+	history, bts, err := s.Spectate(sess.ID, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 5 {
+		t.Fatalf("got %d history entries, want 5", len(history))
+	}
+	for i, e := range history {
+		if want := all[len(all)-5+i]; !reflect.DeepEqual(e, want) {
+			t.Errorf("history[%d] = %+v, want %+v", i, e, want)
+		}
+	}
+
+	// The current state comes after, and agrees with the tail of the history.
+	var state struct {
+		Status Status
+		Boards []struct{ LastStateChange StateChange }
+	}
+	if err := json.Unmarshal(bts, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != PermanentlyOver {
+		t.Errorf("status = %v", state.Status)
+	}
+	last := history[len(history)-1]
+	if last.Change.ChangeType != Lost || !reflect.DeepEqual(state.Boards[last.Board].LastStateChange, last.Change) {
+		t.Errorf("last change %+v doesn't match board state %+v", last, state.Boards)
+	}
+}
+
+func TestSeekSeriesMode(t *testing.T) {
+	s := testSessions(t, 2*TotalNumQuestions)
+	if _, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{SeriesMode: "best-of-7"}); err == nil {
+		t.Error("an unknown series mode was accepted")
+	}
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.Options.SeriesMode != ContinuousSeries {
+		t.Errorf("default series mode = %q", sess.Options.SeriesMode)
+	}
+	if err := s.Unseek("seeker"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A single game cleans up its session once it's over. Nobody guesses,
+	// so each round is a draw and gets replayed, until the list runs out.
+	sess, err = s.Seek("seeker", "list", []byte("{}"), SeekOptions{SeriesMode: SingleGame, ReplayDraws: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	s.SessionsForPlayer["joiner"] = sess
+	playOut(t, s, sess)
+	go s.cleanupWhenDone(sess)
+	if sess.GameManager.Status != PermanentlyOver {
+		t.Errorf("status = %v, want %v", sess.GameManager.Status, PermanentlyOver)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.Lock()
+		left := len(s.Sessions) + len(s.SessionsForPlayer)
+		s.Unlock()
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the finished session was never cleaned up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestSeekOptions checks that each seek option is turned away when it's out
+// of range, and otherwise makes it into the game config.
+func TestSeekOptions(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	for _, tc := range []struct {
+		name    string
+		invalid []SeekOptions
+		valid   SeekOptions
+		ok      func(*GameConfig) bool
+	}{
+		{name: "QuestionTimeout",
+			invalid: []SeekOptions{{QuestionTimeoutSecs: -1}},
+			valid:   SeekOptions{QuestionTimeoutSecs: 30, RevealOnTimeout: true},
+			ok: func(gc *GameConfig) bool {
+				return gc.QuestionTimeout == 30*time.Second && gc.RevealOnTimeout
+			}},
+		{name: "MercyMargin",
+			invalid: []SeekOptions{{MercyMargin: -3}},
+			valid:   SeekOptions{MercyMargin: 6},
+			ok:      func(gc *GameConfig) bool { return gc.MercyMargin == 6 }},
+		{name: "SolveQueued",
+			valid: SeekOptions{SolveQueued: true},
+			ok:    func(gc *GameConfig) bool { return gc.SolveQueued }},
+		{name: "default SolveTieBreak",
+			ok: func(gc *GameConfig) bool { return gc.SolveTieBreak == TieBreakTop }},
+		{name: "SolveTieBreak",
+			invalid: []SeekOptions{{SolveTieBreak: "middle"}},
+			valid:   SeekOptions{SolveTieBreak: TieBreakSeeded},
+			ok:      func(gc *GameConfig) bool { return gc.SolveTieBreak == TieBreakSeeded }},
+		{name: "no mode",
+			ok: func(gc *GameConfig) bool { return gc.Mode == "" }},
+		{name: "NoAttacks",
+			valid: SeekOptions{NoAttacks: true},
+			ok:    func(gc *GameConfig) bool { return gc.Mode == ModeRace }},
+		{name: "FallerRidesStack",
+			valid: SeekOptions{FallerRidesStack: true},
+			ok:    func(gc *GameConfig) bool { return gc.FallerRidesStack }},
+		{name: "LockDelay",
+			invalid: []SeekOptions{{LockDelayMs: MaxLockDelayMs + 1}},
+			valid:   SeekOptions{LockDelayMs: 300},
+			ok:      func(gc *GameConfig) bool { return gc.LockDelay == 300*time.Millisecond }},
+		{name: "HideOpponentProgress",
+			valid: SeekOptions{HideOpponentProgress: true},
+			ok:    func(gc *GameConfig) bool { return gc.HideOpponentProgress }},
+		{name: "ScoreWeights",
+			invalid: []SeekOptions{
+				{ScoreWeights: &ScoreWeights{Survival: -1}},
+				{ScoreWeights: &ScoreWeights{Answer: -1}},
+			},
+			valid: SeekOptions{ScoreWeights: &ScoreWeights{AttacksCleared: 2, AttacksSent: 1, Survival: 5}},
+			ok: func(gc *GameConfig) bool {
+				return gc.ScoreWeights != nil && *gc.ScoreWeights == ScoreWeights{AttacksCleared: 2, AttacksSent: 1, Survival: 5}
+			}},
+		{name: "no RarestFirstBonus",
+			ok: func(gc *GameConfig) bool { return gc.RarestFirstBonus == 0 }},
+		{name: "RarestFirstBonus",
+			valid: SeekOptions{RarestFirstBonus: true},
+			ok:    func(gc *GameConfig) bool { return gc.RarestFirstBonus == RarestFirstBonusPoints }},
+		{name: "FaceDown",
+			valid: SeekOptions{FaceDown: true},
+			ok:    func(gc *GameConfig) bool { return gc.FaceDown }},
+		{name: "default RisePolicy",
+			ok: func(gc *GameConfig) bool { return gc.RisePolicy == RiseBatch }},
+		{name: "RisePolicy",
+			invalid: []SeekOptions{{RisePolicy: "never"}},
+			valid:   SeekOptions{RisePolicy: RisePerAttack},
+			ok:      func(gc *GameConfig) bool { return gc.RisePolicy == RisePerAttack }},
+		{name: "Counterattack",
+			invalid: []SeekOptions{
+				{Counterattack: true, NoAttacks: true},
+				{Counterattack: true, Mode: ModeClassic},
+			},
+			valid: SeekOptions{Counterattack: true},
+			ok:    func(gc *GameConfig) bool { return gc.Mode == ModeCounterattack }},
+		{name: "Mode",
+			invalid: []SeekOptions{{Mode: "nosuchmode"}},
+			valid:   SeekOptions{Mode: ModeRace},
+			ok:      func(gc *GameConfig) bool { return gc.Mode == ModeRace }},
+		{name: "HoldRisesWhenQueueEmpty",
+			valid: SeekOptions{HoldRisesWhenQueueEmpty: true},
+			ok:    func(gc *GameConfig) bool { return gc.HoldRisesWhenQueueEmpty }},
+		{name: "FreshEachRound",
+			invalid: []SeekOptions{{FreshEachRound: true, GhostReplayID: "r"}},
+			valid:   SeekOptions{FreshEachRound: true},
+			ok:      func(gc *GameConfig) bool { return gc.FreshEachRound }},
+		{name: "SpreadAttacks",
+			invalid: []SeekOptions{{SpreadAttacks: true, NoAttacks: true}, {SpreadAttacks: true, Mode: ModeCoop}},
+			valid:   SeekOptions{SpreadAttacks: true},
+			ok:      func(gc *GameConfig) bool { return gc.SpreadAttacks }},
+		{name: "NumSlots",
+			invalid: []SeekOptions{{NumSlots: MinNumSlots - 1}, {NumSlots: MaxNumSlots + 1}, {NumSlots: -1}},
+			valid:   SeekOptions{NumSlots: 10},
+			ok:      func(gc *GameConfig) bool { return gc.NumSlots == 10 }},
+		{name: "NumQuestions",
+			invalid: []SeekOptions{{NumQuestions: MinNumQuestions - 1}, {NumQuestions: MaxNumQuestions + 1}},
+			valid:   SeekOptions{NumQuestions: 20},
+			ok:      func(gc *GameConfig) bool { return gc.NumQuestions == 20 }},
+		{name: "DropDuplicateAttacks",
+			valid: SeekOptions{DropDuplicateAttacks: true},
+			ok:    func(gc *GameConfig) bool { return gc.DropDuplicateAttacks }},
+		{name: "ReplayDraws",
+			valid: SeekOptions{ReplayDraws: true},
+			ok:    func(gc *GameConfig) bool { return gc.ReplayDraws }},
+	} {
+		for _, opts := range tc.invalid {
+			if _, err := s.Seek(tc.name, "list", []byte("{}"), opts); err == nil {
+				t.Errorf("%s: %+v was accepted", tc.name, opts)
+			}
+		}
+		sess, err := s.Seek(tc.name, "list", []byte("{}"), tc.valid)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !tc.ok(s.gameConfig(sess.Options)) {
+			t.Errorf("%s didn't make it into the game config", tc.name)
+		}
+	}
+}
+
+func TestPlayersInEndedSession(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	playOut(t, s, sess)
+	s.cleanupWhenDone(sess)
+
+	if s.Sessions[sess.ID] != nil {
+		t.Fatal("the session wasn't cleaned up")
+	}
+	if got := s.PlayersIn(sess.ID); !slices.Equal(got, []string{"seeker", "joiner"}) {
+		t.Errorf("players in the ended session: %v", got)
+	}
+	if got := s.PlayersIn("unknown"); got != nil {
+		t.Errorf("players in an unknown session: %v", got)
+	}
+}
+
+func TestAutoReseek(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	var reseeks []*GameSession
+	s.SetReseekSink(func(sess *GameSession) { reseeks = append(reseeks, sess) })
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{AutoReseek: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	playOut(t, s, sess)
+	s.cleanupWhenDone(sess)
+
+	if len(reseeks) != 1 {
+		t.Fatalf("%d reseeks announced", len(reseeks))
+	}
+	open := reseeks[0]
+	if s.Sessions[open.ID] != open || s.SessionsForPlayer["seeker"] != open {
+		t.Error("the new seek isn't open")
+	}
+	if open.ID == sess.ID || !slices.Equal(open.Players, []string{"seeker"}) ||
+		open.ListName != sess.ListName || !open.Options.AutoReseek {
+		t.Errorf("new seek %+v", open)
+	}
+	if _, ok := s.SessionsForPlayer["joiner"]; ok {
+		t.Error("the joiner got a seek too")
+	}
+}
+
+func TestNoReseekWhenDisconnected(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	var reseeks []*GameSession
+	s.SetReseekSink(func(sess *GameSession) { reseeks = append(reseeks, sess) })
+	s.SetConnectedCheck(func(player string) bool { return player != "seeker" })
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{AutoReseek: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	playOut(t, s, sess)
+	s.cleanupWhenDone(sess)
+
+	if len(reseeks) != 0 || len(s.Sessions) != 0 {
+		t.Errorf("a seek was posted again for a seeker who's gone: %v", s.Sessions)
+	}
+	if _, ok := s.SessionsForPlayer["seeker"]; ok {
+		t.Error("the gone seeker is still in a session")
+	}
+}
+
+func TestRecentGames(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	s.cfg.RecentGames = 1
+	var played []*GameSession
+	for _, seeker := range []string{"first", "second"} {
+		sess, err := s.Seek(seeker, "list", []byte("{}"), SeekOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.Players = append(sess.Players, "joiner")
+		s.saveReplay(&Replay{ID: "replay-" + seeker, GameID: sess.ID, Player: seeker})
+		playOut(t, s, sess)
+		s.cleanupWhenDone(sess)
+		played = append(played, sess)
+	}
+
+	recent := s.RecentGames()
+	if len(recent) != 1 || recent[0].ID != played[1].ID {
+		t.Fatalf("recent games %+v, want just the second", recent)
+	}
+	if rg := recent[0]; !slices.Equal(rg.ReplayIDs, []string{"replay-second"}) || rg.Result == nil {
+		t.Errorf("recent game %+v", rg)
+	}
+	if s.RecentGame(played[0].ID) != nil {
+		t.Error("the first game is still around")
+	}
+	if ids := s.ReplaysFor("first"); len(ids) != 0 {
+		t.Errorf("the first game's replays are still around: %v", ids)
+	}
+}
+
+func TestNoRecentGamesKeepsNoReplays(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	s.cfg.RecentGames = 0
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	s.saveReplay(&Replay{ID: "replay", GameID: sess.ID, Player: "seeker"})
+	playOut(t, s, sess)
+	s.cleanupWhenDone(sess)
+	if len(s.RecentGames()) != 0 || s.Replay("replay") != nil {
+		t.Error("the game or its replay was kept")
+	}
+}
+
+func TestLobbyStats(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	s.cfg.RecentGames = 5
+	done, err := s.Seek("done", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done.Players = append(done.Players, "joiner")
+	playOut(t, s, done)
+	s.cleanupWhenDone(done)
+
+	for _, seeker := range []string{"first", "second", "third"} {
+		if _, err := s.Seek(seeker, "list", []byte("{}"), SeekOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	started, err := s.Join("joiner", s.SessionsForPlayer["third"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer started.GameManager.EndNow("test")
+
+	want := LobbyStats{OpenSeeks: 2, ActiveGames: 1, RecentGames: 1, PlayersWaiting: 2, PlayersInGames: 2}
+	if got := s.LobbyStats(); got != want {
+		t.Errorf("LobbyStats = %+v, want %+v", got, want)
+	}
+}
+
+func TestJoinOnlyOpenSessions(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.State != SessionOpen {
+		t.Fatalf("a new seek is %q", sess.State)
+	}
+	sess.State = SessionEnded
+	if _, err := s.Join("late", sess.ID); err == nil {
+		t.Error("joined an ended session")
+	}
+
+	sess.State = SessionOpen
+	if _, err := s.Join("joiner", sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if sess.State != SessionStarted || !slices.Equal(sess.Players, []string{"seeker", "joiner"}) {
+		t.Errorf("joined session is %q with %v", sess.State, sess.Players)
+	}
+	if _, err := s.Join("third", sess.ID); err == nil {
+		t.Error("joined a started session")
+	}
+	if !slices.Equal(sess.Players, []string{"seeker", "joiner"}) {
+		t.Errorf("players changed to %v", sess.Players)
+	}
+}
+
+func TestSeekAndJoinPlayerOrder(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Join("joiner", sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sess.Players, []string{"seeker", "joiner"}) ||
+		!slices.Equal(sess.GameManager.Players, sess.Players) {
+		t.Errorf("players %v, in the game %v", sess.Players, sess.GameManager.Players)
+	}
+
+	// A seek that somehow lost its seeker can't be joined.
+	odd, err := s.Seek("other", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	odd.Players = append(odd.Players, "stowaway")
+	if _, err := s.Join("late", odd.ID); !errors.Is(err, ErrBadPlayerOrder) {
+		t.Errorf("joining a seek with players %v: %v", odd.Players, err)
+	}
+}
+
+func TestJoinUpToNumPlayers(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	for _, n := range []int{1, MaxNumPlayers + 1} {
+		if _, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{NumPlayers: n}); err == nil {
+			t.Errorf("a seek for %d players was accepted", n)
+		}
+	}
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{NumPlayers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Join("b", sess.ID); err != nil {
+		t.Fatal(err)
+	}
+	if sess.State != SessionOpen || sess.GameManager != nil {
+		t.Fatalf("the game started with %v", sess.Players)
+	}
+	if _, err := s.Join("b", sess.ID); err == nil {
+		t.Error("b joined twice")
+	}
+	// There's no game to leave yet.
+	if err := s.Leave("b", sess.ID); err == nil {
+		t.Error("b left a game that hasn't started")
+	}
+
+	// Someone waiting can leave without taking the seek down.
+	if err := s.Unseek("b"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(sess.Players, []string{"seeker"}) || s.Sessions[sess.ID] != sess {
+		t.Errorf("after b left, players %v", sess.Players)
+	}
+
+	for _, p := range []string{"c", "d"} {
+		if _, err := s.Join(p, sess.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer sess.GameManager.EndNow("test")
+	if sess.State != SessionStarted || !slices.Equal(sess.GameManager.Players, []string{"seeker", "c", "d"}) {
+		t.Errorf("session is %q with %v", sess.State, sess.Players)
+	}
+	if _, err := s.Join("e", sess.ID); err == nil {
+		t.Error("joined a full game")
+	}
+
+	// The seeker leaving takes everyone waiting with them.
+	open, err := s.Seek("other", "list", []byte("{}"), SeekOptions{NumPlayers: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Join("f", open.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unseek("other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.SessionsForPlayer["f"]; ok || s.Sessions[open.ID] != nil {
+		t.Error("the seek is still around")
+	}
+}
+
+// TestGameConfigFromServerConfig checks that the server's flags make it into
+// the game config.
+func TestGameConfigFromServerConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  config.Config
+		ok   func(*GameConfig) bool
+	}{
+		{name: "NoDeath", cfg: config.Config{NoDeath: true},
+			ok: func(gc *GameConfig) bool { return gc.NoDeath }},
+		{name: "RevealPacing", cfg: config.Config{RevealPacing: 2 * time.Second},
+			ok: func(gc *GameConfig) bool { return gc.RevealPacing == 2*time.Second }},
+		{name: "ReviewPhase", cfg: config.Config{ReviewPhase: 30 * time.Second},
+			ok: func(gc *GameConfig) bool { return gc.ReviewPhase == 30*time.Second }},
+		{name: "SyncStart", cfg: config.Config{SyncStart: true},
+			ok: func(gc *GameConfig) bool { return gc.SyncStart }},
+		{name: "TimestampChanges", cfg: config.Config{TimestampChanges: true},
+			ok: func(gc *GameConfig) bool { return gc.TimestampChanges }},
+		{name: "MaxRounds", cfg: config.Config{MaxRounds: 3},
+			ok: func(gc *GameConfig) bool { return gc.MaxRounds == 3 }},
+		{name: "ShowBoardStatus", cfg: config.Config{ShowBoardStatus: true},
+			ok: func(gc *GameConfig) bool { return gc.ShowBoardStatus }},
+		{name: "RedactQueuedAttacks", cfg: config.Config{RedactQueuedAttacks: true},
+			ok: func(gc *GameConfig) bool { return gc.RedactQueuedAttacks }},
+		{name: "CommitSeed", cfg: config.Config{CommitSeed: true},
+			ok: func(gc *GameConfig) bool { return gc.CommitSeed }},
+	} {
+		s := NewSessionManager(&tc.cfg, nil)
+		if !tc.ok(s.gameConfig(SeekOptions{})) {
+			t.Errorf("%s didn't make it into the game config", tc.name)
+		}
+	}
+}
+
+func TestGuessOnlyInYourGame(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	game := &GameSession{
+		ID:          "gid",
+		Players:     []string{"a", "b"},
+		GameManager: NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil),
+	}
+	s.Sessions[game.ID] = game
+	s.SessionsForPlayer["a"] = game
+	s.SessionsForPlayer["b"] = game
+
+	if err := s.SendGuess("c", "gid", "word"); !errors.Is(err, ErrNotInGame) {
+		t.Errorf("guessing in someone else's game: %v", err)
+	}
+
+	// a left, and is seeking a new game while the old one winds down.
+	delete(s.SessionsForPlayer, "a")
+	if _, err := s.Seek("a", "list", []byte("{}"), SeekOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendGuess("a", "gid", "word"); !errors.Is(err, ErrNotInGame) {
+		t.Errorf("guessing after leaving: %v", err)
+	}
+}
+
+func TestSeekChecksLengthMix(t *testing.T) {
+	// testAlphagrams are all four letters long.
+	s := testSessions(t, TotalNumQuestions)
+	if _, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{LengthMix: LengthMix{4: 1, 5: 1}}); !errors.Is(err, ErrTooFewQuestions) {
+		t.Errorf("a mix the list can't fill: %v", err)
+	}
+	for _, mix := range []LengthMix{{}, {4: 0}, {4: 1, 5: -1}} {
+		if _, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{LengthMix: mix}); err == nil {
+			t.Errorf("mix %v was accepted", mix)
+		}
+	}
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{LengthMix: LengthMix{4: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !maps.Equal(s.gameConfig(sess.Options).LengthMix, LengthMix{4: 1}) {
+		t.Error("the length mix didn't make it into the game config")
+	}
+}
+
+// startPlaying starts the session's game on a manual clock that runs as fast
+// as it can, throwing away the states it sends out. The returned channel is
+// closed once the first round is being played.
+func startPlaying(t *testing.T, s *SessionManager, sess *GameSession) <-chan struct{} {
+	stateOut := make(chan []byte)
+	gs := NewGameStateManager(sess.SearchCriteria, sess.Players, s.cfg.WordDBServerAddress,
+		sess.ID, stateOut, testSeed(), s.gameConfig(sess.Options))
+	clock := NewManualClock(testEpoch)
+	gs.SetClock(clock)
+	sess.GameManager = gs
+	gs.StartGameCountdown()
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go runClock(clock, stop)
+	playing := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case bts := <-stateOut:
+				var state struct{ Status Status }
+				if err := json.Unmarshal(bts, &state); err == nil && state.Status == Playing {
+					select {
+					case <-playing:
+					default:
+						close(playing)
+					}
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return playing
+}
+
+func TestDrainForMaintenance(t *testing.T) {
+	for _, finishes := range []bool{true, false} {
+		// Nobody guesses, so a single game is over once the list runs out.
+		// A continuous series of a big list goes on well past the grace.
+		n, mode := 2*TotalNumQuestions, SingleGame
+		if !finishes {
+			n, mode = 1000*TotalNumQuestions, ContinuousSeries
+		}
+		s := testSessions(t, n)
+		playing, err := s.Seek("a", "list", []byte("{}"), SeekOptions{SeriesMode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		playing.Players = append(playing.Players, "b")
+		s.SessionsForPlayer["b"] = playing
+		<-startPlaying(t, s, playing)
+		open, err := s.Seek("c", "list", []byte("{}"), SeekOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		grace := 10 * time.Second
+		if !finishes {
+			grace = 0
+		}
+		done := make(chan struct{})
+		var dropped []string
+		go func() {
+			dropped = s.DrainForMaintenance(grace)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(20 * time.Second):
+			t.Fatal("the drain never finished")
+		}
+
+		if _, err := s.Seek("d", "list", []byte("{}"), SeekOptions{}); !errors.Is(err, ErrDraining) {
+			t.Errorf("seeking while draining: %v", err)
+		}
+		if _, err := s.Join("d", open.ID); !errors.Is(err, ErrDraining) {
+			t.Errorf("joining while draining: %v", err)
+		}
+		s.Lock()
+		_, stillOpen := s.Sessions[open.ID]
+		s.Unlock()
+		if stillOpen || !slices.Equal(dropped, []string{"c"}) {
+			t.Errorf("the open seek wasn't cancelled (dropped %v)", dropped)
+		}
+		gm := playing.GameManager
+		if gm.Status != Finished && gm.Status != PermanentlyOver {
+			t.Errorf("finishes %v: the game ended %v", finishes, gm.Status)
+		}
+		if ended := gm.Result.Reason == ResultMaintenance; ended == finishes {
+			t.Errorf("finishes %v: the game ended with %+v", finishes, gm.Result)
+		}
+	}
+}
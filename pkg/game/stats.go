@@ -0,0 +1,191 @@
+package game
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// A PlayerResult is how one game went for one player. A game is the whole
+// series, however many rounds it ran to: Won is for winning the most rounds,
+// and Solved counts the answers solved over all of them.
+type PlayerResult struct {
+	GameID string
+	Player string
+	Won    bool
+	Draw   bool
+	Solved int
+	// FastestSolve is the shortest time between a question landing on the
+	// player's board and them fully solving it. Zero if they solved nothing.
+	FastestSolve time.Duration
+}
+
+// PlayerStats are a player's all-time stats. Everyone can see how many games
+// a player has played and won; the rest is only filled in for the player
+// themselves.
+type PlayerStats struct {
+	Player       string
+	GamesPlayed  int
+	GamesWon     int
+	AvgSolved    float64 `json:",omitempty"`
+	BestStreak   int     `json:",omitempty"`
+	FastestSolve int64   `json:",omitempty"` // in ms
+}
+
+// SetResultSink sets a function that gets every player's result at the end
+// of the game. It's called from the manager loop.
+func (gs *GameStateManager) SetResultSink(sink func(PlayerResult)) {
+	gs.resultSink = sink
+}
+
+// tallyRound adds each board's solves this round to the series totals. See
+// countRound.
+func (gs *GameStateManager) tallyRound() {
+	if gs.seriesSolved == nil {
+		gs.seriesSolved = make([]int, len(gs.Boards))
+		gs.seriesFastest = make([]time.Duration, len(gs.Boards))
+	}
+	for i, gb := range gs.Boards {
+		gs.seriesSolved[i] += gb.Solved
+		if gb.fastestSolve > 0 && (gs.seriesFastest[i] == 0 || gb.fastestSolve < gs.seriesFastest[i]) {
+			gs.seriesFastest[i] = gb.fastestSolve
+		}
+	}
+}
+
+// saveResults sends each real player's result for the game to the result
+// sink, once the manager loop is done with it.
+func (gs *GameStateManager) saveResults() {
+	if gs.resultSink == nil || gs.RoundsPlayed == 0 ||
+		(gs.Result != nil && gs.Result.Reason == ResultMaintenance) {
+		// Games we cut short don't count.
+		return
+	}
+	winner := topScorer(gs.RoundsWon)
+	for i, p := range gs.Players {
+		if gs.isGhost(i) {
+			continue
+		}
+		won, draw := winner == i, winner == NoWinner
+		if gs.Result != nil && gs.Result.isTeamResult() {
+			// A team wins or loses together, on whether it cleared more of
+			// its rounds than not.
+			won, draw = 2*gs.RoundsWon[i] > gs.RoundsPlayed, 2*gs.RoundsWon[i] == gs.RoundsPlayed
+		}
+		gs.resultSink(PlayerResult{
+			GameID:       gs.ID,
+			Player:       p,
+			Won:          won,
+			Draw:         draw,
+			Solved:       gs.seriesSolved[i],
+			FastestSolve: gs.seriesFastest[i],
+		})
+	}
+}
+
+// A ResultStore keeps every player's results, so that their stats outlive
+// the server.
+type ResultStore interface {
+	// Load returns all the results saved so far, oldest first.
+	Load() ([]PlayerResult, error)
+	Save(PlayerResult) error
+}
+
+// resultFile is a ResultStore that appends the results to a file, one JSON
+// object a line.
+type resultFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewResultFile returns a ResultStore that keeps the results in the file at
+// path. The file is created on the first save if it isn't there.
+func NewResultFile(path string) ResultStore {
+	return &resultFile{path: path}
+}
+
+func (rf *resultFile) Load() ([]PlayerResult, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	f, err := os.Open(rf.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var results []PlayerResult
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		var r PlayerResult
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", rf.path, line, err)
+		}
+		results = append(results, r)
+	}
+	return results, sc.Err()
+}
+
+func (rf *resultFile) Save(r PlayerResult) error {
+	bts, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	f, err := os.OpenFile(rf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(bts, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// playerRecord is a player's running totals over all their games, so that
+// keeping stats doesn't mean keeping every result.
+type playerRecord struct {
+	played       int
+	won          int
+	totalSolved  int
+	streak       int
+	bestStreak   int
+	fastestSolve time.Duration
+}
+
+func (pr *playerRecord) add(r PlayerResult) {
+	pr.played++
+	pr.totalSolved += r.Solved
+	if r.Won {
+		pr.won++
+		pr.streak++
+		pr.bestStreak = max(pr.bestStreak, pr.streak)
+	} else {
+		pr.streak = 0
+	}
+	if r.FastestSolve > 0 && (pr.fastestSolve == 0 || r.FastestSolve < pr.fastestSolve) {
+		pr.fastestSolve = r.FastestSolve
+	}
+}
+
+// stats returns the player's stats from the record. If full isn't set, only
+// the public stats are filled in.
+func (pr *playerRecord) stats(player string, full bool) PlayerStats {
+	st := PlayerStats{Player: player, GamesPlayed: pr.played, GamesWon: pr.won}
+	if !full {
+		return st
+	}
+	if pr.played > 0 {
+		st.AvgSolved = float64(pr.totalSolved) / float64(pr.played)
+	}
+	st.BestStreak = pr.bestStreak
+	st.FastestSolve = pr.fastestSolve.Milliseconds()
+	return st
+}
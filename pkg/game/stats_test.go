@@ -0,0 +1,88 @@
+package game
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPlayerRecord(t *testing.T) {
+	var pr playerRecord
+	for _, r := range []PlayerResult{
+		{Won: true, Solved: 10, FastestSolve: 3 * time.Second},
+		{Won: true, Solved: 20},
+		{Solved: 0},
+		{Won: true, Solved: 30, FastestSolve: 1500 * time.Millisecond},
+	} {
+		pr.add(r)
+	}
+	want := PlayerStats{Player: "p", GamesPlayed: 4, GamesWon: 3, AvgSolved: 15, BestStreak: 2, FastestSolve: 1500}
+	if got := pr.stats("p", true); got != want {
+		t.Errorf("full stats %+v, want %+v", got, want)
+	}
+	want = PlayerStats{Player: "p", GamesPlayed: 4, GamesWon: 3}
+	if got := pr.stats("p", false); got != want {
+		t.Errorf("public stats %+v, want %+v", got, want)
+	}
+}
+
+func TestSessionStats(t *testing.T) {
+	s := testSessions(t, TotalNumQuestions)
+	if got := s.Stats("nobody", "nobody"); got != (PlayerStats{Player: "nobody"}) {
+		t.Errorf("stats for someone who never played: %+v", got)
+	}
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	playOut(t, s, sess)
+
+	for _, p := range sess.Players {
+		if got := s.Stats(p, p); got.GamesPlayed != 1 {
+			t.Errorf("%s played %d games", p, got.GamesPlayed)
+		}
+	}
+	// Only as many records as players, however many rounds get played.
+	if len(s.results) != 2 {
+		t.Errorf("%d records", len(s.results))
+	}
+}
+
+func TestStatsCountSeries(t *testing.T) {
+	s := testSessions(t, 3*TotalNumQuestions)
+	s.cfg.MaxRounds = 3
+	sess, err := s.Seek("seeker", "list", []byte("{}"), SeekOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Players = append(sess.Players, "joiner")
+	playOut(t, s, sess)
+	if n := sess.GameManager.RoundsPlayed; n != 3 {
+		t.Fatalf("played %d rounds, want 3", n)
+	}
+	// Three rounds, one game.
+	if got := s.Stats("seeker", "seeker"); got.GamesPlayed != 1 {
+		t.Errorf("seeker played %d games", got.GamesPlayed)
+	}
+}
+
+func TestResultFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results")
+	s := testSessions(t, TotalNumQuestions)
+	if err := s.UseResultStore(NewResultFile(path)); err != nil {
+		t.Fatal(err)
+	}
+	s.saveResult(PlayerResult{GameID: "g1", Player: "p", Won: true, Solved: 10})
+	s.saveResult(PlayerResult{GameID: "g2", Player: "p", Solved: 20, FastestSolve: time.Second})
+
+	// A new server picks up where the old one left off.
+	s = testSessions(t, TotalNumQuestions)
+	if err := s.UseResultStore(NewResultFile(path)); err != nil {
+		t.Fatal(err)
+	}
+	want := PlayerStats{Player: "p", GamesPlayed: 2, GamesWon: 1, AvgSolved: 15, BestStreak: 1, FastestSolve: 1000}
+	if got := s.Stats("p", "p"); got != want {
+		t.Errorf("stats after a restart %+v, want %+v", got, want)
+	}
+}
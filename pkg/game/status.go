@@ -0,0 +1,121 @@
+package game
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Statuses go out by name, so that front-ends don't have to know the order
+// of the consts.
+var statusNames = map[Status]string{
+	Countdown:       "countdown",
+	Playing:         "playing",
+	PermanentlyOver: "over",
+	Finished:        "finished",
+	Reviewing:       "reviewing",
+}
+
+var boardStatusNames = map[BoardStatus]string{
+	PieceDropping:    "dropping",
+	PieceAboutToDrop: "abouttodrop",
+	PlayerQueueEmpty: "queueempty",
+	PieceLocking:     "locking",
+}
+
+// stateChangeTypes are all the known state changes. An empty one is fine
+// too: it's a board that hasn't changed yet.
+var stateChangeTypes = map[StateChangeType]bool{
+	"":                       true,
+	PieceFall:                true,
+	PieceLand:                true,
+	PieceLocked:              true,
+	PieceForcedDrop:          true,
+	StackRise:                true,
+	StackQueue:               true,
+	FullySolveQuestion:       true,
+	QuestionTimedOut:         true,
+	IdleWarning:              true,
+	FullySolveQueuedQuestion: true,
+	AnswersRevealed:          true,
+	Lost:                     true,
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return "Status(" + strconv.Itoa(int(s)) + ")"
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	return marshalName(statusNames, s, "status")
+}
+
+// UnmarshalJSON takes a status by name, or by number, the way they used to
+// go out, so older saved games still load.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	return unmarshalName(statusNames, s, "status", data)
+}
+
+func (s BoardStatus) String() string {
+	if name, ok := boardStatusNames[s]; ok {
+		return name
+	}
+	return "BoardStatus(" + strconv.Itoa(int(s)) + ")"
+}
+
+func (s BoardStatus) MarshalJSON() ([]byte, error) {
+	return marshalName(boardStatusNames, s, "board status")
+}
+
+// UnmarshalJSON takes a board status by name or by number, like Status.
+func (s *BoardStatus) UnmarshalJSON(data []byte) error {
+	return unmarshalName(boardStatusNames, s, "board status", data)
+}
+
+// UnmarshalJSON turns away state changes it doesn't know.
+func (t *StateChangeType) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	if !stateChangeTypes[StateChangeType(name)] {
+		return fmt.Errorf("unknown state change %q", name)
+	}
+	*t = StateChangeType(name)
+	return nil
+}
+
+func marshalName[T ~int](names map[T]string, v T, what string) ([]byte, error) {
+	name, ok := names[v]
+	if !ok {
+		return nil, fmt.Errorf("unknown %s %d", what, int(v))
+	}
+	return json.Marshal(name)
+}
+
+func unmarshalName[T ~int](names map[T]string, v *T, what string, data []byte) error {
+	if len(data) > 0 && data[0] != '"' {
+		var n int
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		if _, ok := names[T(n)]; !ok {
+			return fmt.Errorf("unknown %s %d", what, n)
+		}
+		*v = T(n)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for k, n := range names {
+		if n == name {
+			*v = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s %q", what, name)
+}
@@ -0,0 +1,63 @@
+package game
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStatusJSON(t *testing.T) {
+	for s, name := range statusNames {
+		bts, err := json.Marshal(s)
+		if err != nil || string(bts) != `"`+name+`"` {
+			t.Errorf("%d marshaled to %s (%v)", s, bts, err)
+		}
+		var back Status
+		if err := json.Unmarshal(bts, &back); err != nil || back != s {
+			t.Errorf("%s unmarshaled to %v (%v)", bts, back, err)
+		}
+	}
+	for s, name := range boardStatusNames {
+		bts, err := json.Marshal(s)
+		if err != nil || string(bts) != `"`+name+`"` {
+			t.Errorf("board status %d marshaled to %s (%v)", s, bts, err)
+		}
+		var back BoardStatus
+		if err := json.Unmarshal(bts, &back); err != nil || back != s {
+			t.Errorf("%s unmarshaled to %v (%v)", bts, back, err)
+		}
+	}
+
+	// Numbers still work, for games saved before statuses had names.
+	var s Status
+	if err := json.Unmarshal([]byte("1"), &s); err != nil || s != Playing {
+		t.Errorf("1 unmarshaled to %v (%v)", s, err)
+	}
+	for _, bad := range []string{`"paused"`, "99", "-1"} {
+		if err := json.Unmarshal([]byte(bad), &s); err == nil {
+			t.Errorf("%s unmarshaled to %v", bad, s)
+		}
+	}
+	if _, err := json.Marshal(Status(99)); err == nil {
+		t.Error("an unknown status marshaled")
+	}
+
+	gs := NewGameStateManager(nil, []string{"a", "b"}, "", "gid", nil, testSeed(), nil)
+	if state := string(gs.publishState()); !strings.Contains(state, `"Status":"countdown"`) {
+		t.Errorf("state went out as %s", state)
+	}
+}
+
+func TestStateChangeTypeJSON(t *testing.T) {
+	var sc StateChange
+	if err := json.Unmarshal([]byte(`{"ChangeType":"stackrise","PayloadNum":3}`), &sc); err != nil ||
+		sc.ChangeType != StackRise {
+		t.Errorf("got %+v (%v)", sc, err)
+	}
+	if err := json.Unmarshal([]byte(`{"ChangeType":""}`), &sc); err != nil {
+		t.Errorf("no change yet: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"ChangeType":"teleport"}`), &sc); err == nil {
+		t.Errorf("an unknown change unmarshaled to %+v", sc)
+	}
+}
@@ -4,6 +4,7 @@ package sockets
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -76,18 +77,51 @@ type Client struct {
 
 	connID    string
 	connToken string
+	// The game ID this client is spectating, if any. Only touched by the hub.
+	spectating string
+	// The player whose view of the game this spectator gets, if it's
+	// following one. Only touched by the hub.
+	following string
+	// The sequence number of the last game state sent to this client. Only
+	// touched by the hub.
+	stateSeq uint64
 
 	forwardedFor string
 	pongCount    int
 	lastPingSent time.Time
 	// The round-trip lag; it is a sort of average.
 	avglag time.Duration
+	// When we last sent the client its lag.
+	lastLagReport time.Time
+
+	// Capabilities that both this client and the server support, from the
+	// client's HELLO. Clients that never say HELLO get the minimal set.
+	caps map[string]bool
+
+	// Consecutive malformed commands, and when the first of them came in.
+	invalidCommands     int
+	firstInvalidCommand time.Time
 }
 
 func (c *Client) sendError(err error) {
 	c.send <- []byte("ERROR: " + err.Error())
 }
 
+// maybeSendLatency sends the client its latency if it's due, according to
+// the lag report settings. The latency itself is updated on every pong
+// regardless.
+func (c *Client) maybeSendLatency(now time.Time) {
+	cfg := c.hub.cfg
+	if cfg.LagReportEvery > 1 && c.pongCount%cfg.LagReportEvery != 0 {
+		return
+	}
+	if cfg.LagReportInterval > 0 && now.Sub(c.lastLagReport) < cfg.LagReportInterval {
+		return
+	}
+	c.lastLagReport = now
+	c.sendLatency()
+}
+
 func (c *Client) sendLatency() {
 	c.send <- []byte(fmt.Sprintf("LAGMS: %d", c.avglag/time.Millisecond))
 }
@@ -133,7 +167,7 @@ func (c *Client) readPump() {
 		// for a bit.
 		//log.Debug().Str("username", c.username).Msg("single-pong")
 		//}
-		c.sendLatency()
+		c.maybeSendLatency(received)
 		return nil
 	})
 	for {
@@ -152,6 +186,11 @@ func (c *Client) readPump() {
 		// potentially.
 
 		err = c.hub.parseAndExecuteMessage(context.Background(), message, c)
+		if errors.Is(err, errTooManyInvalidCommands) {
+			log.Info().Str("username", c.username).Str("connID", c.connID).Msg("too-many-invalid-commands")
+			c.closeWithPolicyViolation(err.Error())
+			break
+		}
 		if err != nil {
 			log.Err(err).Str("username", c.username).Msg("parse-and-execute-message")
 			c.sendError(err)
@@ -187,19 +226,7 @@ func (c *Client) writePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			w.Write(message)
-
-			// Add queued messages to the current websocket message.
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.send)
-			}
-
-			if err := w.Close(); err != nil {
+			if err := c.writeQueued(message); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -214,6 +241,87 @@ func (c *Client) writePump() {
 	}
 }
 
+// writeQueued writes the message, and whatever else is queued up behind it.
+// Queued text messages get added to the current websocket message; binary
+// ones (see isBinary) each get a websocket message of their own.
+func (c *Client) writeQueued(msg []byte) error {
+	n := len(c.send)
+	for msg != nil {
+		frameType := websocket.TextMessage
+		if isBinary(msg) {
+			frameType = websocket.BinaryMessage
+		}
+		w, err := c.conn.NextWriter(frameType)
+		if err != nil {
+			return err
+		}
+		w.Write(msg)
+		msg = nil
+		for n > 0 {
+			next := <-c.send
+			n--
+			if frameType == websocket.BinaryMessage || isBinary(next) {
+				msg = next
+				break
+			}
+			w.Write(next)
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) setCaps(clientCaps []string) {
+	caps := make(map[string]bool)
+	for _, cc := range clientCaps {
+		for _, sc := range serverCaps {
+			if cc == sc {
+				caps[cc] = true
+			}
+		}
+	}
+	c.Lock()
+	c.caps = caps
+	c.Unlock()
+}
+
+func (c *Client) hasCap(name string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	return c.caps[name]
+}
+
+// recordInvalidCommand counts a malformed command, and returns true if the
+// connection has now sent too many of them within the configured window.
+func (c *Client) recordInvalidCommand(limit int, window time.Duration) bool {
+	if limit <= 0 {
+		return false
+	}
+	now := time.Now()
+	if c.invalidCommands == 0 || now.Sub(c.firstInvalidCommand) > window {
+		c.invalidCommands = 0
+		c.firstInvalidCommand = now
+	}
+	c.invalidCommands++
+	return c.invalidCommands >= limit
+}
+
+func (c *Client) resetInvalidCommands() {
+	c.invalidCommands = 0
+}
+
+// closeWithPolicyViolation sends a close frame with the given reason. It uses
+// WriteControl, which is safe to call concurrently with the writePump.
+func (c *Client) closeWithPolicyViolation(reason string) {
+	msg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait))
+	if err != nil {
+		log.Err(err).Str("connID", c.connID).Msg("writing policy close message")
+	}
+}
+
 // close connection with an error string.
 func closeMessage(ws *websocket.Conn, errStr string) {
 	// close code 1008 is used for a generic "policy violation" message.
@@ -226,6 +334,23 @@ func closeMessage(ws *websocket.Conn, errStr string) {
 	ws.Close()
 }
 
+// closeWithBackoff turns the client away for now: it tells it how many
+// seconds to wait with a BACKOFF message, and closes the connection with a
+// try-again-later close code, with the same hint.
+func closeWithBackoff(ws *websocket.Conn, wait time.Duration) {
+	secs := int((wait + time.Second - 1) / time.Second)
+	deadline := time.Now().Add(writeWait)
+	ws.SetWriteDeadline(deadline)
+	if err := ws.WriteMessage(websocket.TextMessage, fmt.Appendf(nil, "BACKOFF %d", secs)); err != nil {
+		log.Err(err).Msg("writing backoff message")
+	}
+	msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, fmt.Sprintf("retry after %d", secs))
+	if err := ws.WriteControl(websocket.CloseMessage, msg, deadline); err != nil {
+		log.Err(err).Msg("writing backoff close message")
+	}
+	ws.Close()
+}
+
 // ServeWS handles websocket requests from the peer. This runs in its own
 // goroutine.
 func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
@@ -244,7 +369,6 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		log.Err(err).Msg("upgrading socket")
 		return
 	}
-
 	client := &Client{
 		hub:          hub,
 		conn:         conn,
@@ -261,6 +385,11 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		client.conn.Close()
 		return
 	}
+	if wait := hub.backoff(time.Now(), client.username); wait > 0 {
+		log.Info().Interface("ips", fwd).Dur("backoff", wait).Msg("servews-turned-away")
+		closeWithBackoff(conn, wait)
+		return
+	}
 
 	client.hub.register <- client
 
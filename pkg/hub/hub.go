@@ -6,6 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -13,6 +17,7 @@ import (
 
 	"github.com/domino14/tetrolith/pkg/config"
 	"github.com/domino14/tetrolith/pkg/game"
+	"github.com/domino14/tetrolith/pkg/logging"
 )
 
 const ConnPollPeriod = 60 * time.Second
@@ -22,6 +27,21 @@ type BroadcastMessage struct {
 	msg []byte
 }
 
+// A fanout is a broadcast that is being delivered to a snapshot of clients
+// a batch at a time, so that a large broadcast doesn't stall the hub loop.
+type fanout struct {
+	msg     []byte
+	targets []*Client
+}
+
+// closedChan is always ready to receive; it's used to wake the hub loop
+// while there is still pending fan-out work.
+var closedChan = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
 // A UserMessage is a message that should be sent to a user.
 type UserMessage struct {
 	username string
@@ -34,12 +54,36 @@ type ConnMessage struct {
 	msg    []byte
 }
 
+// A spectateRequest subscribes a client to a game's state updates. The
+// catch-up messages and then the state get sent to the client first, if
+// it's let in. If follow is set, the client sees the game the way that
+// player does.
+type spectateRequest struct {
+	client  *Client
+	gameID  string
+	follow  string
+	catchUp [][]byte
+	state   []byte
+}
+
+// A resyncRequest asks for the full state of a game to be sent to a client
+// that thinks it missed something.
+type resyncRequest struct {
+	client *Client
+	gameID string
+}
+
 // Hub maintains the set of active clients and broadcasts messages to the
 // clients.
 type Hub struct {
 	// Registered clients.
 	clientsByUsername map[string]map[*Client]bool
 	clientsByConnID   map[string]*Client
+	// Spectating clients, by game ID.
+	spectators map[string]map[*Client]bool
+	// gameSeq is how many states each game has sent out so far. See
+	// sendState.
+	gameSeq map[string]uint64
 	// Inbound messages from the clients.
 	// broadcast chan []byte
 
@@ -52,27 +96,60 @@ type Hub struct {
 	broadcast       chan BroadcastMessage
 	broadcastUser   chan UserMessage
 	sendConnMessage chan ConnMessage
+	spectate        chan spectateRequest
+	resync          chan resyncRequest
 
 	gameSessionManager *game.SessionManager
 	gameEventsOut      chan []byte
 	cfg                *config.Config
+
+	// Broadcasts that haven't been fully delivered yet, in order.
+	pendingFanout []*fanout
+
+	// numConns mirrors len(clientsByConnID), and drainEnds is when the
+	// games get ended on shutdown, in Unix nanoseconds, or zero. They're
+	// for backoff, which isn't called from the hub loop.
+	numConns  atomic.Int64
+	drainEnds atomic.Int64
+	// connected mirrors the keys of clientsByUsername, for the session
+	// manager to check before it posts a seek again for someone.
+	connected sync.Map
 }
 
 func NewHub(cfg *config.Config) (*Hub, error) {
 	gevents := make(chan []byte, 32)
-	return &Hub{
+	h := &Hub{
 		// broadcast:         make(chan []byte),
 		broadcastUser:      make(chan UserMessage),
 		sendConnMessage:    make(chan ConnMessage),
+		spectate:           make(chan spectateRequest),
+		resync:             make(chan resyncRequest),
 		broadcast:          make(chan BroadcastMessage),
 		register:           make(chan *Client),
 		unregister:         make(chan *Client),
 		clientsByUsername:  make(map[string]map[*Client]bool),
 		clientsByConnID:    make(map[string]*Client),
+		spectators:         make(map[string]map[*Client]bool),
+		gameSeq:            make(map[string]uint64),
 		gameSessionManager: game.NewSessionManager(cfg, gevents),
 		gameEventsOut:      gevents,
 		cfg:                cfg,
-	}, nil
+	}
+	h.gameSessionManager.SetConnectedCheck(func(username string) bool {
+		_, ok := h.connected.Load(username)
+		return ok
+	})
+	h.gameSessionManager.SetReseekSink(func(sess *game.GameSession) {
+		if err := h.broadcastSeek(sess); err != nil {
+			log.Err(err).Msg("broadcasting-reseek")
+		}
+	})
+	if cfg.ResultsFile != "" {
+		if err := h.gameSessionManager.UseResultStore(game.NewResultFile(cfg.ResultsFile)); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
 }
 
 func (h *Hub) addClient(client *Client) error {
@@ -84,7 +161,9 @@ func (h *Hub) addClient(client *Client) error {
 	}
 	// Add the new user ID to the map.
 	h.clientsByUsername[client.username][client] = true
+	h.connected.Store(client.username, true)
 	h.clientsByConnID[client.connID] = client
+	h.numConns.Store(int64(len(h.clientsByConnID)))
 
 	return h.sendInitInfo(client)
 }
@@ -92,15 +171,26 @@ func (h *Hub) addClient(client *Client) error {
 func (h *Hub) removeClient(c *Client) error {
 	// no need to protect with mutex, only called from
 	// single-threaded Run
+	if h.clientsByConnID[c.connID] != c {
+		// Already removed, e.g. for being too slow, before its readPump
+		// unregistered it.
+		return nil
+	}
 	log.Debug().Str("client", c.username).Str("connid", c.connID).Msg("removing client")
 	close(c.send)
 	delete(h.clientsByConnID, c.connID)
+	h.numConns.Store(int64(len(h.clientsByConnID)))
+	if c.spectating != "" {
+		delete(h.spectators[c.spectating], c)
+	}
 
 	if (len(h.clientsByUsername[c.username])) == 1 {
 		delete(h.clientsByUsername, c.username)
+		// Before dropping the seek, so that a reseek can't slip in after.
+		h.connected.Delete(c.username)
 		log.Debug().Msgf("deleted client from clientsbyusername. New length %v", len(
 			h.clientsByUsername))
-
+		h.dropSeek(c.username)
 		return nil
 	}
 	// Otherwise, delete just the right socket (this one: c)
@@ -111,6 +201,25 @@ func (h *Hub) removeClient(c *Client) error {
 	return nil
 }
 
+// dropSeek takes down the open seek of a user who has gone away, so that
+// nobody joins a game with them. A game they're already in is left alone;
+// they might be back.
+func (h *Hub) dropSeek(username string) {
+	if err := h.gameSessionManager.Unseek(username); err != nil {
+		// Not seeking, or already playing.
+		return
+	}
+	log.Info().Str("username", username).Msg("dropped-seek-on-disconnect")
+	// We're on the hub loop, so this can't go through h.broadcast.
+	h.queueFanout(seekLeftMsg(username))
+}
+
+// seekLeftMsg is what the lobby gets told once a player is out of the seek
+// they made or were waiting on. If they made it, it's gone.
+func seekLeftMsg(username string) []byte {
+	return []byte("UNSEEK " + username)
+}
+
 func (h *Hub) sendToConnID(connID string, msg []byte) error {
 	h.sendConnMessage <- ConnMessage{connID: connID, msg: msg}
 	return nil
@@ -156,13 +265,10 @@ func (h *Hub) Run() {
 			}
 
 		case message := <-h.broadcast:
-			for _, client := range h.clientsByConnID {
-				select {
-				case client.send <- message.msg:
-				default:
-					h.removeClient(client)
-				}
-			}
+			h.queueFanout(message.msg)
+
+		case <-h.fanoutReady():
+			h.drainFanout(h.cfg.BroadcastFanoutCap)
 
 		case message := <-h.sendConnMessage:
 			c, ok := h.clientsByConnID[message.connID]
@@ -178,9 +284,44 @@ func (h *Hub) Run() {
 				}
 			}
 
+		case req := <-h.spectate:
+			if _, ok := h.clientsByConnID[req.client.connID]; !ok {
+				// Disconnected in the meantime.
+				break
+			}
+			if h.cfg.MaxSpectators > 0 && req.client.spectating != req.gameID &&
+				len(h.spectators[req.gameID]) >= h.cfg.MaxSpectators {
+				log.Info().Str("gid", req.gameID).Str("connID", req.client.connID).
+					Msg("spectator-cap-reached")
+				h.sendAll(req.client, [][]byte{[]byte("ERROR: " + errTooManySpectators.Error())})
+				break
+			}
+			if !h.sendAll(req.client, req.catchUp) || !h.sendState(req.client, req.gameID, &outState{json: req.state}) {
+				break
+			}
+			if req.client.spectating != "" {
+				delete(h.spectators[req.client.spectating], req.client)
+			}
+			if h.spectators[req.gameID] == nil {
+				h.spectators[req.gameID] = make(map[*Client]bool)
+			}
+			h.spectators[req.gameID][req.client] = true
+			req.client.spectating = req.gameID
+			req.client.following = req.follow
+
+		case req := <-h.resync:
+			h.resyncClient(req.client, req.gameID)
+
 		case <-ticker.C:
 			log.Info().Int("num-conns", len(h.clientsByConnID)).
 				Int("num-users", len(h.clientsByUsername)).Msg("conn-stats")
+			ls := h.gameSessionManager.LobbyStats()
+			log.Info().Int("open-seeks", ls.OpenSeeks).
+				Int("active-games", ls.ActiveGames).
+				Int("recent-games", ls.RecentGames).
+				Int("players-waiting", ls.PlayersWaiting).
+				Int("players-in-games", ls.PlayersInGames).
+				Int("history-entries", ls.HistoryEntries).Msg("lobby-stats")
 
 		case message := <-h.gameEventsOut:
 			// Event from a game. Send to appropriate sockets.
@@ -189,20 +330,261 @@ func (h *Hub) Run() {
 			if err != nil {
 				log.Err(err).Msg("unmarshalling-state")
 			}
-			for _, p := range gsm.Players {
+			h.gameSeq[gsm.ID]++
+			players := gsm.Players
+			if len(players) == 0 {
+				// Don't drop the message on the floor, it might be the
+				// game-over or an error. Send it to whoever the session
+				// manager knows is in the game.
+				players = h.gameSessionManager.PlayersIn(gsm.ID)
+				log.Info().Str("gid", gsm.ID).Strs("players", players).
+					Msg("game-state-without-players")
+			}
+			tailored := make(map[string]*outState, len(players))
+			for _, p := range players {
+				if p == game.GhostPlayer {
+					// Nobody's there to get it.
+					continue
+				}
+				msg, err := game.StateFor(message, gsm, p)
+				if err != nil {
+					log.Err(err).Str("gid", gsm.ID).Msg("tailoring-state")
+					continue
+				}
+				tailored[p] = &outState{json: msg}
 				for client := range h.clientsByUsername[p] {
-					select {
-					case client.send <- message:
-					default:
-						log.Debug().Str("connID", client.connID).Msg("in gevtsout, remove")
-						h.removeClient(client)
+					h.sendState(client, gsm.ID, tailored[p])
+				}
+			}
+			if gsm.Result.IsDraw() && roundJustEnded(gsm) {
+				h.announceDraw(gsm, players)
+			}
+			var watched *outState
+			for client := range h.spectators[gsm.ID] {
+				if slices.Contains(players, client.username) {
+					// They got their own view along with their other
+					// connections; see SPECTATE.
+					continue
+				}
+				var msg *outState
+				if client.following != "" {
+					// Followers get what the player gets, or nothing: never
+					// more than the player can see.
+					msg = tailored[client.following]
+				} else {
+					if watched == nil {
+						state, err := game.SpectatorState(message, gsm)
+						if err != nil {
+							log.Err(err).Str("gid", gsm.ID).Msg("tailoring-spectator-state")
+						}
+						watched = &outState{json: state}
 					}
+					msg = watched
 				}
+				if msg == nil || msg.json == nil {
+					continue
+				}
+				h.sendState(client, gsm.ID, msg)
+			}
+			if gsm.Status == game.PermanentlyOver || gsm.Status == game.Finished {
+				for client := range h.spectators[gsm.ID] {
+					client.spectating = ""
+					client.following = ""
+				}
+				delete(h.spectators, gsm.ID)
+				delete(h.gameSeq, gsm.ID)
 			}
 		}
 	}
 }
 
+// sendAll sends the messages to the client without blocking the hub. A
+// client that can't keep up gets removed; sendAll returns false if so.
+func (h *Hub) sendAll(client *Client, msgs [][]byte) bool {
+	for _, msg := range msgs {
+		select {
+		case client.send <- msg:
+		default:
+			log.Debug().Str("connID", client.connID).Msg("in sendAll, remove")
+			h.removeClient(client)
+			return false
+		}
+	}
+	return true
+}
+
+// roundJustEnded is whether the state is the first one sent after a round
+// ended.
+func roundJustEnded(gsm *game.GameStateManager) bool {
+	switch gsm.Status {
+	case game.Finished, game.Reviewing:
+		return true
+	case game.Countdown:
+		// With a review phase, the countdown comes after it.
+		return gsm.Config == nil || gsm.Config.ReviewPhase == 0
+	}
+	return false
+}
+
+// An outState is a game state on its way out to one or more clients. It
+// only gets packed as MessagePack once, the first time a client needs it.
+type outState struct {
+	json    []byte
+	packed  []byte
+	packErr error
+}
+
+// msgpack returns the state as MessagePack, or nil if it can't be.
+func (s *outState) msgpack() []byte {
+	if s.packed == nil && s.packErr == nil && len(s.json) > 0 && s.json[0] == '{' {
+		if s.packed, s.packErr = toMsgpack(s.json); s.packErr != nil {
+			log.Err(s.packErr).Msg("msgpack-encoding-state")
+		}
+	}
+	return s.packed
+}
+
+// sendState sends a game state to the client, stamped with the client's
+// next sequence number and the game's current one. The game's only goes up
+// when the game sends out a new state, so a snapshot sent on reconnect or
+// resync has the number of the last update it includes. Clients with
+// CapMsgpack get it as MessagePack. Like sendAll, it returns false if the
+// client couldn't keep up and got removed.
+func (h *Hub) sendState(client *Client, gameID string, state *outState) bool {
+	client.stateSeq++
+	msg, stamp := state.json, withSeq
+	if client.hasCap(CapMsgpack) {
+		if packed := state.msgpack(); packed != nil {
+			msg, stamp = packed, withMsgpackSeq
+		}
+	}
+	msg = stamp(msg, "Seq", client.stateSeq)
+	if seq := h.gameSeq[gameID]; seq > 0 {
+		msg = stamp(msg, "GameSeq", seq)
+	}
+	return h.sendAll(client, [][]byte{msg})
+}
+
+// withSeq adds a sequence number field to a marshaled game state.
+func withSeq(state []byte, field string, seq uint64) []byte {
+	if len(state) < 2 || state[0] != '{' {
+		return state
+	}
+	stamped := fmt.Appendf(nil, `{"%s":%d`, field, seq)
+	if len(bytes.TrimSpace(state[1:])) > 1 {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, state[1:]...)
+}
+
+// resyncClient sends the client the full state of the game, as a player
+// or spectator of it would get it.
+func (h *Hub) resyncClient(c *Client, gameID string) {
+	if _, ok := h.clientsByConnID[c.connID]; !ok {
+		// Disconnected in the meantime.
+		return
+	}
+	gm, err := h.gameSessionManager.Game(gameID)
+	var state []byte
+	if err == nil {
+		state = gm.CurrentState()
+		if slices.Contains(gm.Players, c.username) {
+			state, err = game.StateFor(state, gm, c.username)
+		} else if c.spectating != gameID {
+			err = errNotWatching
+		} else if c.following != "" {
+			state, err = game.StateFor(state, gm, c.following)
+		} else {
+			state, err = game.SpectatorState(state, gm)
+		}
+	}
+	if err != nil {
+		h.sendAll(c, [][]byte{[]byte("ERROR: " + err.Error())})
+		return
+	}
+	h.sendState(c, gameID, &outState{json: state})
+}
+
+// announceDraw tells the players that the round they just played was a
+// draw. If another round is coming, they also get a rematch prompt.
+func (h *Hub) announceDraw(gsm *game.GameStateManager, players []string) {
+	msgs := [][]byte{[]byte("DRAW " + gsm.ID)}
+	switch gsm.Status {
+	case game.Countdown:
+		msgs = append(msgs, []byte(fmt.Sprintf("REMATCH %s %d", gsm.ID,
+			game.NextGameCountdownTime/time.Second)))
+	case game.Reviewing:
+		msgs = append(msgs, []byte(fmt.Sprintf("REMATCH %s %d", gsm.ID,
+			(gsm.Config.ReviewPhase+game.NextGameCountdownTime)/time.Second)))
+	}
+	for _, p := range players {
+		if p == game.GhostPlayer {
+			continue
+		}
+		for client := range h.clientsByUsername[p] {
+			for _, msg := range msgs {
+				select {
+				case client.send <- msg:
+				default:
+					log.Debug().Str("connID", client.connID).Msg("in announce-draw, dropped")
+				}
+			}
+		}
+	}
+}
+
+// queueFanout snapshots the currently connected clients and queues up a
+// broadcast to them. The actual sends happen in drainFanout.
+func (h *Hub) queueFanout(msg []byte) {
+	targets := make([]*Client, 0, len(h.clientsByConnID))
+	for _, client := range h.clientsByConnID {
+		targets = append(targets, client)
+	}
+	h.pendingFanout = append(h.pendingFanout, &fanout{msg: msg, targets: targets})
+}
+
+// fanoutReady returns a channel that is ready to receive only if there is
+// pending fan-out work.
+func (h *Hub) fanoutReady() <-chan struct{} {
+	if len(h.pendingFanout) == 0 {
+		return nil
+	}
+	return closedChan
+}
+
+// drainFanout delivers at most maxSends messages from the pending broadcasts,
+// oldest first, so that per-client ordering is preserved. The hub loop goes
+// back to its other work in between batches.
+func (h *Hub) drainFanout(maxSends int) {
+	if maxSends <= 0 {
+		maxSends = len(h.clientsByConnID) + 1
+	}
+	st := time.Now()
+	sends := 0
+	for len(h.pendingFanout) > 0 && sends < maxSends {
+		f := h.pendingFanout[0]
+		for len(f.targets) > 0 && sends < maxSends {
+			client := f.targets[0]
+			f.targets = f.targets[1:]
+			if _, ok := h.clientsByConnID[client.connID]; !ok {
+				// Removed since the broadcast was queued up.
+				continue
+			}
+			sends++
+			select {
+			case client.send <- f.msg:
+			default:
+				h.removeClient(client)
+			}
+		}
+		if len(f.targets) == 0 {
+			h.pendingFanout = h.pendingFanout[1:]
+		}
+	}
+	log.Debug().Int("sends", sends).Dur("elapsed", time.Since(st)).
+		Int("pending-broadcasts", len(h.pendingFanout)).Msg("drained-fanout")
+}
+
 func (h *Hub) socketLogin(c *Client) error {
 
 	token, err := jwt.Parse(c.connToken, func(token *jwt.Token) (interface{}, error) {
@@ -215,18 +597,17 @@ func (h *Hub) socketLogin(c *Client) error {
 		return []byte(h.cfg.SecretKey), nil
 	})
 	if err != nil {
+		log.Err(err).Str("token", logging.Secret(c.connToken)).Msg("socket-login-failure")
 		return err
 	}
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		c.username, ok = claims["usn"].(string)
-		if !ok {
+		// An empty name is the ghost's; see game.GhostPlayer.
+		if !ok || c.username == "" {
 			return errors.New("malformed token - usn")
 		}
 		log.Debug().Str("username", c.username).Msg("socket connection")
 	}
-	if err != nil {
-		log.Err(err).Str("token", c.connToken).Msg("socket-login-failure")
-	}
 	if !token.Valid {
 		return errors.New("invalid token")
 	}
@@ -236,37 +617,85 @@ func (h *Hub) socketLogin(c *Client) error {
 type SeekMsg struct {
 	SearchCriteria json.RawMessage
 	ListName       string
+	Options        game.SeekOptions
+}
+
+// HelloMsg is sent by a client right after connecting to tell us what it
+// supports. We reply with one listing what we support.
+type HelloMsg struct {
+	Caps []string `json:"caps"`
 }
 
+// Capabilities that a client can advertise in its HELLO.
+const (
+	// CapHistory is for clients that can use a HISTORY catch-up message when
+	// they start spectating a game in progress.
+	CapHistory = "history"
+	// CapMsgpack is for clients that want game states as MessagePack, in
+	// binary websocket messages, rather than JSON. Everything else is still
+	// text.
+	CapMsgpack = "msgpack"
+)
+
+// serverCaps are the capabilities this server supports.
+var serverCaps = []string{CapHistory, CapMsgpack}
+
 type GuessMsg struct {
 	Gid   string
 	Guess string
 }
 
+var (
+	errBadlyFormattedMessage  = errors.New("badly formatted message")
+	errTooManyInvalidCommands = errors.New("too many invalid commands")
+	errTooManySpectators      = errors.New("too many spectators in this game")
+	errNotWatching            = errors.New("not playing or watching this game")
+	errFollowDisabled         = errors.New("following players is turned off")
+	errNotAPlayer             = errors.New("that player is not in this game")
+)
+
 func (h *Hub) parseAndExecuteMessage(ctx context.Context, message []byte, c *Client) error {
+	err := h.executeMessage(ctx, message, c)
+	if errors.Is(err, errBadlyFormattedMessage) {
+		if c.recordInvalidCommand(h.cfg.InvalidCommandLimit, h.cfg.InvalidCommandWindow) {
+			return errTooManyInvalidCommands
+		}
+		return err
+	}
+	c.resetInvalidCommands()
+	return err
+}
+
+func (h *Hub) executeMessage(ctx context.Context, message []byte, c *Client) error {
 	tp, pl, _ := bytes.Cut(message, []byte(" "))
 	cmd := string(bytes.TrimSpace(tp))
 	payload := string(bytes.TrimSpace(pl))
 	switch cmd {
+	case "HELLO": // HELLO json
+		helloMsg := &HelloMsg{}
+		err := json.Unmarshal(pl, helloMsg)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errBadlyFormattedMessage, err)
+		}
+		c.setCaps(helloMsg.Caps)
+		hjson, err := json.Marshal(HelloMsg{Caps: serverCaps})
+		if err != nil {
+			return err
+		}
+		c.send <- append([]byte("HELLO "), hjson...)
 	case "SEEK": // SEEK json
 		seekMsg := &SeekMsg{}
 		err := json.Unmarshal(pl, seekMsg)
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: %w", errBadlyFormattedMessage, err)
 		}
-		sess, err := h.gameSessionManager.Seek(c.username, seekMsg.ListName, seekMsg.SearchCriteria)
+		sess, err := h.gameSessionManager.Seek(c.username, seekMsg.ListName, seekMsg.SearchCriteria,
+			seekMsg.Options)
 		if err != nil {
 			return err
 		}
 		// broadcast seek
-		var sk bytes.Buffer
-		sk.WriteString("SEEK ")
-		sjson, err := json.Marshal(sess)
-		if err != nil {
-			return err
-		}
-		sk.WriteString(string(sjson))
-		h.broadcast <- BroadcastMessage{msg: sk.Bytes()}
+		return h.broadcastSeek(sess)
 	case "JOIN":
 		_, err := h.gameSessionManager.Join(c.username, payload)
 		if err != nil {
@@ -280,26 +709,116 @@ func (h *Hub) parseAndExecuteMessage(ctx context.Context, message []byte, c *Cli
 		sk.WriteString(payload)
 		h.broadcast <- BroadcastMessage{msg: sk.Bytes()}
 	case "UNSEEK":
-		err := h.gameSessionManager.Unseek(c.username)
-		if err != nil {
+		if err := h.gameSessionManager.Unseek(c.username); err != nil {
 			return err
 		}
-		// broadcast unseek
-		var sk bytes.Buffer
-		sk.WriteString("UNSEEK ")
-		sk.WriteString(c.username)
-		h.broadcast <- BroadcastMessage{msg: sk.Bytes()}
+		h.broadcast <- BroadcastMessage{msg: seekLeftMsg(c.username)}
 	case "SOLVE":
 		guessMsg := &GuessMsg{}
 		err := json.Unmarshal(pl, guessMsg)
 		if err != nil {
-			return err
+			return fmt.Errorf("%w: %w", errBadlyFormattedMessage, err)
 		}
 		err = h.gameSessionManager.SendGuess(c.username, guessMsg.Gid, guessMsg.Guess)
 		if err != nil {
 			return err
 		}
 
+	case "SPECTATE": // SPECTATE gid [player to follow]
+		gameID, follow, _ := strings.Cut(payload, " ")
+		history, state, err := h.gameSessionManager.Spectate(gameID, h.cfg.SpectatorCatchUp)
+		if err != nil {
+			return err
+		}
+		gm, err := h.gameSessionManager.Game(gameID)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(gm.Players, c.username) {
+			// Players only ever see their own game their own way, however
+			// they ask to watch it.
+			follow = c.username
+		} else if follow != "" && !h.cfg.AllowFollow {
+			return errFollowDisabled
+		}
+		switch {
+		case follow == "":
+			state, err = game.SpectatorState(state, gm)
+		case !slices.Contains(gm.Players, follow):
+			return errNotAPlayer
+		default:
+			state, err = game.StateFor(state, gm, follow)
+		}
+		if err != nil {
+			return err
+		}
+		// Send the recent history first so the client can fast-forward its
+		// animations, then the current state. The hub sends these, once it
+		// knows there's room for another spectator.
+		req := spectateRequest{client: c, gameID: gameID, follow: follow}
+		if c.hasCap(CapHistory) {
+			hjson, err := json.Marshal(history)
+			if err != nil {
+				return err
+			}
+			req.catchUp = append(req.catchUp, append([]byte("HISTORY "), hjson...))
+		}
+		req.state = state
+		h.spectate <- req
+
+	case "RESYNC": // RESYNC gid
+		h.resync <- resyncRequest{client: c, gameID: payload}
+
+	case "TICKINFO":
+		info, err := h.gameSessionManager.TickInfo(payload)
+		if err != nil {
+			return err
+		}
+		ijson, err := json.Marshal(info)
+		if err != nil {
+			return err
+		}
+		c.send <- append([]byte("TICKINFO "), ijson...)
+
+	case "REPLAYS":
+		rjson, err := json.Marshal(h.gameSessionManager.ReplaysFor(c.username))
+		if err != nil {
+			return err
+		}
+		c.send <- append([]byte("REPLAYS "), rjson...)
+
+	case "RECENT": // RECENT [gid]
+		var recent any = h.gameSessionManager.RecentGames()
+		if payload != "" {
+			rg := h.gameSessionManager.RecentGame(payload)
+			if rg == nil {
+				return errors.New("no recent game with that id")
+			}
+			recent = rg
+		}
+		rjson, err := json.Marshal(recent)
+		if err != nil {
+			return err
+		}
+		c.send <- append([]byte("RECENT "), rjson...)
+
+	case "STATS":
+		player := payload
+		if player == "" {
+			player = c.username
+		}
+		sjson, err := json.Marshal(h.gameSessionManager.Stats(c.username, player))
+		if err != nil {
+			return err
+		}
+		c.send <- append([]byte("STATS "), sjson...)
+
+	case "READY":
+		err := h.gameSessionManager.Ready(c.username, payload)
+		if err != nil {
+			return err
+		}
+
 	case "CHAT":
 
 	case "LEAVE":
@@ -315,8 +834,49 @@ func (h *Hub) parseAndExecuteMessage(ctx context.Context, message []byte, c *Cli
 		sk.WriteString(payload)
 		h.broadcast <- BroadcastMessage{msg: sk.Bytes()}
 	default:
-		return errors.New("badly formatted message")
+		return errBadlyFormattedMessage
+	}
+	return nil
+}
+
+// Shutdown warns everyone that the server is going down for maintenance,
+// and waits for the games in progress to finish, ending them after grace.
+// New games can't be started once it's called, and the lobby is told that
+// the open seeks are gone.
+func (h *Hub) Shutdown(grace time.Duration) {
+	h.drainEnds.Store(time.Now().Add(grace).UnixNano())
+	h.broadcast <- BroadcastMessage{msg: []byte(fmt.Sprintf("MAINTENANCE %d", grace/time.Second))}
+	for _, username := range h.gameSessionManager.DrainForMaintenance(grace) {
+		h.broadcast <- BroadcastMessage{msg: seekLeftMsg(username)}
+	}
+}
+
+// backoff returns how long a client connecting now should wait before it
+// tries again, or zero if it can come in. While the server is draining,
+// that's until the games in progress are over, plus ReconnectBackoff, so
+// that clients don't all come back to a server that's still going down.
+// Players with a game in progress still get back in to finish it. At
+// MaxConns, it's ReconnectBackoff.
+func (h *Hub) backoff(now time.Time, username string) time.Duration {
+	if ends := h.drainEnds.Load(); ends != 0 && h.gameSessionManager.GameFor(username) == nil {
+		// Nobody gets in while it's going down, however soon it'll be back.
+		return max(time.Unix(0, ends).Sub(now)+h.cfg.ReconnectBackoff, time.Second)
+	}
+	if h.cfg.MaxConns > 0 && h.numConns.Load() >= int64(h.cfg.MaxConns) {
+		return h.cfg.ReconnectBackoff
+	}
+	return 0
+}
+
+func (h *Hub) broadcastSeek(sess *game.GameSession) error {
+	var sk bytes.Buffer
+	sk.WriteString("SEEK ")
+	sjson, err := json.Marshal(sess)
+	if err != nil {
+		return err
 	}
+	sk.WriteString(string(sjson))
+	h.broadcast <- BroadcastMessage{msg: sk.Bytes()}
 	return nil
 }
 
@@ -329,5 +889,24 @@ func (h *Hub) sendInitInfo(client *Client) error {
 	sessionsMsg = append(sessionsMsg, sessions...)
 
 	client.send <- sessionsMsg
+
+	if h.cfg.ResendStateOnReconnect {
+		return h.sendGameState(client)
+	}
+	return nil
+}
+
+// sendGameState sends the client the current state of the game its user is
+// in, if any, so that a reconnecting player can pick up where they were.
+func (h *Hub) sendGameState(client *Client) error {
+	gm := h.gameSessionManager.GameFor(client.username)
+	if gm == nil {
+		return nil
+	}
+	state, err := game.StateFor(gm.CurrentState(), gm, client.username)
+	if err != nil {
+		return err
+	}
+	h.sendState(client, gm.ID, &outState{json: state})
 	return nil
 }
@@ -0,0 +1,676 @@
+package sockets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/domino14/tetrolith/pkg/config"
+	"github.com/domino14/tetrolith/pkg/game"
+	"github.com/domino14/tetrolith/pkg/logging"
+)
+
+const testSecret = "test-secret"
+
+func testHub(t testing.TB, cfg *config.Config) *Hub {
+	h, err := NewHub(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// addTestClients registers n clients straight into the hub's maps, with
+// room in their send buffers for bufSize messages.
+func addTestClients(h *Hub, n, bufSize int) []*Client {
+	clients := make([]*Client, n)
+	for i := range clients {
+		c := &Client{
+			hub:      h,
+			send:     make(chan []byte, bufSize),
+			username: fmt.Sprintf("user%d", i),
+			connID:   fmt.Sprintf("conn%d", i),
+		}
+		h.clientsByConnID[c.connID] = c
+		h.clientsByUsername[c.username] = map[*Client]bool{c: true}
+		h.connected.Store(c.username, true)
+		clients[i] = c
+	}
+	return clients
+}
+
+func TestRemoveSlowClientThenUnregister(t *testing.T) {
+	h := testHub(t, &config.Config{})
+	slow := addTestClients(h, 1, 0)[0]
+	h.queueFanout([]byte("hello"))
+	h.drainFanout(0)
+	if _, ok := h.clientsByConnID[slow.connID]; ok {
+		t.Fatal("the slow client wasn't dropped")
+	}
+	// Its readPump unregisters it on the way out.
+	if err := h.removeClient(slow); err != nil {
+		t.Error(err)
+	}
+	if len(h.clientsByConnID) != 0 || len(h.clientsByUsername) != 0 {
+		t.Errorf("clients left behind: %v", h.clientsByConnID)
+	}
+}
+
+func TestConnectedUntilLastConnectionGoes(t *testing.T) {
+	h := testHub(t, &config.Config{})
+	c := addTestClients(h, 1, 1)[0]
+	other := &Client{hub: h, send: make(chan []byte, 1), username: c.username, connID: "other"}
+	h.clientsByConnID[other.connID] = other
+	h.clientsByUsername[c.username][other] = true
+
+	for _, gone := range []*Client{c, other} {
+		if _, ok := h.connected.Load(c.username); !ok {
+			t.Fatalf("%s isn't connected before %s goes", c.username, gone.connID)
+		}
+		if err := h.removeClient(gone); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := h.connected.Load(c.username); ok {
+		t.Errorf("%s is still connected with no connections left", c.username)
+	}
+}
+
+// This swaps out the global logger, so it runs before any test leaves hub
+// goroutines behind that log.
+func TestLoginFailureLogsFingerprint(t *testing.T) {
+	var logs bytes.Buffer
+	defer func(l zerolog.Logger) { log.Logger = l }(log.Logger)
+	log.Logger = zerolog.New(zerolog.SyncWriter(&logs))
+
+	h := testHub(t, &config.Config{SecretKey: testSecret})
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"usn": "a"}).
+		SignedString([]byte("some other secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.socketLogin(&Client{connToken: token}); err == nil {
+		t.Fatal("logged in with a token signed with the wrong key")
+	}
+	if out := logs.String(); strings.Contains(out, token) || !strings.Contains(out, logging.Secret(token)) {
+		t.Errorf("logged %s", out)
+	}
+}
+
+func TestLoginNeedsUsername(t *testing.T) {
+	h := testHub(t, &config.Config{SecretKey: testSecret})
+	// An empty name would be the ghost's.
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"usn": game.GhostPlayer}).
+		SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.socketLogin(&Client{connToken: token}); err == nil {
+		t.Error("logged in without a username")
+	}
+}
+
+func TestFanoutIsCappedAndOrdered(t *testing.T) {
+	h := testHub(t, &config.Config{})
+	clients := addTestClients(h, 250, 2)
+	h.queueFanout([]byte("one"))
+	h.queueFanout([]byte("two"))
+
+	h.drainFanout(100)
+	sent := 0
+	for _, c := range clients {
+		sent += len(c.send)
+	}
+	if sent != 100 {
+		t.Errorf("one batch sent %d messages, want 100", sent)
+	}
+	for h.fanoutReady() != nil {
+		h.drainFanout(100)
+	}
+	for _, c := range clients {
+		if first, second := string(<-c.send), string(<-c.send); first != "one" || second != "two" {
+			t.Fatalf("%s got %q then %q", c.username, first, second)
+		}
+	}
+}
+
+// BenchmarkFanoutBatch times one turn of the hub loop at fan-out, for
+// growing numbers of clients. With the cap, it stays about the same.
+func BenchmarkFanoutBatch(b *testing.B) {
+	for _, n := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("clients=%d", n), func(b *testing.B) {
+			h := testHub(b, &config.Config{BroadcastFanoutCap: 256})
+			clients := addTestClients(h, n, 1)
+			msg := []byte("SEEK {}")
+			for i := 0; i < b.N; i++ {
+				if h.fanoutReady() == nil {
+					b.StopTimer()
+					for _, c := range clients {
+						select {
+						case <-c.send:
+						default:
+						}
+					}
+					h.queueFanout(msg)
+					b.StartTimer()
+				}
+				h.drainFanout(h.cfg.BroadcastFanoutCap)
+			}
+		})
+	}
+}
+
+// startTestServer runs a hub behind a websocket server, the way the server
+// command does.
+func startTestServer(t *testing.T, cfg *config.Config) (*Hub, string) {
+	t.Helper()
+	cfg.SecretKey = testSecret
+	h := testHub(t, cfg)
+	go h.Run()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWS(h, w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return h, "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// dial connects as the given user.
+func dial(t *testing.T, url, username string) *websocket.Conn {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"usn": username}).
+		SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, _, err := websocket.DefaultDialer.Dial(url+"?token="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func send(t *testing.T, ws *websocket.Conn, msgs ...string) {
+	t.Helper()
+	for _, m := range msgs {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// countErrors reads until it has seen n ERROR replies. Queued replies can
+// come in one websocket message.
+func countErrors(t *testing.T, ws *websocket.Conn, n int) error {
+	t.Helper()
+	seen := 0
+	for seen < n {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		seen += strings.Count(string(msg), "ERROR: ")
+	}
+	return nil
+}
+
+// readUntil reads until the text received so far contains substr, and
+// returns all of it.
+func readUntil(t *testing.T, ws *websocket.Conn, substr string) string {
+	t.Helper()
+	var got strings.Builder
+	for !strings.Contains(got.String(), substr) {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %q, got %q then %v", substr, got.String(), err)
+		}
+		got.Write(msg)
+	}
+	return got.String()
+}
+
+// addTestGame puts a game that is counting down into the session manager.
+func addTestGame(h *Hub, id string, players ...string) {
+	gm := game.NewGameStateManager(nil, players, "", id, nil, [32]byte{}, nil)
+	h.gameSessionManager.Lock()
+	defer h.gameSessionManager.Unlock()
+	h.gameSessionManager.Sessions[id] = &game.GameSession{ID: id, Players: players, GameManager: gm}
+}
+
+func TestMalformedCommandsDisconnect(t *testing.T) {
+	_, url := startTestServer(t, &config.Config{InvalidCommandLimit: 3, InvalidCommandWindow: time.Minute})
+	ws := dial(t, url, "noisy")
+	send(t, ws, "BOGUS", "BOGUS", "BOGUS")
+	err := countErrors(t, ws, 3)
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.ClosePolicyViolation {
+		t.Fatalf("got %v, want a policy violation close", err)
+	}
+}
+
+func TestValidCommandsResetMalformedCount(t *testing.T) {
+	_, url := startTestServer(t, &config.Config{InvalidCommandLimit: 3, InvalidCommandWindow: time.Minute})
+	ws := dial(t, url, "clumsy")
+	send(t, ws, "BOGUS", "BOGUS", "CHAT", "BOGUS", "BOGUS", "CHAT", "BOGUS", "BOGUS")
+	if err := countErrors(t, ws, 6); err != nil {
+		t.Fatalf("connection dropped: %v", err)
+	}
+}
+
+func TestHelloCapabilities(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{SpectatorCatchUp: 5})
+	addTestGame(h, "gid", "a", "b")
+	gameState := `"ID":"gid"`
+
+	modern := dial(t, url, "modern")
+	send(t, modern, `HELLO {"caps":["history","emotes"]}`)
+	if got := readUntil(t, modern, "HELLO "); !strings.Contains(got, `HELLO {"caps":["history","msgpack"]}`) {
+		t.Errorf("server hello: %q", got)
+	}
+	send(t, modern, "SPECTATE gid")
+	got := readUntil(t, modern, gameState)
+	if i := strings.Index(got, "HISTORY []"); i == -1 || i > strings.Index(got, gameState) {
+		t.Errorf("a client with the history cap got %q", got)
+	}
+
+	// Without a HELLO, a client just gets the state.
+	legacy := dial(t, url, "legacy")
+	send(t, legacy, "SPECTATE gid")
+	if got := readUntil(t, legacy, gameState); strings.Contains(got, "HISTORY") {
+		t.Errorf("a client without the history cap got %q", got)
+	}
+}
+
+func TestGameOverWithoutPlayersIsDelivered(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	addTestGame(h, "gid", "a", "b")
+	conns := []*websocket.Conn{dial(t, url, "a"), dial(t, url, "b")}
+	for _, ws := range conns {
+		// Once the hello is back, the hub knows about the client.
+		send(t, ws, "HELLO {}")
+		readUntil(t, ws, "HELLO ")
+	}
+
+	msg, err := json.Marshal(struct {
+		ID     string
+		Status game.Status
+		Error  string
+	}{"gid", game.PermanentlyOver, "word db went away"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.gameEventsOut <- msg
+	for i, ws := range conns {
+		if got := readUntil(t, ws, `"ID":"gid"`); !strings.Contains(got, "word db went away") {
+			t.Errorf("player %d got %q", i, got)
+		}
+	}
+}
+
+func TestLagReportEvery(t *testing.T) {
+	h := testHub(t, &config.Config{LagReportEvery: 4})
+	c := addTestClients(h, 1, 16)[0]
+	now := time.Now()
+	for range 12 {
+		c.pongCount++
+		c.maybeSendLatency(now)
+	}
+	if len(c.send) != 3 {
+		t.Errorf("12 pongs sent %d lag reports, want 3", len(c.send))
+	}
+	if got := string(<-c.send); !strings.HasPrefix(got, "LAGMS: ") {
+		t.Errorf("sent %q", got)
+	}
+}
+
+func TestLagReportInterval(t *testing.T) {
+	h := testHub(t, &config.Config{LagReportEvery: 1, LagReportInterval: 10 * time.Second})
+	c := addTestClients(h, 1, 16)[0]
+	now := time.Now()
+	for i := range 6 {
+		c.pongCount++
+		c.maybeSendLatency(now.Add(time.Duration(i) * 5 * time.Second))
+	}
+	if len(c.send) != 3 {
+		t.Errorf("30s of pongs sent %d lag reports, want 3", len(c.send))
+	}
+}
+
+func TestDrawOffersRematch(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	conns := []*websocket.Conn{dial(t, url, "a"), dial(t, url, "b")}
+	for _, ws := range conns {
+		send(t, ws, "HELLO {}")
+		readUntil(t, ws, "HELLO ")
+	}
+
+	msg, err := json.Marshal(struct {
+		ID      string
+		Players []string
+		Status  game.Status
+		Result  *game.GameResult
+	}{"gid", []string{"a", "b"}, game.Countdown, &game.GameResult{Winner: game.NoWinner}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.gameEventsOut <- msg
+	for i, ws := range conns {
+		got := readUntil(t, ws, "REMATCH gid")
+		if !strings.Contains(got, "DRAW gid") {
+			t.Errorf("player %d got %q", i, got)
+		}
+	}
+}
+
+func TestReconnectGetsGameState(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{ResendStateOnReconnect: true})
+	addTestGame(h, "gid", "a", "b")
+	h.gameSessionManager.Lock()
+	h.gameSessionManager.SessionsForPlayer["a"] = h.gameSessionManager.Sessions["gid"]
+	h.gameSessionManager.Unlock()
+
+	ws := dial(t, url, "a")
+	if got := readUntil(t, ws, `"YourBoard":0`); !strings.Contains(got, `"Players":["a","b"]`) {
+		t.Errorf("reconnecting player got %q", got)
+	}
+}
+
+func TestSpectatorCap(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{MaxSpectators: 1})
+	addTestGame(h, "gid", "a", "b")
+	first, second := dial(t, url, "c"), dial(t, url, "d")
+	send(t, first, "SPECTATE gid")
+	readUntil(t, first, `"ID":"gid","Status"`)
+	send(t, second, "SPECTATE gid")
+	if got := readUntil(t, second, "ERROR: "); !strings.Contains(got, errTooManySpectators.Error()) {
+		t.Errorf("the spectator past the cap got %q", got)
+	}
+	// Watching the same game again doesn't count twice.
+	send(t, first, "SPECTATE gid")
+	readUntil(t, first, `"ID":"gid","Status"`)
+}
+
+func TestFollowPlayer(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{AllowFollow: true})
+	addTestGame(h, "gid", "a", "b")
+	follower, watcher := dial(t, url, "coach"), dial(t, url, "fan")
+	send(t, follower, "SPECTATE gid c")
+	if got := readUntil(t, follower, "ERROR: "); !strings.Contains(got, errNotAPlayer.Error()) {
+		t.Errorf("following someone who isn't playing got %q", got)
+	}
+	send(t, follower, "SPECTATE gid a")
+	readUntil(t, follower, `"YourBoard":0`)
+	send(t, watcher, "SPECTATE gid")
+	readUntil(t, watcher, `"ID":"gid"`)
+
+	// Each board has one question on it, with progress only its own player
+	// gets to see.
+	board := func(idx, left int) json.RawMessage {
+		return json.RawMessage(fmt.Sprintf(`{"Idx":%d,"FallerPos":-1,"Slots":[{"Whose":%d,`+
+			`"AnswersLeft":%d,"AnswersTotal":3}]}`, idx, idx, left))
+	}
+	cfg := game.DefaultGameConfig()
+	cfg.HideOpponentProgress = true
+	msg, err := json.Marshal(struct {
+		ID      string
+		Players []string
+		Status  game.Status
+		Config  *game.GameConfig
+		Boards  []json.RawMessage
+	}{"gid", []string{"a", "b"}, game.Playing, cfg, []json.RawMessage{board(0, 1), board(1, 2)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.gameEventsOut <- msg
+	got := readUntil(t, follower, `"Boards"`)
+	if !strings.Contains(got, `"AnswersLeft":1`) || strings.Contains(got, `"AnswersLeft":2`) {
+		t.Errorf("the follower got %q", got)
+	}
+	got = readUntil(t, watcher, `"Boards"`)
+	// With progress hidden from the players, it's hidden from spectators too.
+	if strings.Contains(got, `"AnswersLeft":1`) || strings.Contains(got, `"AnswersLeft":2`) {
+		t.Errorf("a plain spectator got %q", got)
+	}
+}
+
+func TestSpectateOwnGame(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	addTestGame(h, "gid", "a", "b")
+	player, watcher := dial(t, url, "a"), dial(t, url, "fan")
+	// Watching your own game gets you your own view of it, same as playing.
+	send(t, player, "SPECTATE gid")
+	readUntil(t, player, `"YourBoard":0`)
+	send(t, watcher, "SPECTATE gid")
+	readUntil(t, watcher, `"ID":"gid"`)
+
+	// b's board is private; only its falling piece gives it away.
+	cfg := game.DefaultGameConfig()
+	cfg.PrivatePlayers = []string{"b"}
+	msg, err := json.Marshal(struct {
+		ID      string
+		Players []string
+		Status  game.Status
+		Config  *game.GameConfig
+		Boards  []json.RawMessage
+	}{"gid", []string{"a", "b"}, game.Playing, cfg, []json.RawMessage{
+		json.RawMessage(`{"Idx":0,"FallerPos":-1}`),
+		json.RawMessage(`{"Idx":1,"FallerPos":7}`),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.gameEventsOut <- msg
+	for name, ws := range map[string]*websocket.Conn{"the player": player, "a spectator": watcher} {
+		got := readUntil(t, ws, `"Private":true`)
+		// Anything else that comes has to be redacted too.
+		ws.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		if _, more, err := ws.ReadMessage(); err == nil {
+			got += string(more)
+		}
+		if strings.Contains(got, `"FallerPos":7`) {
+			t.Errorf("%s saw the private board: %q", name, got)
+		}
+	}
+}
+
+func TestFollowDisabled(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	addTestGame(h, "gid", "a", "b")
+	ws := dial(t, url, "coach")
+	send(t, ws, "SPECTATE gid a")
+	if got := readUntil(t, ws, "ERROR: "); !strings.Contains(got, errFollowDisabled.Error()) {
+		t.Errorf("following with it turned off got %q", got)
+	}
+}
+
+func TestBackoffWhileDraining(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{ReconnectBackoff: 5 * time.Second})
+	if wait := h.backoff(time.Now(), "x"); wait != 0 {
+		t.Fatalf("turned away for %v before draining", wait)
+	}
+	h.Shutdown(30 * time.Second)
+
+	ws := dial(t, url, "late")
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secs int
+	if _, err := fmt.Sscanf(string(msg), "BACKOFF %d", &secs); err != nil || secs < 30 || secs > 35 {
+		t.Errorf("got %q, want a backoff of the grace plus a bit", msg)
+	}
+	_, _, err = ws.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseTryAgainLater ||
+		closeErr.Text != fmt.Sprintf("retry after %d", secs) {
+		t.Errorf("got %v, want a try-again-later close", err)
+	}
+}
+
+func TestShutdownCancelsSeeks(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	if _, err := h.gameSessionManager.Seek("c", "list", []byte("{}"), game.SeekOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ws := dial(t, url, "lobby")
+	// An error back means the hub has the connection.
+	send(t, ws, "UNSEEK")
+	if err := countErrors(t, ws, 1); err != nil {
+		t.Fatal(err)
+	}
+	h.Shutdown(0)
+	readUntil(t, ws, "UNSEEK c")
+}
+
+func TestNoBackoffForGamesInProgress(t *testing.T) {
+	h := testHub(t, &config.Config{ReconnectBackoff: 5 * time.Second})
+	addTestGame(h, "gid", "a", "b")
+	h.gameSessionManager.Lock()
+	h.gameSessionManager.SessionsForPlayer["a"] = h.gameSessionManager.Sessions["gid"]
+	h.gameSessionManager.Unlock()
+	h.drainEnds.Store(time.Now().Add(30 * time.Second).UnixNano())
+	if wait := h.backoff(time.Now(), "a"); wait != 0 {
+		t.Errorf("a player with a game going was turned away for %v", wait)
+	}
+	if wait := h.backoff(time.Now(), "late"); wait < 30*time.Second {
+		t.Errorf("someone with no game was turned away for just %v", wait)
+	}
+}
+
+func TestBackoffAtMaxConns(t *testing.T) {
+	h := testHub(t, &config.Config{MaxConns: 2, ReconnectBackoff: 5 * time.Second})
+	h.addClient(&Client{hub: h, send: make(chan []byte, 16), username: "a", connID: "a"})
+	if wait := h.backoff(time.Now(), "x"); wait != 0 {
+		t.Errorf("turned away for %v with room left", wait)
+	}
+	h.addClient(&Client{hub: h, send: make(chan []byte, 16), username: "b", connID: "b"})
+	if wait := h.backoff(time.Now(), "x"); wait != 5*time.Second {
+		t.Errorf("at the cap, backoff %v, want 5s", wait)
+	}
+}
+
+func TestWithSeq(t *testing.T) {
+	for state, want := range map[string]string{
+		`{"ID":"gid"}`: `{"Seq":3,"ID":"gid"}`,
+		`{}`:           `{"Seq":3}`,
+		`SEEK {}`:      `SEEK {}`,
+	} {
+		if got := string(withSeq([]byte(state), "Seq", 3)); got != want {
+			t.Errorf("withSeq(%s) = %s, want %s", state, got, want)
+		}
+	}
+}
+
+func TestResyncNumbersStates(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	addTestGame(h, "gid", "a", "b")
+	player, outsider := dial(t, url, "a"), dial(t, url, "c")
+	send(t, player, "RESYNC gid")
+	if got := readUntil(t, player, `"Seq":1,`); !strings.Contains(got, `"YourBoard":0`) {
+		t.Errorf("resyncing player got %q", got)
+	}
+	send(t, player, "RESYNC gid")
+	readUntil(t, player, `"Seq":2,`)
+
+	send(t, outsider, "RESYNC gid")
+	if got := readUntil(t, outsider, "ERROR: "); !strings.Contains(got, errNotWatching.Error()) {
+		t.Errorf("resyncing a game they aren't in got %q", got)
+	}
+}
+
+var gameSeqRe = regexp.MustCompile(`"GameSeq":(\d+),`)
+
+// gameSeqs lists the GameSeqs of the states in the text, in order.
+func gameSeqs(text string) []string {
+	var seqs []string
+	for _, m := range gameSeqRe.FindAllStringSubmatch(text, -1) {
+		seqs = append(seqs, m[1])
+	}
+	return seqs
+}
+
+func TestGameSeqHasNoGaps(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	addTestGame(h, "gid", "a", "b")
+	ws := dial(t, url, "a")
+	send(t, ws, "HELLO {}")
+	readUntil(t, ws, "HELLO ")
+
+	update, err := json.Marshal(struct {
+		ID      string
+		Players []string
+		Status  game.Status
+	}{"gid", []string{"a", "b"}, game.Playing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		h.gameEventsOut <- update
+	}
+	if got := gameSeqs(readUntil(t, ws, `"GameSeq":3,`)); !slices.Equal(got, []string{"1", "2", "3"}) {
+		t.Errorf("updates numbered %v", got)
+	}
+	// A snapshot has the number of the last update it includes; the next
+	// update follows on from it.
+	send(t, ws, "RESYNC gid")
+	if got := gameSeqs(readUntil(t, ws, `"Seq":4,`)); !slices.Equal(got, []string{"3"}) {
+		t.Errorf("the resync snapshot is numbered %v", got)
+	}
+	h.gameEventsOut <- update
+	if got := gameSeqs(readUntil(t, ws, `"Seq":5,`)); !slices.Equal(got, []string{"4"}) {
+		t.Errorf("the update after the snapshot is numbered %v", got)
+	}
+}
+
+func TestDisconnectDropsSeek(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	watcher, seeker, seeker2 := dial(t, url, "w"), dial(t, url, "s"), dial(t, url, "s")
+	for _, ws := range []*websocket.Conn{watcher, seeker2} {
+		send(t, ws, "HELLO {}")
+		readUntil(t, ws, "HELLO ")
+	}
+	send(t, seeker, `SEEK {"ListName":"list","SearchCriteria":{}}`)
+	readUntil(t, watcher, `SEEK {"Players":["s"]`)
+	seeking := func() bool {
+		h.gameSessionManager.Lock()
+		defer h.gameSessionManager.Unlock()
+		_, ok := h.gameSessionManager.SessionsForPlayer["s"]
+		return ok
+	}
+
+	// The seeker is still around on their other socket.
+	seeker.Close()
+	send(t, seeker2, "HELLO {}")
+	readUntil(t, seeker2, "HELLO ")
+	if !seeking() {
+		t.Fatal("the seek was dropped while the seeker was still connected")
+	}
+
+	seeker2.Close()
+	readUntil(t, watcher, "UNSEEK s")
+	if seeking() {
+		t.Error("the seek is still open")
+	}
+}
+
+func TestSeekLeftMsg(t *testing.T) {
+	if got := string(seekLeftMsg("s")); got != "UNSEEK s" {
+		t.Errorf("got %q", got)
+	}
+}
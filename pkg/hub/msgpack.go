@@ -0,0 +1,154 @@
+package sockets
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// toMsgpack re-encodes a JSON value as MessagePack, for clients with
+// CapMsgpack. Object keys come out sorted, though withMsgpackSeq can add
+// more at the front afterwards. Numbers that are whole come out
+// as the smallest integer type they fit in, and the rest as float64.
+func toMsgpack(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return appendMsgpack(nil, v)
+}
+
+func appendMsgpack(b []byte, v any) ([]byte, error) {
+	var err error
+	switch v := v.(type) {
+	case nil:
+		b = append(b, 0xc0)
+	case bool:
+		if v {
+			b = append(b, 0xc3)
+		} else {
+			b = append(b, 0xc2)
+		}
+	case json.Number:
+		if n, ierr := v.Int64(); ierr == nil {
+			b = appendMsgpackInt(b, n)
+			break
+		}
+		f, ferr := v.Float64()
+		if ferr != nil {
+			return nil, ferr
+		}
+		b = append(b, 0xcb)
+		b = binary.BigEndian.AppendUint64(b, math.Float64bits(f))
+	case string:
+		b = appendMsgpackLen(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b = append(b, v...)
+	case []any:
+		b = appendMsgpackLen(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			if b, err = appendMsgpack(b, e); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		b = appendMsgpackLen(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			if b, err = appendMsgpack(b, k); err != nil {
+				return nil, err
+			}
+			if b, err = appendMsgpack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("can't encode %T as msgpack", v)
+	}
+	return b, nil
+}
+
+// withMsgpackSeq adds a sequence number field to a game state that's
+// already packed, at the front of the map like withSeq does, without
+// re-encoding the rest of it.
+func withMsgpackSeq(packed []byte, field string, seq uint64) []byte {
+	n, hdr, ok := msgpackMapLen(packed)
+	if !ok {
+		return packed
+	}
+	stamped := appendMsgpackLen(nil, n+1, 0x80, 16, 0, 0xde, 0xdf)
+	stamped = appendMsgpackLen(stamped, len(field), 0xa0, 32, 0xd9, 0xda, 0xdb)
+	stamped = append(stamped, field...)
+	stamped = appendMsgpackInt(stamped, int64(seq))
+	return append(stamped, packed[hdr:]...)
+}
+
+// msgpackMapLen reads the header of a packed map: how many entries it has,
+// and how many bytes the header takes. ok is false if it isn't a map.
+func msgpackMapLen(b []byte) (n, hdr int, ok bool) {
+	switch {
+	case len(b) >= 1 && b[0]&0xf0 == 0x80:
+		return int(b[0] & 0x0f), 1, true
+	case len(b) >= 3 && b[0] == 0xde:
+		return int(binary.BigEndian.Uint16(b[1:])), 3, true
+	case len(b) >= 5 && b[0] == 0xdf:
+		return int(binary.BigEndian.Uint32(b[1:])), 5, true
+	}
+	return 0, 0, false
+}
+
+// appendMsgpackLen appends the header for a string, array or map of length
+// n: the fix type if it's under fixMax, otherwise the 8-bit (if there is
+// one for the type), 16-bit or 32-bit length type.
+func appendMsgpackLen(b []byte, n int, fix byte, fixMax int, t8, t16, t32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case t8 != 0 && n <= math.MaxUint8:
+		return append(b, t8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, t16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, t32), uint32(n))
+	}
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= math.MaxInt8:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(n))
+	case n >= 0:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), uint64(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+	}
+}
+
+// isBinary is whether a message for the client is MessagePack rather than
+// text. Text messages all start with an ASCII command or a JSON object, and
+// a MessagePack state is a map, whose first byte never is ASCII.
+func isBinary(msg []byte) bool {
+	return len(msg) > 0 && msg[0] >= 0x80
+}
@@ -0,0 +1,351 @@
+package sockets
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/domino14/tetrolith/pkg/config"
+)
+
+// decodeMsgpack decodes one MessagePack value off the front of b, going by
+// the spec rather than by the encoder, and returns it with what's left of
+// b. Integers come back as int64, and maps as map[string]any.
+func decodeMsgpack(b []byte) (any, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("out of bytes")
+	}
+	t, b := b[0], b[1:]
+	// take reads an n-byte big-endian unsigned length or number.
+	take := func(n int) (uint64, error) {
+		if len(b) < n {
+			return 0, fmt.Errorf("out of bytes for a %d-byte number", n)
+		}
+		var v uint64
+		for _, c := range b[:n] {
+			v = v<<8 | uint64(c)
+		}
+		b = b[n:]
+		return v, nil
+	}
+	var n uint64
+	var err error
+	switch {
+	case t <= 0x7f:
+		return int64(t), b, nil
+	case t >= 0xe0:
+		return int64(int8(t)), b, nil
+	case t&0xe0 == 0xa0:
+		return decodeMsgpackStr(b, int(t&0x1f))
+	case t&0xf0 == 0x90:
+		return decodeMsgpackArray(b, int(t&0x0f))
+	case t&0xf0 == 0x80:
+		return decodeMsgpackMap(b, int(t&0x0f))
+	}
+	switch t {
+	case 0xc0:
+		return nil, b, nil
+	case 0xc2:
+		return false, b, nil
+	case 0xc3:
+		return true, b, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err = take(1 << (t - 0xcc))
+		if t == 0xcf && n > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("uint64 %d doesn't fit", n)
+		}
+		return int64(n), b, err
+	case 0xd0:
+		n, err = take(1)
+		return int64(int8(n)), b, err
+	case 0xd1:
+		n, err = take(2)
+		return int64(int16(n)), b, err
+	case 0xd2:
+		n, err = take(4)
+		return int64(int32(n)), b, err
+	case 0xd3:
+		n, err = take(8)
+		return int64(n), b, err
+	case 0xca:
+		n, err = take(4)
+		return float64(math.Float32frombits(uint32(n))), b, err
+	case 0xcb:
+		n, err = take(8)
+		return math.Float64frombits(n), b, err
+	case 0xd9, 0xda, 0xdb:
+		if n, err = take(1 << (t - 0xd9)); err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackStr(b, int(n))
+	case 0xdc, 0xdd:
+		if n, err = take(2 << (t - 0xdc)); err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackArray(b, int(n))
+	case 0xde, 0xdf:
+		if n, err = take(2 << (t - 0xde)); err != nil {
+			return nil, nil, err
+		}
+		return decodeMsgpackMap(b, int(n))
+	}
+	return nil, nil, fmt.Errorf("unexpected type byte %#x", t)
+}
+
+func decodeMsgpackStr(b []byte, n int) (any, []byte, error) {
+	if len(b) < n {
+		return nil, nil, fmt.Errorf("out of bytes for a %d-byte string", n)
+	}
+	return string(b[:n]), b[n:], nil
+}
+
+func decodeMsgpackArray(b []byte, n int) (any, []byte, error) {
+	arr := []any{}
+	for range n {
+		v, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		arr, b = append(arr, v), rest
+	}
+	return arr, b, nil
+}
+
+func decodeMsgpackMap(b []byte, n int) (any, []byte, error) {
+	m := map[string]any{}
+	for range n {
+		k, rest, err := decodeMsgpack(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("map key %v isn't a string", k)
+		}
+		v, rest, err := decodeMsgpack(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		m[key], b = v, rest
+	}
+	return m, b, nil
+}
+
+// fromJSON decodes JSON the way decodeMsgpack decodes MessagePack.
+func fromJSON(t *testing.T, data []byte) any {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	var norm func(any) any
+	norm = func(v any) any {
+		switch v := v.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				return n
+			}
+			f, _ := v.Float64()
+			return f
+		case []any:
+			for i := range v {
+				v[i] = norm(v[i])
+			}
+		case map[string]any:
+			for k := range v {
+				v[k] = norm(v[k])
+			}
+		}
+		return v
+	}
+	return norm(v)
+}
+
+// msgpackVectors are JSON values and their MessagePack encodings, worked out
+// from the spec by hand.
+var msgpackVectors = []struct {
+	json string
+	hex  string
+}{
+	{`null`, "c0"},
+	{`false`, "c2"},
+	{`true`, "c3"},
+	{`0`, "00"},
+	{`127`, "7f"},
+	{`128`, "cc80"},
+	{`255`, "ccff"},
+	{`256`, "cd0100"},
+	{`65536`, "ce00010000"},
+	{`4294967296`, "cf0000000100000000"},
+	{`-1`, "ff"},
+	{`-32`, "e0"},
+	{`-33`, "d0df"},
+	{`-129`, "d1ff7f"},
+	{`-32769`, "d2ffff7fff"},
+	{`-2147483649`, "d3ffffffff7fffffff"},
+	{`1.5`, "cb3ff8000000000000"},
+	{`-0.25`, "cbbfd0000000000000"},
+	{`""`, "a0"},
+	{`"a"`, "a161"},
+	{`"` + strings.Repeat("x", 31) + `"`, "bf" + strings.Repeat("78", 31)},
+	{`"` + strings.Repeat("x", 32) + `"`, "d920" + strings.Repeat("78", 32)},
+	{`"` + strings.Repeat("x", 256) + `"`, "da0100" + strings.Repeat("78", 256)},
+	{`"é"`, "a2c3a9"},
+	{`[]`, "90"},
+	{`[1,[2]]`, "92019102"},
+	{`[` + strings.Repeat("0,", 15) + `0]`, "dc0010" + strings.Repeat("00", 16)},
+	{`{}`, "80"},
+	{`{"b":1,"a":null}`, "82a161c0a16201"},
+}
+
+func TestMsgpackVectors(t *testing.T) {
+	for _, v := range msgpackVectors {
+		want, err := hex.DecodeString(v.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := toMsgpack([]byte(v.json))
+		if err != nil {
+			t.Errorf("%.20s: %v", v.json, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%.20s encoded as %x, want %x", v.json, got, want)
+		}
+		back, rest, err := decodeMsgpack(want)
+		if err != nil || len(rest) != 0 {
+			t.Errorf("%.20s: decoding %x: %v, %d bytes left", v.json, want, err, len(rest))
+			continue
+		}
+		if wantBack := fromJSON(t, []byte(v.json)); !reflect.DeepEqual(back, wantBack) {
+			t.Errorf("%.20s decoded as %#v, want %#v", v.json, back, wantBack)
+		}
+	}
+
+	// A map with 16 entries needs a map16 header.
+	m := map[string]int{}
+	for i := range 16 {
+		m[fmt.Sprintf("k%02d", i)] = i
+	}
+	js, _ := json.Marshal(m)
+	got, err := toMsgpack(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xde, 0, 16}; !bytes.HasPrefix(got, want) {
+		t.Errorf("a 16-entry map starts %x, want %x", got[:3], want)
+	}
+}
+
+// sampleState is a game state with a bit of everything in it: statuses,
+// state changes, and questions with their answers.
+const sampleState = `{"Seq":12,"GameSeq":40,"ID":"gid","Status":1,"Players":["a","b"],
+"Boards":[{"Idx":0,"Slots":[null,null,{"OrigQuestion":{"Alphagram":"AEINRST",
+"Words":[{"Word":"RETAINS","LexiconSymbols":"#"},{"Word":"STAINER"},{"Word":"NASTIER"}]},
+"Whose":0,"AnswersLeft":2,"AnswersTotal":3,"Rarity":87}],"FallerPos":2,
+"LastStateChange":{"ChangeType":"piecefall","PayloadNum":2,"PayloadNum2":-1,"Positions":[1,2],
+"OccurredAt":1760000000123},"Queue":[],"OppQueue":null,"Dead":false,"Won":false,"Solved":4}],
+"Result":null,"ColorIndices":[5,4],"YourBoard":0,"TimeLeft":-1.5}`
+
+func TestMsgpackStateRoundTrip(t *testing.T) {
+	packed, err := toMsgpack([]byte(sampleState))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isBinary(packed) {
+		t.Error("a packed state doesn't look binary")
+	}
+	got, rest, err := decodeMsgpack(packed)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("decoding: %v, %d bytes left", err, len(rest))
+	}
+	if want := fromJSON(t, []byte(sampleState)); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip gave %v, want %v", got, want)
+	}
+	if len(packed) >= len(sampleState) {
+		t.Errorf("packed state is %d bytes, JSON is %d", len(packed), len(sampleState))
+	}
+}
+
+func TestWithMsgpackSeq(t *testing.T) {
+	// Sixteen entries once both are in, so the header has to grow too.
+	m := map[string]int{}
+	for i := range 14 {
+		m[fmt.Sprintf("k%02d", i)] = i
+	}
+	js, _ := json.Marshal(m)
+	for _, state := range [][]byte{[]byte(`{}`), []byte(`{"ID":"gid"}`), js} {
+		packed, err := toMsgpack(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stamped := withMsgpackSeq(withMsgpackSeq(packed, "Seq", 3), "GameSeq", 70000)
+		got, rest, err := decodeMsgpack(stamped)
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("decoding %x: %v, %d bytes left", stamped, err, len(rest))
+		}
+		want := fromJSON(t, withSeq(withSeq(state, "Seq", 3), "GameSeq", 70000))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("stamped %s gave %v, want %v", state, got, want)
+		}
+	}
+	if got := withMsgpackSeq([]byte{0x91, 0x01}, "Seq", 3); !bytes.Equal(got, []byte{0x91, 0x01}) {
+		t.Errorf("stamped an array: %x", got)
+	}
+}
+
+// BenchmarkStateEncoding encodes a state as MessagePack and reports how big
+// it is next to the JSON.
+func BenchmarkStateEncoding(b *testing.B) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(sampleState)); err != nil {
+		b.Fatal(err)
+	}
+	state := compact.Bytes()
+	var packed []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		if packed, err = toMsgpack(state); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(state)), "json-bytes")
+	b.ReportMetric(float64(len(packed)), "msgpack-bytes")
+}
+
+func TestMsgpackStatesAreBinary(t *testing.T) {
+	h, url := startTestServer(t, &config.Config{})
+	addTestGame(h, "gid", "a", "b")
+	ws := dial(t, url, "a")
+	send(t, ws, `HELLO {"caps":["msgpack"]}`)
+	readUntil(t, ws, "HELLO ")
+	send(t, ws, "RESYNC gid")
+	for {
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		frameType, msg, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frameType != websocket.BinaryMessage {
+			continue
+		}
+		state, rest, err := decodeMsgpack(msg)
+		if err != nil || len(rest) != 0 {
+			t.Fatalf("decoding %x: %v, %d bytes left", msg, err, len(rest))
+		}
+		if m, _ := state.(map[string]any); m["ID"] != "gid" || m["YourBoard"] != int64(0) {
+			t.Errorf("got state %v", state)
+		}
+		return
+	}
+}
@@ -0,0 +1,38 @@
+// Package logging has helpers for keeping secrets out of the logs.
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+)
+
+// showSecrets turns the redaction off. It's only for debugging locally;
+// see config.Config.LogSecrets.
+var showSecrets atomic.Bool
+
+// ShowSecrets sets whether Secret and Guess log things as they are.
+func ShowSecrets(show bool) {
+	showSecrets.Store(show)
+}
+
+// Secret stands in for a token or a key in the logs. A token is as good as
+// a password until it expires, so it never gets logged itself; the
+// fingerprint is enough to tell if two log lines are about the same one.
+func Secret(s string) string {
+	if showSecrets.Load() {
+		return s
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:6])
+}
+
+// Guess stands in for a guess in the logs. Guesses are answers more often
+// than not, so only their length gets logged.
+func Guess(g string) string {
+	if showSecrets.Load() {
+		return g
+	}
+	return "len:" + strconv.Itoa(len(g))
+}